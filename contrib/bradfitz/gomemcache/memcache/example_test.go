@@ -26,3 +26,19 @@ func Example() {
 	mc.WithContext(ctx).Set(&memcache.Item{Key: "my key", Value: []byte("my value")})
 
 }
+
+func ExampleClient_WithContext() {
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "parent.request",
+		tracer.ServiceName("web"),
+		tracer.ResourceName("/home"),
+	)
+	defer span.Finish()
+
+	mc := memcachetrace.WrapClient(memcache.New("127.0.0.1:11211"))
+	// The cache can be filled asynchronously: the span of the operation is
+	// still a child of the request span, even if the request finishes first.
+	// The context of a request is usually canceled once it finishes, so only
+	// the request span is kept to avoid short-circuiting the operation.
+	ctx = tracer.ContextWithSpan(context.Background(), span)
+	go mc.WithContext(ctx).Set(&memcache.Item{Key: "my key", Value: []byte("my value")})
+}
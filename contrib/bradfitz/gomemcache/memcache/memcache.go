@@ -9,11 +9,19 @@
 // the same methods, so should be seamless for existing applications. It also
 // has an additional `WithContext` method which can be used to connect a span
 // to an existing trace.
+//
+// Note that operations run with a context which is done are not sent to the
+// server and return the context's error. The underlying client doesn't support
+// contexts, so operations in flight are bounded by the client's Timeout rather
+// than by the deadline of the context.
 package memcache // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/bradfitz/gomemcache/memcache"
 
 import (
 	"context"
+	"errors"
 	"math"
+	"net"
+	"time"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
@@ -26,6 +34,18 @@ import (
 
 const componentName = "bradfitz/gomemcache/memcache"
 
+// tagTimeout is set on spans of operations which failed because the deadline
+// of the client's context was exceeded, before or while they were run.
+const tagTimeout = "memcached.timeout"
+
+// tagCASConflict is set on spans of CompareAndSwap operations which failed
+// because the item was modified since it was fetched.
+const tagCASConflict = "memcached.cas.conflict"
+
+// metricResponseBytes is set on spans of Get and GetMulti operations to the
+// size of the values returned, when enabled with WithResponseSize.
+const metricResponseBytes = "memcached.response.bytes"
+
 func init() {
 	telemetry.LoadIntegration(componentName)
 }
@@ -53,7 +73,17 @@ type Client struct {
 	context context.Context
 }
 
-// WithContext creates a copy of the Client with the given context.
+// WithContext creates a copy of the Client with the given context. The spans
+// of its operations are children of the span held by the context, including
+// when they are run asynchronously, e.g. in a goroutine started by a request
+// handler which returns before the operation is sent. Operations are
+// short-circuited once the context is done, returning the context's error, but
+// operations in flight only time out with the client's Timeout. Operations
+// which may outlive a request should thus be given a context which isn't
+// canceled when the request finishes, e.g.:
+//
+//	ctx = tracer.ContextWithSpan(context.Background(), span)
+//	go mc.WithContext(ctx).Set(item)
 func (c *Client) WithContext(ctx context.Context) *Client {
 	// the existing memcache client doesn't support context, but may in the
 	// future, so we do a runtime check to detect this
@@ -70,8 +100,15 @@ func (c *Client) WithContext(ctx context.Context) *Client {
 	}
 }
 
-// startSpan starts a span from the context set with WithContext.
-func (c *Client) startSpan(resourceName string) ddtrace.Span {
+// startSpan starts a span from the context set with WithContext. The key is
+// used to find the server which the operation is sent to, and is empty for
+// the operations which aren't bound to a single key.
+func (c *Client) startSpan(resourceName, key string) ddtrace.Span {
+	if c.cfg.resourceNamer != nil {
+		if name := c.cfg.resourceNamer(resourceName, key); name != "" {
+			resourceName = name
+		}
+	}
 	opts := []ddtrace.StartSpanOption{
 		tracer.SpanType(ext.SpanTypeMemcached),
 		tracer.ServiceName(c.cfg.serviceName),
@@ -83,104 +120,204 @@ func (c *Client) startSpan(resourceName string) ddtrace.Span {
 	if !math.IsNaN(c.cfg.analyticsRate) {
 		opts = append(opts, tracer.Tag(ext.EventSampleRate, c.cfg.analyticsRate))
 	}
+	if c.cfg.selector != nil && key != "" {
+		if addr, err := c.cfg.selector.PickServer(key); err == nil {
+			if host, port, err := net.SplitHostPort(addr.String()); err == nil {
+				opts = append(opts, tracer.Tag(ext.TargetHost, host), tracer.Tag(ext.TargetPort, port))
+			} else {
+				opts = append(opts, tracer.Tag(ext.TargetHost, addr.String()))
+			}
+		}
+	}
 	span, _ := tracer.StartSpanFromContext(c.context, c.cfg.operationName, opts...)
 	return span
 }
 
+// timedOut reports whether err is a timeout of an operation which was run
+// until the deadline of the client's context.
+func (c *Client) timedOut(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	deadline, ok := c.context.Deadline()
+	if !ok || time.Now().Before(deadline) {
+		return false
+	}
+	var (
+		ne net.Error
+		ce *memcache.ConnectTimeoutError
+	)
+	return errors.As(err, &ne) && ne.Timeout() || errors.As(err, &ce)
+}
+
+// finishSpan finishes the span with the given error, tagging it when the
+// deadline of the client's context was exceeded or when a compare-and-swap
+// conflicted. Errors ignored by the configured error check don't mark the span
+// as erroneous.
+func (c *Client) finishSpan(span ddtrace.Span, err error) {
+	if c.timedOut(err) {
+		span.SetTag(tagTimeout, true)
+	} else if errors.Is(err, memcache.ErrCASConflict) {
+		span.SetTag(tagCASConflict, true)
+	}
+	if !c.cfg.errCheck.Check(err) {
+		err = nil
+	}
+	span.Finish(tracer.WithError(err))
+}
+
 // wrapped methods:
+//
+// The underlying client doesn't support contexts, so the operations are not
+// run at all when the client's context is already done, in which case the
+// context error is returned. Operations in flight are bounded by the client's
+// Timeout; their timeouts are tagged when the context deadline passed too.
 
 // Add invokes and traces Client.Add.
 func (c *Client) Add(item *memcache.Item) error {
-	span := c.startSpan("Add")
-	err := c.Client.Add(item)
-	span.Finish(tracer.WithError(err))
+	span := c.startSpan("Add", item.Key)
+	err := c.context.Err()
+	if err == nil {
+		err = c.Client.Add(item)
+	}
+	c.finishSpan(span, err)
 	return err
 }
 
 // CompareAndSwap invokes and traces Client.CompareAndSwap.
 func (c *Client) CompareAndSwap(item *memcache.Item) error {
-	span := c.startSpan("CompareAndSwap")
-	err := c.Client.CompareAndSwap(item)
-	span.Finish(tracer.WithError(err))
+	span := c.startSpan("CompareAndSwap", item.Key)
+	err := c.context.Err()
+	if err == nil {
+		err = c.Client.CompareAndSwap(item)
+	}
+	c.finishSpan(span, err)
 	return err
 }
 
 // Decrement invokes and traces Client.Decrement.
 func (c *Client) Decrement(key string, delta uint64) (newValue uint64, err error) {
-	span := c.startSpan("Decrement")
-	newValue, err = c.Client.Decrement(key, delta)
-	span.Finish(tracer.WithError(err))
+	span := c.startSpan("Decrement", key)
+	if err = c.context.Err(); err == nil {
+		newValue, err = c.Client.Decrement(key, delta)
+	}
+	c.finishSpan(span, err)
 	return newValue, err
 }
 
 // Delete invokes and traces Client.Delete.
 func (c *Client) Delete(key string) error {
-	span := c.startSpan("Delete")
-	err := c.Client.Delete(key)
-	span.Finish(tracer.WithError(err))
+	span := c.startSpan("Delete", key)
+	err := c.context.Err()
+	if err == nil {
+		err = c.Client.Delete(key)
+	}
+	c.finishSpan(span, err)
 	return err
 }
 
 // DeleteAll invokes and traces Client.DeleteAll.
 func (c *Client) DeleteAll() error {
-	span := c.startSpan("DeleteAll")
-	err := c.Client.DeleteAll()
-	span.Finish(tracer.WithError(err))
+	span := c.startSpan("DeleteAll", "")
+	err := c.context.Err()
+	if err == nil {
+		err = c.Client.DeleteAll()
+	}
+	c.finishSpan(span, err)
 	return err
 }
 
 // FlushAll invokes and traces Client.FlushAll.
 func (c *Client) FlushAll() error {
-	span := c.startSpan("FlushAll")
-	err := c.Client.FlushAll()
-	span.Finish(tracer.WithError(err))
+	span := c.startSpan("FlushAll", "")
+	err := c.context.Err()
+	if err == nil {
+		err = c.Client.FlushAll()
+	}
+	c.finishSpan(span, err)
 	return err
 }
 
 // Get invokes and traces Client.Get.
 func (c *Client) Get(key string) (item *memcache.Item, err error) {
-	span := c.startSpan("Get")
-	item, err = c.Client.Get(key)
-	span.Finish(tracer.WithError(err))
+	span := c.startSpan("Get", key)
+	if err = c.context.Err(); err == nil {
+		item, err = c.Client.Get(key)
+	}
+	if c.cfg.responseSize && item != nil {
+		span.SetTag(metricResponseBytes, len(item.Value))
+	}
+	c.finishSpan(span, err)
 	return item, err
 }
 
 // GetMulti invokes and traces Client.GetMulti.
-func (c *Client) GetMulti(keys []string) (map[string]*memcache.Item, error) {
-	span := c.startSpan("GetMulti")
-	items, err := c.Client.GetMulti(keys)
-	span.Finish(tracer.WithError(err))
+func (c *Client) GetMulti(keys []string) (items map[string]*memcache.Item, err error) {
+	span := c.startSpan("GetMulti", "")
+	if err = c.context.Err(); err == nil {
+		items, err = c.Client.GetMulti(keys)
+	}
+	if c.cfg.responseSize && err == nil {
+		var n int
+		for _, item := range items {
+			n += len(item.Value)
+		}
+		span.SetTag(metricResponseBytes, n)
+	}
+	c.finishSpan(span, err)
 	return items, err
 }
 
 // Increment invokes and traces Client.Increment.
 func (c *Client) Increment(key string, delta uint64) (newValue uint64, err error) {
-	span := c.startSpan("Increment")
-	newValue, err = c.Client.Increment(key, delta)
-	span.Finish(tracer.WithError(err))
+	span := c.startSpan("Increment", key)
+	if err = c.context.Err(); err == nil {
+		newValue, err = c.Client.Increment(key, delta)
+	}
+	c.finishSpan(span, err)
 	return newValue, err
 }
 
+// Ping invokes and traces Client.Ping.
+func (c *Client) Ping() error {
+	span := c.startSpan("Ping", "")
+	err := c.context.Err()
+	if err == nil {
+		err = c.Client.Ping()
+	}
+	c.finishSpan(span, err)
+	return err
+}
+
 // Replace invokes and traces Client.Replace.
 func (c *Client) Replace(item *memcache.Item) error {
-	span := c.startSpan("Replace")
-	err := c.Client.Replace(item)
-	span.Finish(tracer.WithError(err))
+	span := c.startSpan("Replace", item.Key)
+	err := c.context.Err()
+	if err == nil {
+		err = c.Client.Replace(item)
+	}
+	c.finishSpan(span, err)
 	return err
 }
 
 // Set invokes and traces Client.Set.
 func (c *Client) Set(item *memcache.Item) error {
-	span := c.startSpan("Set")
-	err := c.Client.Set(item)
-	span.Finish(tracer.WithError(err))
+	span := c.startSpan("Set", item.Key)
+	err := c.context.Err()
+	if err == nil {
+		err = c.Client.Set(item)
+	}
+	c.finishSpan(span, err)
 	return err
 }
 
 // Touch invokes and traces Client.Touch.
 func (c *Client) Touch(key string, seconds int32) error {
-	span := c.startSpan("Touch")
-	err := c.Client.Touch(key, seconds)
-	span.Finish(tracer.WithError(err))
+	span := c.startSpan("Touch", key)
+	err := c.context.Err()
+	if err == nil {
+		err = c.Client.Touch(key, seconds)
+	}
+	c.finishSpan(span, err)
 	return err
 }
@@ -76,6 +76,30 @@ func testMemcache(t *testing.T, addr string) {
 		validateMemcacheSpan(t, spans[0], "Add")
 	})
 
+	t.Run("touch", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		err := client.Touch("key1", 60)
+		assert.NoError(t, err)
+
+		spans := mt.FinishedSpans()
+		assert.Len(t, spans, 1)
+		validateMemcacheSpan(t, spans[0], "Touch")
+	})
+
+	t.Run("ping", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		err := client.Ping()
+		assert.NoError(t, err)
+
+		spans := mt.FinishedSpans()
+		assert.Len(t, spans, 1)
+		validateMemcacheSpan(t, spans[0], "Ping")
+	})
+
 	t.Run("context", func(t *testing.T) {
 		mt := mocktracer.Start()
 		defer mt.Stop()
@@ -102,6 +126,255 @@ func testMemcache(t *testing.T, addr string) {
 	})
 }
 
+func TestContextDone(t *testing.T) {
+	li := makeFakeServer(t)
+	defer li.Close()
+	client := getClient(li.Addr().String())
+
+	t.Run("deadline", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+		_, err := client.WithContext(ctx).Get("key")
+		assert.Equal(t, context.DeadlineExceeded, err)
+
+		spans := mt.FinishedSpans()
+		require.Len(t, spans, 1)
+		assert.Equal(t, "Get", spans[0].Tag(ext.ResourceName))
+		assert.Equal(t, true, spans[0].Tag(tagTimeout))
+		assert.Equal(t, context.DeadlineExceeded, spans[0].Tag(ext.Error))
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := client.WithContext(ctx).Add(&memcache.Item{Key: "key", Value: []byte("value")})
+		assert.Equal(t, context.Canceled, err)
+
+		spans := mt.FinishedSpans()
+		require.Len(t, spans, 1)
+		assert.Nil(t, spans[0].Tag(tagTimeout))
+		assert.Equal(t, context.Canceled, spans[0].Tag(ext.Error))
+	})
+
+	t.Run("in-flight", func(t *testing.T) {
+		// the operation times out with the client's timeout, after the
+		// deadline of the context
+		client := WrapClient(memcache.New(li.Addr().String()))
+		client.Timeout = 200 * time.Millisecond
+
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err := client.WithContext(ctx).Get("slow")
+		assert.Error(t, err)
+
+		spans := mt.FinishedSpans()
+		require.Len(t, spans, 1)
+		assert.Equal(t, true, spans[0].Tag(tagTimeout))
+	})
+}
+
+func TestWithContextAsync(t *testing.T) {
+	li := makeFakeServer(t)
+	defer li.Close()
+	client := getClient(li.Addr().String())
+
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	root := tracer.StartSpan("parent")
+	mc := client.WithContext(tracer.ContextWithSpan(context.Background(), root))
+	root.Finish()
+	// the operation is sent after the request finished
+	done := make(chan error)
+	go func() {
+		done <- mc.Add(&memcache.Item{Key: "key", Value: []byte("value")})
+	}()
+	require.NoError(t, <-done)
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "parent", spans[0].OperationName())
+	assert.Equal(t, "Add", spans[1].Tag(ext.ResourceName))
+	assert.Equal(t, root.Context().SpanID(), spans[1].ParentID())
+	assert.Equal(t, root.Context().TraceID(), spans[1].TraceID())
+}
+
+func TestWithServerSelector(t *testing.T) {
+	li1, li2 := makeFakeServer(t), makeFakeServer(t)
+	defer li1.Close()
+	defer li2.Close()
+
+	var ss memcache.ServerList
+	require.NoError(t, ss.SetServers(li1.Addr().String(), li2.Addr().String()))
+	client := WrapClient(memcache.NewFromSelector(&ss), WithServerSelector(&ss))
+	client.Timeout = 2 * time.Second
+
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	for _, key := range []string{"key1", "key2", "key3", "key4"} {
+		err := client.Add(&memcache.Item{Key: key, Value: []byte("value")})
+		require.NoError(t, err)
+	}
+	require.NoError(t, client.Ping())
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 5)
+	for i, key := range []string{"key1", "key2", "key3", "key4"} {
+		addr, err := ss.PickServer(key)
+		require.NoError(t, err)
+		host, port, err := net.SplitHostPort(addr.String())
+		require.NoError(t, err)
+		assert.Equal(t, host, spans[i].Tag(ext.TargetHost))
+		assert.Equal(t, port, spans[i].Tag(ext.TargetPort))
+	}
+	assert.Nil(t, spans[4].Tag(ext.TargetHost))
+}
+
+func TestWithErrorCheck(t *testing.T) {
+	li := makeFakeServer(t)
+	defer li.Close()
+
+	t.Run("default", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		_, err := getClient(li.Addr().String()).Get("key")
+		assert.Equal(t, memcache.ErrCacheMiss, err)
+
+		spans := mt.FinishedSpans()
+		require.Len(t, spans, 1)
+		assert.Equal(t, memcache.ErrCacheMiss, spans[0].Tag(ext.Error))
+	})
+
+	t.Run("ignored", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		client := getClient(li.Addr().String(), WithErrorCheck(tracer.IgnoreErrors(memcache.ErrCacheMiss)))
+		_, err := client.Get("key")
+		assert.Equal(t, memcache.ErrCacheMiss, err, "the error is still returned")
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = client.WithContext(ctx).Get("key")
+		assert.Equal(t, context.Canceled, err)
+
+		spans := mt.FinishedSpans()
+		require.Len(t, spans, 2)
+		assert.Nil(t, spans[0].Tag(ext.Error))
+		assert.Equal(t, context.Canceled, spans[1].Tag(ext.Error))
+	})
+}
+
+func TestCASConflict(t *testing.T) {
+	li := makeFakeServer(t)
+	defer li.Close()
+	item := &memcache.Item{Key: "key", Value: []byte("value")}
+
+	t.Run("default", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		err := getClient(li.Addr().String()).CompareAndSwap(item)
+		assert.Equal(t, memcache.ErrCASConflict, err)
+
+		spans := mt.FinishedSpans()
+		require.Len(t, spans, 1)
+		assert.Equal(t, "CompareAndSwap", spans[0].Tag(ext.ResourceName))
+		assert.Equal(t, true, spans[0].Tag(tagCASConflict))
+		assert.Equal(t, memcache.ErrCASConflict, spans[0].Tag(ext.Error))
+	})
+
+	t.Run("ignored", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		client := getClient(li.Addr().String(), WithErrorCheck(tracer.IgnoreErrors(memcache.ErrCASConflict)))
+		err := client.CompareAndSwap(item)
+		assert.Equal(t, memcache.ErrCASConflict, err)
+
+		spans := mt.FinishedSpans()
+		require.Len(t, spans, 1)
+		assert.Equal(t, true, spans[0].Tag(tagCASConflict))
+		assert.Nil(t, spans[0].Tag(ext.Error))
+	})
+}
+
+func TestWithResponseSize(t *testing.T) {
+	li := makeFakeServer(t)
+	defer li.Close()
+
+	t.Run("default", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		_, err := getClient(li.Addr().String()).Get("hit")
+		require.NoError(t, err)
+
+		spans := mt.FinishedSpans()
+		require.Len(t, spans, 1)
+		assert.NotContains(t, spans[0].Tags(), metricResponseBytes)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		client := getClient(li.Addr().String(), WithResponseSize())
+		item, err := client.Get("hit")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("hit"), item.Value)
+		_, err = client.Get("miss")
+		assert.Equal(t, memcache.ErrCacheMiss, err)
+		items, err := client.GetMulti([]string{"hit1", "miss", "hit22"})
+		require.NoError(t, err)
+		assert.Len(t, items, 2)
+
+		spans := mt.FinishedSpans()
+		require.Len(t, spans, 3)
+		assert.Equal(t, 3, spans[0].Tag(metricResponseBytes))
+		assert.NotContains(t, spans[1].Tags(), metricResponseBytes)
+		assert.Equal(t, "GetMulti", spans[2].Tag(ext.ResourceName))
+		assert.Equal(t, 9, spans[2].Tag(metricResponseBytes))
+	})
+}
+
+func TestWithResourceNamer(t *testing.T) {
+	li := makeFakeServer(t)
+	defer li.Close()
+
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	client := getClient(li.Addr().String(), WithResourceNamer(func(command, key string) string {
+		if i := strings.IndexByte(key, ':'); i >= 0 {
+			return command + ":" + key[:i+1] + "*"
+		}
+		return ""
+	}))
+	_, err := client.Get("hit:user:123")
+	require.NoError(t, err)
+	_, err = client.Get("hit")
+	require.NoError(t, err)
+	_, err = client.GetMulti([]string{"hit:1", "hit:2"})
+	require.NoError(t, err)
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 3)
+	assert.Equal(t, "Get:hit:*", spans[0].Tag(ext.ResourceName))
+	assert.Equal(t, "Get", spans[1].Tag(ext.ResourceName))
+	assert.Equal(t, "GetMulti", spans[2].Tag(ext.ResourceName))
+}
+
 func TestFakeServer(t *testing.T) {
 	li := makeFakeServer(t)
 	defer li.Close()
@@ -248,6 +521,30 @@ func makeFakeServer(t *testing.T) net.Listener {
 							return
 						}
 						fmt.Fprintf(c, "STORED\r\n")
+					case "cas":
+						if !s.Scan() {
+							return
+						}
+						// the items are always modified concurrently
+						fmt.Fprintf(c, "EXISTS\r\n")
+					case "gets":
+						// no item is ever stored, but the keys prefixed
+						// with "hit" are found with their key as value,
+						// and the ones prefixed with "slow" are slow to
+						// be looked up
+						for _, key := range args[1:] {
+							if strings.HasPrefix(key, "slow") {
+								time.Sleep(time.Second)
+							}
+							if strings.HasPrefix(key, "hit") {
+								fmt.Fprintf(c, "VALUE %s 0 %d 1\r\n%s\r\n", key, len(key), key)
+							}
+						}
+						fmt.Fprintf(c, "END\r\n")
+					case "touch":
+						fmt.Fprintf(c, "TOUCHED\r\n")
+					case "version":
+						fmt.Fprintf(c, "VERSION 1.6.0\r\n")
 					default:
 						fmt.Fprintf(c, "SERVER ERROR unknown command: %v \r\n", args[0])
 						return
@@ -8,8 +8,11 @@ package memcache
 import (
 	"math"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/namingschema"
+
+	"github.com/bradfitz/gomemcache/memcache"
 )
 
 const (
@@ -20,6 +23,10 @@ type clientConfig struct {
 	serviceName   string
 	operationName string
 	analyticsRate float64
+	selector      memcache.ServerSelector
+	errCheck      tracer.ErrorChecker
+	responseSize  bool
+	resourceNamer func(command, key string) string
 }
 
 // ClientOption represents an option that can be passed to Dial.
@@ -69,3 +76,47 @@ func WithAnalyticsRate(rate float64) ClientOption {
 		}
 	}
 }
+
+// WithServerSelector sets the ServerSelector used by the wrapped client, e.g.
+// the memcache.ServerList given to memcache.NewFromSelector. It is used to tag
+// the spans of single key operations with the address of the server that the
+// key maps to, which helps finding a faulty node in a pool of servers.
+func WithServerSelector(ss memcache.ServerSelector) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.selector = ss
+	}
+}
+
+// WithErrorCheck specifies a function fn which determines whether the passed
+// error should be marked as an error. The fn is called whenever an operation
+// finishes with an error. A typical use-case is ignoring cache misses using
+// tracer.IgnoreErrors(memcache.ErrCacheMiss). Similarly, compare-and-swap
+// conflicts, which are always tagged with memcached.cas.conflict, can be told
+// apart from real failures by ignoring memcache.ErrCASConflict. See
+// tracer.ErrorChecker.
+func WithErrorCheck(fn tracer.ErrorChecker) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.errCheck = fn
+	}
+}
+
+// WithResponseSize enables setting the size in bytes of the values returned by
+// Get and GetMulti as the memcached.response.bytes metric of their spans. For
+// GetMulti, it is the total size of the values of all the returned items.
+func WithResponseSize() ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.responseSize = true
+	}
+}
+
+// WithResourceNamer specifies a function fn which returns the resource name of
+// the span created for the given command (e.g. "Get") and key, allowing to
+// choose between grouping the spans by command only, which is the default, or
+// by command and key prefix, e.g. "Get:user:*". The key is empty for the
+// commands which aren't bound to a single key, like GetMulti. If fn returns an
+// empty string, the command is used as the resource name.
+func WithResourceNamer(fn func(command, key string) string) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.resourceNamer = fn
+	}
+}
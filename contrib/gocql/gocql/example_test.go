@@ -11,6 +11,8 @@ import (
 	gocqltrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/gocql/gocql"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/gocql/gocql"
 )
 
 func Example() {
@@ -34,3 +36,32 @@ func Example() {
 	// Execute your query as usual
 	query.Exec()
 }
+
+func ExampleWrapSession() {
+	// Trace all the queries and batches of an existing session.
+	s, _ := gocql.NewCluster("127.0.0.1").CreateSession()
+	session := gocqltrace.WrapSession(s, gocqltrace.WithServiceName("ServiceName"))
+
+	_, ctx := tracer.StartSpanFromContext(context.Background(), "parent.request")
+	session.Query("SELECT * FROM trace.person").WithContext(ctx).Exec()
+
+	b := session.Session.NewBatch(gocql.UnloggedBatch).WithContext(ctx)
+	b.Query("INSERT INTO trace.person (name, age) VALUES (?, ?)", "Kate", 80)
+	session.ExecuteBatch(b)
+}
+
+func ExampleNewTracingObserver() {
+	// Trace all the queries, batches and connection attempts of an unwrapped
+	// gocql cluster.
+	obs := gocqltrace.NewTracingObserver(gocqltrace.WithServiceName("ServiceName"))
+	cluster := gocql.NewCluster("127.0.0.1")
+	cluster.QueryObserver = obs
+	cluster.BatchObserver = obs
+	cluster.ConnectObserver = obs
+	session, _ := cluster.CreateSession()
+
+	_, ctx := tracer.StartSpanFromContext(context.Background(), "parent.request")
+
+	// The context is used to find the parent span.
+	session.Query("SELECT * FROM trace.person").WithContext(ctx).Exec()
+}
@@ -12,6 +12,8 @@ import (
 	"math"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
@@ -24,6 +26,37 @@ import (
 
 const componentName = "gocql/gocql"
 
+// keyDBMTraceInjected is the tag set on spans whose trace context was injected
+// in the query statement.
+const keyDBMTraceInjected = "_dd.dbm_trace_injected"
+
+// tagProtocolVersion is the tag holding the CQL protocol version of the
+// cluster. It is only set when the version is configured with the ProtoVersion
+// field of the ClusterConfig, as gocql doesn't expose the negotiated one.
+const tagProtocolVersion = "cassandra.protocol_version"
+
+const (
+	// tagDatacenter is the tag holding the datacenter of the coordinator
+	// node. It has the same value as ext.CassandraCluster, which is kept for
+	// compatibility.
+	tagDatacenter = "cassandra.datacenter"
+	// tagRack is the tag holding the rack of the coordinator node.
+	tagRack = "cassandra.rack"
+)
+
+const (
+	// tagSpeculative is the tag set by the TracingObserver on the spans of
+	// the attempts which aren't the first one of their query, i.e. its
+	// speculative executions and retries, which gocql numbers alike. Their
+	// coordinator node isn't the first one tried, so they can be filtered out
+	// of per-host latency baselines.
+	tagSpeculative = "cassandra.speculative"
+	// tagAttempt is the tag holding the index of the attempt observed by the
+	// TracingObserver. Non-zero attempts are retries or speculative
+	// executions of the query.
+	tagAttempt = "cassandra.attempt"
+)
+
 func init() {
 	telemetry.LoadIntegration(componentName)
 }
@@ -49,6 +82,9 @@ type Session struct {
 	*gocql.Session
 	hosts []string
 	opts  []WrapOption
+	// protoVersion is the CQL protocol version configured for the cluster,
+	// zero when it is negotiated.
+	protoVersion int
 }
 
 // CreateSession calls the underlying gocql.ClusterConfig's CreateSession method and returns a new Session augmented with tracing.
@@ -58,12 +94,33 @@ func (c *ClusterConfig) CreateSession() (*Session, error) {
 		return nil, err
 	}
 	return &Session{
-		Session: s,
-		hosts:   c.hosts,
-		opts:    c.opts,
+		Session:      s,
+		hosts:        c.hosts,
+		opts:         c.opts,
+		protoVersion: c.ProtoVersion,
 	}, nil
 }
 
+// WrapSession wraps an existing gocql.Session, such that the queries and batches
+// it creates with Query, QueryContext and NewBatch are traced without wrapping
+// them one by one, as well as the batches executed with its ExecuteBatch
+// method. Unlike the sessions created with ClusterConfig.CreateSession, the
+// spans aren't tagged with the contact points and protocol version of the
+// cluster, which aren't known.
+func WrapSession(s *gocql.Session, opts ...WrapOption) *Session {
+	return &Session{
+		Session: s,
+		opts:    opts,
+	}
+}
+
+// ExecuteBatch calls the underlying gocql.Session's ExecuteBatch method, tracing
+// the execution of the given batch, which may be created with the underlying
+// session's NewBatch method.
+func (s *Session) ExecuteBatch(b *gocql.Batch) error {
+	return wrapBatch(b, s.hosts, s.protoVersion, s.opts...).ExecuteBatch(s.Session)
+}
+
 // Query inherits from gocql.Query, it keeps the tracer and the context.
 type Query struct {
 	*gocql.Query
@@ -74,7 +131,46 @@ type Query struct {
 // Query calls the underlying gocql.Session's Query method and returns a new Query augmented with tracing.
 func (s *Session) Query(stmt string, values ...interface{}) *Query {
 	q := s.Session.Query(stmt, values...)
-	return wrapQuery(q, s.hosts, s.opts...)
+	return wrapQuery(q, s.hosts, s.protoVersion, s.opts...)
+}
+
+// QueryContext calls the underlying gocql.Session's Query method with the given
+// context and returns a new Query augmented with tracing. When the session was
+// configured with WithSQLCommentInjection or WithSQLCommentTraceInjection, the
+// service names and, with the latter, the trace context are injected in the
+// statement as a comment.
+func (s *Session) QueryContext(ctx context.Context, stmt string, values ...interface{}) *Query {
+	tq := s.Query(stmt, values...).WithContext(ctx)
+	mode := tq.params.config.commentInjection
+	if mode == tracer.DBMPropagationModeUndefined || mode == tracer.DBMPropagationModeDisabled {
+		return tq
+	}
+	if mode == tracer.DBMPropagationModeFull && tq.params.config.shouldSkip(tq.statement()) {
+		// No span is created for the query, so its id isn't injected.
+		mode = tracer.DBMPropagationModeService
+	}
+	carrier := tracer.SQLCommentCarrier{
+		Query:         stmt,
+		Mode:          mode,
+		DBServiceName: tq.params.config.serviceName,
+	}
+	var spanCtx ddtrace.SpanContext
+	if span, ok := tracer.SpanFromContext(ctx); ok {
+		spanCtx = span.Context()
+	}
+	if err := carrier.Inject(spanCtx); err != nil {
+		log.Debug("contrib/gocql/gocql: failed to inject query comments: %v", err)
+		return tq
+	}
+	// The statement was already extracted by the wrapper, so the resource name
+	// and the tags are computed from the statement without the comment.
+	tq.statement()
+	tq.Query.Release()
+	tq.Query = s.Session.Query(carrier.Query, values...).WithContext(ctx)
+	if mode == tracer.DBMPropagationModeFull {
+		tq.params.injectedSpanID = carrier.SpanID
+	}
+	return tq
 }
 
 // Batch inherits from gocql.Batch, it keeps the tracer and the context.
@@ -87,7 +183,7 @@ type Batch struct {
 // NewBatch calls the underlying gocql.Session's NewBatch method and returns a new Batch augmented with tracing.
 func (s *Session) NewBatch(typ gocql.BatchType) *Batch {
 	b := s.Session.NewBatch(typ)
-	return wrapBatch(b, s.hosts, s.opts...)
+	return wrapBatch(b, s.hosts, s.protoVersion, s.opts...)
 }
 
 // params contains fields and metadata useful for command tracing
@@ -96,6 +192,14 @@ type params struct {
 	keyspace             string
 	paginated            bool
 	clusterContactPoints string
+	// protoVersion is the CQL protocol version configured for the cluster,
+	// zero when it is unknown.
+	protoVersion int
+	statement    string
+	// injectedSpanID is the span id injected as a comment in the statement,
+	// used by the first span created for the query, which is never sampled
+	// out.
+	injectedSpanID uint64
 }
 
 // WrapQuery wraps a gocql.Query into a traced Query under the given service name.
@@ -110,20 +214,19 @@ type params struct {
 //
 // Deprecated: initialize your ClusterConfig with NewCluster instead.
 func WrapQuery(q *gocql.Query, opts ...WrapOption) *Query {
-	return wrapQuery(q, nil, opts...)
+	return wrapQuery(q, nil, 0, opts...)
 }
 
-func wrapQuery(q *gocql.Query, hosts []string, opts ...WrapOption) *Query {
+func wrapQuery(q *gocql.Query, hosts []string, protoVersion int, opts ...WrapOption) *Query {
 	cfg := defaultConfig()
 	for _, fn := range opts {
 		fn(cfg)
 	}
+	p := &params{config: cfg, protoVersion: protoVersion}
 	if cfg.resourceName == "" {
-		if parts := strings.SplitN(q.String(), "\"", 3); len(parts) == 3 {
-			cfg.resourceName = parts[1]
-		}
+		p.statement = queryStatement(q)
+		cfg.resourceName = cfg.normalize(p.statement)
 	}
-	p := &params{config: cfg}
 	if len(hosts) > 0 {
 		p.clusterContactPoints = strings.Join(hosts, ",")
 	}
@@ -132,6 +235,52 @@ func wrapQuery(q *gocql.Query, hosts []string, opts ...WrapOption) *Query {
 	return tq
 }
 
+// maxStatementLen is the maximum number of bytes of the statements of the
+// queries which are used as resource names.
+const maxStatementLen = 4096
+
+// queryStatement returns the statement of the query q, truncated to its first
+// maxStatementLen bytes, which bounds the cost of normalizing it.
+func queryStatement(q *gocql.Query) string {
+	s := q.Statement()
+	if len(s) > maxStatementLen {
+		s = s[:maxStatementLen]
+	}
+	return s
+}
+
+// isPrepared reports whether gocql executes stmt as a prepared statement. gocql
+// prepares all DML statements, reusing its cache of prepared statements across
+// executions, but doesn't expose that decision, so it is mirrored here.
+func isPrepared(stmt string) bool {
+	stmt = strings.TrimLeftFunc(strings.TrimRightFunc(stmt, func(r rune) bool {
+		return unicode.IsSpace(r) || r == ';'
+	}), unicode.IsSpace)
+	var typ string
+	if n := strings.IndexFunc(stmt, unicode.IsSpace); n >= 0 {
+		typ = strings.ToLower(stmt[:n])
+	}
+	if typ == "begin" {
+		if n := strings.LastIndexFunc(stmt, unicode.IsSpace); n >= 0 {
+			typ = strings.ToLower(stmt[n+1:])
+		}
+	}
+	switch typ {
+	case "select", "insert", "update", "delete", "batch":
+		return true
+	}
+	return false
+}
+
+// statement returns the statement of the traced query, extracting it only
+// when it's needed.
+func (tq *Query) statement() string {
+	if tq.params.statement == "" {
+		tq.params.statement = queryStatement(tq.Query)
+	}
+	return tq.params.statement
+}
+
 // WithContext adds the specified context to the traced Query structure.
 func (tq *Query) WithContext(ctx context.Context) *Query {
 	tq.ctx = ctx
@@ -154,9 +303,33 @@ func (tq *Query) PageState(state []byte) *Query {
 	return tq
 }
 
-// NewChildSpan creates a new span from the params and the context.
-func (tq *Query) newChildSpan(ctx context.Context) ddtrace.Span {
+// startSpan starts the span of the query, unless it's sampled out, in which
+// case the time at which the query started is returned so that a span can
+// still be created if it fails (see WithSpanSampleRate). The span whose id was
+// injected in the statement is never sampled out.
+func (tq *Query) startSpan() (ddtrace.Span, time.Time) {
+	if tq.params.injectedSpanID == 0 && tq.params.config.sampledOut() {
+		return nil, time.Now()
+	}
+	return tq.newChildSpan(tq.ctx), time.Time{}
+}
+
+// errorSpan returns the span of a query which was sampled out when it started
+// at start, if it failed with err. It returns nil otherwise.
+func (tq *Query) errorSpan(start time.Time, err error) ddtrace.Span {
+	if start.IsZero() || err == nil || tq.params.config.shouldIgnoreError(err) {
+		return nil
+	}
+	return tq.newChildSpan(tq.ctx, tracer.StartTime(start))
+}
+
+// NewChildSpan creates a new span from the params and the context. It returns
+// nil if the query shouldn't be traced.
+func (tq *Query) newChildSpan(ctx context.Context, extra ...ddtrace.StartSpanOption) ddtrace.Span {
 	p := tq.params
+	if p.config.filter != nil && p.config.shouldSkip(tq.statement()) {
+		return nil
+	}
 	opts := []ddtrace.StartSpanOption{
 		tracer.SpanType(ext.SpanTypeCassandra),
 		tracer.ServiceName(p.config.serviceName),
@@ -173,11 +346,41 @@ func (tq *Query) newChildSpan(ctx context.Context) ddtrace.Span {
 	if tq.clusterContactPoints != "" {
 		opts = append(opts, tracer.Tag(ext.CassandraContactPoints, tq.clusterContactPoints))
 	}
-	span, _ := tracer.StartSpanFromContext(ctx, p.config.querySpanName, opts...)
+	if p.protoVersion != 0 {
+		opts = append(opts, tracer.Tag(tagProtocolVersion, strconv.Itoa(p.protoVersion)))
+	}
+	if p.statement != "" {
+		// The statement isn't extracted solely for this tag, it is only
+		// known when the resource name isn't set (see WithResourceName).
+		opts = append(opts, tracer.Tag(ext.CassandraPrepared, fmt.Sprintf("%t", isPrepared(p.statement))))
+	}
+	for k, v := range p.config.customTags {
+		opts = append(opts, tracer.Tag(k, v))
+	}
+	if p.injectedSpanID != 0 {
+		opts = append(opts, tracer.WithSpanID(p.injectedSpanID), tracer.Tag(keyDBMTraceInjected, true))
+		p.injectedSpanID = 0
+	}
+	spanName := p.config.querySpanName
+	if p.config.operationNamer != nil {
+		if name := p.config.operationNamer(tq.statement()); name != "" {
+			spanName = name
+		}
+	}
+	opts = append(opts, extra...)
+	span, _ := tracer.StartSpanFromContext(ctx, spanName, opts...)
 	return span
 }
 
-func (tq *Query) finishSpan(span ddtrace.Span, err error) {
+// finishSpan finishes the span of the query, or the one created for it if it
+// was sampled out when it started at start and failed.
+func (tq *Query) finishSpan(span ddtrace.Span, start time.Time, err error) {
+	tq.reportRequest(err)
+	if span == nil {
+		if span = tq.errorSpan(start, err); span == nil {
+			return
+		}
+	}
 	if err != nil && tq.params.config.shouldIgnoreError(err) {
 		err = nil
 	}
@@ -188,6 +391,15 @@ func (tq *Query) finishSpan(span ddtrace.Span, err error) {
 	}
 }
 
+// reportRequest sends the metrics of the query, which finished with err (see
+// WithStatsdClient).
+func (tq *Query) reportRequest(err error) {
+	if tq.params.config.statsd == nil {
+		return
+	}
+	tq.params.config.reportRequest(tq.Keyspace(), tq.GetConsistency().String(), err)
+}
+
 // Exec is rewritten so that it passes by our custom Iter
 func (tq *Query) Exec() error {
 	return tq.Iter().Close()
@@ -195,25 +407,25 @@ func (tq *Query) Exec() error {
 
 // MapScan wraps in a span query.MapScan call.
 func (tq *Query) MapScan(m map[string]interface{}) error {
-	span := tq.newChildSpan(tq.ctx)
+	span, start := tq.startSpan()
 	err := tq.Query.MapScan(m)
-	tq.finishSpan(span, err)
+	tq.finishSpan(span, start, err)
 	return err
 }
 
 // Scan wraps in a span query.Scan call.
 func (tq *Query) Scan(dest ...interface{}) error {
-	span := tq.newChildSpan(tq.ctx)
+	span, start := tq.startSpan()
 	err := tq.Query.Scan(dest...)
-	tq.finishSpan(span, err)
+	tq.finishSpan(span, start, err)
 	return err
 }
 
 // ScanCAS wraps in a span query.ScanCAS call.
 func (tq *Query) ScanCAS(dest ...interface{}) (applied bool, err error) {
-	span := tq.newChildSpan(tq.ctx)
+	span, start := tq.startSpan()
 	applied, err = tq.Query.ScanCAS(dest...)
-	tq.finishSpan(span, err)
+	tq.finishSpan(span, start, err)
 	return applied, err
 }
 
@@ -221,12 +433,20 @@ func (tq *Query) ScanCAS(dest ...interface{}) (applied bool, err error) {
 type Iter struct {
 	*gocql.Iter
 	span ddtrace.Span
+
+	// query is the query which created the Iter. With start, it allows
+	// creating the span of a query which was sampled out if it fails.
+	query *Query
+	start time.Time
 }
 
 // Iter starts a new span at query.Iter call.
 func (tq *Query) Iter() *Iter {
-	span := tq.newChildSpan(tq.ctx)
+	span, start := tq.startSpan()
 	iter := tq.Query.Iter()
+	if span == nil {
+		return &Iter{Iter: iter, query: tq, start: start}
+	}
 	span.SetTag(ext.CassandraRowCount, strconv.Itoa(iter.NumRows()))
 	span.SetTag(ext.CassandraConsistencyLevel, tq.GetConsistency().String())
 
@@ -234,11 +454,13 @@ func (tq *Query) Iter() *Iter {
 	if len(columns) > 0 {
 		span.SetTag(ext.CassandraKeyspace, columns[0].Keyspace)
 	}
-	tIter := &Iter{iter, span}
+	tIter := &Iter{Iter: iter, span: span, query: tq}
 	if tIter.Host() != nil {
 		tIter.span.SetTag(ext.TargetHost, tIter.Iter.Host().HostID())
 		tIter.span.SetTag(ext.TargetPort, strconv.Itoa(tIter.Iter.Host().Port()))
 		tIter.span.SetTag(ext.CassandraCluster, tIter.Iter.Host().DataCenter())
+		tIter.span.SetTag(tagDatacenter, tIter.Iter.Host().DataCenter())
+		tIter.span.SetTag(tagRack, tIter.Iter.Host().Rack())
 	}
 	return tIter
 }
@@ -246,17 +468,123 @@ func (tq *Query) Iter() *Iter {
 // Close closes the Iter and finish the span created on Iter call.
 func (tIter *Iter) Close() error {
 	err := tIter.Iter.Close()
-	if err != nil {
-		tIter.span.SetTag(ext.Error, err)
-	}
-	tIter.span.Finish()
+	tIter.query.finishSpan(tIter.span, tIter.start, err)
 	return err
 }
 
 // Scanner inherits from a gocql.Scanner derived from an Iter
 type Scanner struct {
 	gocql.Scanner
-	span ddtrace.Span
+	span  ddtrace.Span
+	query *Query
+	start time.Time
+
+	// cfg and ctx are set for the scanners created with WrapScanner, which
+	// start their span on the first call to Next, and finish it once the
+	// rows are exhausted or when Err is called.
+	cfg     *queryConfig
+	ctx     context.Context
+	started bool
+	done    bool
+	err     error // the error returned by the wrapped Scanner.Err, once done
+}
+
+// WrapScanner wraps a gocql.Scanner obtained directly from a gocql.Iter into a
+// traced Scanner, allowing to trace row-streaming code paths which don't use
+// this package's Query. The span is started on the first call to Next, and
+// finished once the rows are exhausted or when Err is called. As the scanner
+// doesn't expose its query, the resource name defaults to the operation name
+// unless it's set with WithResourceName.
+func WrapScanner(s gocql.Scanner, opts ...WrapOption) *Scanner {
+	cfg := defaultConfig()
+	for _, fn := range opts {
+		fn(cfg)
+	}
+	log.Debug("contrib/gocql/gocql: Wrapping Scanner: %#v", cfg)
+	return &Scanner{Scanner: s, cfg: cfg, ctx: context.Background()}
+}
+
+// WithContext sets the context which the span of a Scanner created with
+// WrapScanner is started from. It must be called before Next.
+func (s *Scanner) WithContext(ctx context.Context) *Scanner {
+	s.ctx = ctx
+	return s
+}
+
+// Next calls the wrapped Scanner.Next. For the scanners created with
+// WrapScanner, the first call starts the span, which is finished once the rows
+// are exhausted.
+func (s *Scanner) Next() bool {
+	if s.cfg == nil {
+		return s.Scanner.Next()
+	}
+	if s.done {
+		return false
+	}
+	if !s.started {
+		s.started = true
+		if s.cfg.sampledOut() {
+			s.start = time.Now()
+		} else {
+			s.span = s.newSpan()
+		}
+	}
+	if s.Scanner.Next() {
+		return true
+	}
+	s.finish()
+	return false
+}
+
+// newSpan starts the span of a Scanner created with WrapScanner.
+func (s *Scanner) newSpan(extra ...ddtrace.StartSpanOption) ddtrace.Span {
+	opts := []ddtrace.StartSpanOption{
+		tracer.SpanType(ext.SpanTypeCassandra),
+		tracer.ServiceName(s.cfg.serviceName),
+		tracer.Tag(ext.Component, componentName),
+		tracer.Tag(ext.SpanKind, ext.SpanKindClient),
+		tracer.Tag(ext.DBSystem, ext.DBSystemCassandra),
+	}
+	if s.cfg.resourceName != "" {
+		opts = append(opts, tracer.ResourceName(s.cfg.resourceName))
+	}
+	if !math.IsNaN(s.cfg.analyticsRate) {
+		opts = append(opts, tracer.Tag(ext.EventSampleRate, s.cfg.analyticsRate))
+	}
+	for k, v := range s.cfg.customTags {
+		opts = append(opts, tracer.Tag(k, v))
+	}
+	opts = append(opts, extra...)
+	span, _ := tracer.StartSpanFromContext(s.ctx, s.cfg.querySpanName, opts...)
+	return span
+}
+
+// finish calls the wrapped Scanner.Err, releasing the Scanner resources, and
+// finishes the span of a Scanner created with WrapScanner. It returns the
+// error of the wrapped Scanner.Err, which is only called once.
+func (s *Scanner) finish() error {
+	if s.done {
+		return s.err
+	}
+	s.done = true
+	s.err = s.Scanner.Err()
+	s.cfg.reportRequest("", "", s.err)
+	err := s.err
+	if err != nil && s.cfg.shouldIgnoreError(err) {
+		err = nil
+	}
+	if s.span == nil {
+		if s.start.IsZero() || err == nil {
+			return s.err
+		}
+		s.span = s.newSpan(tracer.StartTime(s.start))
+	}
+	if s.cfg.noDebugStack {
+		s.span.Finish(tracer.WithError(err), tracer.NoDebugStack())
+	} else {
+		s.span.Finish(tracer.WithError(err))
+	}
+	return s.err
 }
 
 // Scanner returns a row Scanner which provides an interface to scan rows in a
@@ -266,16 +594,18 @@ func (tIter *Iter) Scanner() gocql.Scanner {
 	return &Scanner{
 		Scanner: tIter.Iter.Scanner(),
 		span:    tIter.span,
+		query:   tIter.query,
+		start:   tIter.start,
 	}
 }
 
 // Err calls the wrapped Scanner.Err, releasing the Scanner resources and closing the span.
 func (s *Scanner) Err() error {
-	err := s.Scanner.Err()
-	if err != nil {
-		s.span.SetTag(ext.Error, err)
+	if s.cfg != nil {
+		return s.finish()
 	}
-	s.span.Finish()
+	err := s.Scanner.Err()
+	s.query.finishSpan(s.span, s.start, err)
 	return err
 }
 
@@ -291,15 +621,15 @@ func (s *Scanner) Err() error {
 //
 // Deprecated: initialize your ClusterConfig with NewCluster instead.
 func WrapBatch(b *gocql.Batch, opts ...WrapOption) *Batch {
-	return wrapBatch(b, nil, opts...)
+	return wrapBatch(b, nil, 0, opts...)
 }
 
-func wrapBatch(b *gocql.Batch, hosts []string, opts ...WrapOption) *Batch {
+func wrapBatch(b *gocql.Batch, hosts []string, protoVersion int, opts ...WrapOption) *Batch {
 	cfg := defaultConfig()
 	for _, fn := range opts {
 		fn(cfg)
 	}
-	p := &params{config: cfg}
+	p := &params{config: cfg, protoVersion: protoVersion}
 	if len(hosts) > 0 {
 		p.clusterContactPoints = strings.Join(hosts, ",")
 	}
@@ -334,15 +664,35 @@ func (tb *Batch) WithTimestamp(timestamp int64) *Batch {
 
 // ExecuteBatch calls session.ExecuteBatch on the Batch, tracing the execution.
 func (tb *Batch) ExecuteBatch(session *gocql.Session) error {
-	span := tb.newChildSpan(tb.ctx)
+	span, start := tb.startSpan()
 	err := session.ExecuteBatch(tb.Batch)
-	tb.finishSpan(span, err)
+	tb.finishSpan(span, start, err)
 	return err
 }
 
-// newChildSpan creates a new span from the params and the context.
-func (tb *Batch) newChildSpan(ctx context.Context) ddtrace.Span {
+// startSpan starts the span of the batch, unless it's sampled out, in which
+// case the time at which the batch started is returned so that a span can
+// still be created if it fails (see WithSpanSampleRate).
+func (tb *Batch) startSpan() (ddtrace.Span, time.Time) {
+	if tb.params.config.sampledOut() {
+		return nil, time.Now()
+	}
+	return tb.newChildSpan(tb.ctx), time.Time{}
+}
+
+// newChildSpan creates a new span from the params and the context. It returns
+// nil if the batch shouldn't be traced.
+func (tb *Batch) newChildSpan(ctx context.Context, extra ...ddtrace.StartSpanOption) ddtrace.Span {
 	p := tb.params
+	if p.config.filter != nil {
+		stmts := make([]string, len(tb.Entries))
+		for i, e := range tb.Entries {
+			stmts[i] = e.Stmt
+		}
+		if p.config.shouldSkip(stmts...) {
+			return nil
+		}
+	}
 	opts := []ddtrace.StartSpanOption{
 		tracer.SpanType(ext.SpanTypeCassandra),
 		tracer.ServiceName(p.config.serviceName),
@@ -359,11 +709,29 @@ func (tb *Batch) newChildSpan(ctx context.Context) ddtrace.Span {
 	if tb.clusterContactPoints != "" {
 		opts = append(opts, tracer.Tag(ext.CassandraContactPoints, tb.clusterContactPoints))
 	}
+	if p.protoVersion != 0 {
+		opts = append(opts, tracer.Tag(tagProtocolVersion, strconv.Itoa(p.protoVersion)))
+	}
+	for k, v := range p.config.customTags {
+		opts = append(opts, tracer.Tag(k, v))
+	}
+	opts = append(opts, extra...)
 	span, _ := tracer.StartSpanFromContext(ctx, p.config.batchSpanName, opts...)
 	return span
 }
 
-func (tb *Batch) finishSpan(span ddtrace.Span, err error) {
+// finishSpan finishes the span of the batch, or the one created for it if it
+// was sampled out when it started at start and failed.
+func (tb *Batch) finishSpan(span ddtrace.Span, start time.Time, err error) {
+	tb.params.config.reportRequest(tb.Keyspace(), tb.GetConsistency().String(), err)
+	if span == nil {
+		if start.IsZero() || err == nil || tb.params.config.shouldIgnoreError(err) {
+			return
+		}
+		if span = tb.newChildSpan(tb.ctx, tracer.StartTime(start)); span == nil {
+			return
+		}
+	}
 	if err != nil && tb.params.config.shouldIgnoreError(err) {
 		err = nil
 	}
@@ -11,6 +11,8 @@ import (
 	"log"
 	"math"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -20,6 +22,7 @@ import (
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/globalconfig"
 
+	"github.com/DataDog/datadog-go/v5/statsd"
 	"github.com/gocql/gocql"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -30,13 +33,23 @@ const (
 	cassandraHost = "127.0.0.1:9042"
 )
 
-func newCassandraCluster() *gocql.ClusterConfig {
+// skipIntegrationTest skips the tests which need a Cassandra cluster, unless
+// the INTEGRATION environment variable is set.
+func skipIntegrationTest(t *testing.T) {
+	if _, ok := os.LookupEnv("INTEGRATION"); !ok {
+		t.Skip("to enable integration test, set the INTEGRATION environment variable")
+	}
+}
+
+func newCassandraCluster(t *testing.T) *gocql.ClusterConfig {
+	skipIntegrationTest(t)
 	cfg := gocql.NewCluster(cassandraHost)
 	updateTestClusterConfig(cfg)
 	return cfg
 }
 
-func newTracedCassandraCluster(opts ...WrapOption) *ClusterConfig {
+func newTracedCassandraCluster(t *testing.T, opts ...WrapOption) *ClusterConfig {
+	skipIntegrationTest(t)
 	cfg := NewCluster([]string{cassandraHost}, opts...)
 	updateTestClusterConfig(cfg.ClusterConfig)
 	return cfg
@@ -55,14 +68,14 @@ func updateTestClusterConfig(cfg *gocql.ClusterConfig) {
 	cfg.Timeout = 2 * time.Second
 }
 
-// TestMain sets up the Keyspace and table if they do not exist
+// TestMain sets up the Keyspace and table if they do not exist, when the
+// integration tests are enabled.
 func TestMain(m *testing.M) {
-	_, ok := os.LookupEnv("INTEGRATION")
-	if !ok {
-		fmt.Println("--- SKIP: to enable integration test, set the INTEGRATION environment variable")
-		os.Exit(0)
+	if _, ok := os.LookupEnv("INTEGRATION"); !ok {
+		os.Exit(m.Run())
 	}
-	cluster := newCassandraCluster()
+	cluster := gocql.NewCluster(cassandraHost)
+	updateTestClusterConfig(cluster)
 	session, err := cluster.CreateSession()
 	if err != nil {
 		log.Fatalf("%v\n", err)
@@ -80,7 +93,7 @@ func TestErrorWrapper(t *testing.T) {
 	mt := mocktracer.Start()
 	defer mt.Stop()
 
-	cluster := newCassandraCluster()
+	cluster := newCassandraCluster(t)
 	session, err := cluster.CreateSession()
 	assert.Nil(err)
 	q := session.Query("CREATE KEYSPACE trace WITH REPLICATION = { 'class' : 'NetworkTopologyStrategy', 'datacenter1' : 1 };")
@@ -106,6 +119,8 @@ func TestErrorWrapper(t *testing.T) {
 		assert.Equal(span.Tag(ext.TargetPort), "9042")
 		assert.Equal(span.Tag(ext.TargetHost), iter.Host().HostID())
 		assert.Equal(span.Tag(ext.CassandraCluster), "datacenter1")
+		assert.Equal("datacenter1", span.Tag(tagDatacenter))
+		assert.Equal(iter.Host().Rack(), span.Tag(tagRack))
 	}
 }
 
@@ -116,7 +131,7 @@ func TestChildWrapperSpan(t *testing.T) {
 
 	// Parent span
 	parentSpan, ctx := tracer.StartSpanFromContext(context.Background(), "parentSpan")
-	cluster := newCassandraCluster()
+	cluster := newCassandraCluster(t)
 	session, err := cluster.CreateSession()
 	assert.Nil(err)
 
@@ -147,12 +162,15 @@ func TestChildWrapperSpan(t *testing.T) {
 	assert.Equal(childSpan.Tag(ext.Component), "gocql/gocql")
 	assert.Equal(childSpan.Tag(ext.SpanKind), ext.SpanKindClient)
 	assert.Equal(childSpan.Tag(ext.DBSystem), "cassandra")
+	assert.Equal(childSpan.Tag(ext.CassandraPrepared), "true")
 	assert.NotContains(childSpan.Tags(), ext.CassandraContactPoints)
 
 	if iter.Host() != nil {
 		assert.Equal(childSpan.Tag(ext.TargetPort), "9042")
 		assert.Equal(childSpan.Tag(ext.TargetHost), iter.Host().HostID())
 		assert.Equal(childSpan.Tag(ext.CassandraCluster), "datacenter1")
+		assert.Equal("datacenter1", childSpan.Tag(tagDatacenter))
+		assert.Equal(iter.Host().Rack(), childSpan.Tag(tagRack))
 	}
 }
 
@@ -161,7 +179,7 @@ func TestErrNotFound(t *testing.T) {
 	mt := mocktracer.Start()
 	defer mt.Stop()
 
-	cluster := newCassandraCluster()
+	cluster := newCassandraCluster(t)
 	session, err := cluster.CreateSession()
 	assert.Nil(err)
 
@@ -184,7 +202,7 @@ func TestErrNotFound(t *testing.T) {
 
 		span := spans[0]
 		assert.Equal(span.OperationName(), "cassandra.query")
-		assert.Equal(span.Tag(ext.ResourceName), "SELECT name, age FROM trace.person WHERE name = 'This does not exist'")
+		assert.Equal(span.Tag(ext.ResourceName), "SELECT name, age FROM trace.person WHERE name = ?")
 		assert.NotNil(span.Tag(ext.Error), "trace is marked as an error, default behavior")
 	})
 
@@ -206,14 +224,38 @@ func TestErrNotFound(t *testing.T) {
 
 		span := spans[1]
 		assert.Equal(span.OperationName(), "cassandra.query")
-		assert.Equal(span.Tag(ext.ResourceName), "SELECT name, age FROM trace.person WHERE name = 'This does not exist'")
+		assert.Equal(span.Tag(ext.ResourceName), "SELECT name, age FROM trace.person WHERE name = ?")
 		assert.Nil(span.Tag(ext.Error), "trace is not marked as an error, it just has no data")
 	})
 }
 
+func TestIterErrorCheck(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	cluster := newTracedCassandraCluster(t, WithErrorCheck(func(err error) bool {
+		return false
+	}))
+	session, err := cluster.CreateSession()
+	require.NoError(t, err)
+	defer session.Close()
+
+	err = session.Query("SELECT * FROM trace.nonexistent").Iter().Close()
+	assert.Error(err)
+	sc := session.Query("SELECT * FROM trace.nonexistent").Iter().Scanner()
+	assert.Error(sc.Err())
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 2)
+	for _, span := range spans {
+		assert.Nil(span.Tag(ext.Error))
+	}
+}
+
 func TestAnalyticsSettings(t *testing.T) {
 	assertRate := func(t *testing.T, mt mocktracer.Tracer, rate float64, opts ...WrapOption) {
-		cluster := newCassandraCluster()
+		cluster := newCassandraCluster(t)
 		session, err := cluster.CreateSession()
 		assert.Nil(t, err)
 
@@ -293,7 +335,7 @@ func TestIterScanner(t *testing.T) {
 
 	// Parent span
 	parentSpan, ctx := tracer.StartSpanFromContext(context.Background(), "parentSpan")
-	cluster := newCassandraCluster()
+	cluster := newCassandraCluster(t)
 	session, err := cluster.CreateSession()
 	assert.NoError(err)
 
@@ -339,7 +381,7 @@ func TestBatch(t *testing.T) {
 
 	// Parent span
 	parentSpan, ctx := tracer.StartSpanFromContext(context.Background(), "parentSpan")
-	cluster := newCassandraCluster()
+	cluster := newCassandraCluster(t)
 	cluster.Keyspace = "trace"
 	session, err := cluster.CreateSession()
 	assert.NoError(err)
@@ -378,13 +420,52 @@ func TestBatch(t *testing.T) {
 	assert.NotContains(childSpan.Tags(), ext.CassandraContactPoints)
 }
 
+func TestWrapSession(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	cluster := newCassandraCluster(t)
+	cluster.Keyspace = "trace"
+	s, err := cluster.CreateSession()
+	require.NoError(t, err)
+	defer s.Close()
+	session := WrapSession(s, WithServiceName("test-cassandra"))
+
+	parent, ctx := tracer.StartSpanFromContext(context.Background(), "parent")
+	err = session.Query("SELECT * FROM trace.person").WithContext(ctx).Exec()
+	assert.NoError(err)
+
+	stmt := "INSERT INTO trace.person (name, age, description) VALUES (?, ?, ?)"
+	b := s.NewBatch(gocql.UnloggedBatch).WithContext(ctx)
+	b.Query(stmt, "Kate", 80, "Cassandra's sister running in kubernetes")
+	err = session.ExecuteBatch(b)
+	assert.NoError(err)
+	parent.Finish()
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 3)
+	query, batch := spans[0], spans[1]
+	assert.Equal("cassandra.query", query.OperationName())
+	assert.Equal("SELECT * FROM trace.person", query.Tag(ext.ResourceName))
+	assert.Equal("cassandra.batch", batch.OperationName())
+	for _, span := range []mocktracer.Span{query, batch} {
+		assert.Equal(parent.Context().SpanID(), span.ParentID())
+		assert.Equal("test-cassandra", span.Tag(ext.ServiceName))
+		assert.Equal("trace", span.Tag(ext.CassandraKeyspace))
+		assert.NotContains(span.Tags(), ext.CassandraContactPoints)
+	}
+}
+
 func TestCassandraContactPoints(t *testing.T) {
 	assert := assert.New(t)
 	mt := mocktracer.Start()
 	defer mt.Stop()
 
+	skipIntegrationTest(t)
 	cluster := NewCluster([]string{cassandraHost, "127.0.0.1:9043"})
 	updateTestClusterConfig(cluster.ClusterConfig)
+	cluster.ProtoVersion = 4
 
 	session, err := cluster.CreateSession()
 	require.NoError(t, err)
@@ -398,6 +479,8 @@ func TestCassandraContactPoints(t *testing.T) {
 
 	assert.Equal(span.OperationName(), "cassandra.query")
 	assert.Equal(span.Tag(ext.CassandraContactPoints), "127.0.0.1:9042,127.0.0.1:9043")
+	assert.Equal(span.Tag(ext.CassandraPrepared), "false")
+	assert.Equal("4", span.Tag(tagProtocolVersion))
 
 	mt.Reset()
 
@@ -414,6 +497,7 @@ func TestCassandraContactPoints(t *testing.T) {
 
 	assert.Equal(span.OperationName(), "cassandra.batch")
 	assert.Equal(span.Tag(ext.CassandraContactPoints), "127.0.0.1:9042,127.0.0.1:9043")
+	assert.Equal("4", span.Tag(tagProtocolVersion))
 }
 
 func TestWithWrapOptions(t *testing.T) {
@@ -421,7 +505,7 @@ func TestWithWrapOptions(t *testing.T) {
 	mt := mocktracer.Start()
 	defer mt.Stop()
 
-	cluster := newTracedCassandraCluster(WithServiceName("test-service"), WithResourceName("cluster-resource"))
+	cluster := newTracedCassandraCluster(t, WithServiceName("test-service"), WithResourceName("cluster-resource"))
 
 	session, err := cluster.CreateSession()
 	require.NoError(t, err)
@@ -438,6 +522,7 @@ func TestWithWrapOptions(t *testing.T) {
 	assert.Equal(span.Tag(ext.CassandraContactPoints), "127.0.0.1:9042")
 	assert.Equal(span.Tag(ext.ServiceName), "test-service")
 	assert.Equal(span.Tag(ext.ResourceName), "test-resource")
+	assert.NotContains(span.Tags(), ext.CassandraPrepared)
 
 	mt.Reset()
 
@@ -461,6 +546,362 @@ func TestWithWrapOptions(t *testing.T) {
 	assert.Equal(span.Tag(ext.ResourceName), "test-resource")
 }
 
+func TestWithCustomTag(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	cluster := newTracedCassandraCluster(t,
+		WithCustomTag("tenant", "acme"),
+		WithCustomTag("env", "test"),
+		WithCustomTag(ext.DBSystem, "scylla"),
+	)
+	session, err := cluster.CreateSession()
+	require.NoError(t, err)
+
+	err = session.Query("SELECT * FROM trace.person").Iter().Close()
+	require.NoError(t, err)
+
+	tb := session.NewBatch(gocql.UnloggedBatch)
+	stmt := "INSERT INTO trace.person (name, age, description) VALUES (?, ?, ?)"
+	tb.Query(stmt, "Kate", 80, "Cassandra's sister running in kubernetes")
+	err = tb.ExecuteBatch(session.Session)
+	require.NoError(t, err)
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 2)
+	for _, span := range spans {
+		assert.Equal("acme", span.Tag("tenant"))
+		assert.Equal("test", span.Tag("env"))
+		assert.Equal("scylla", span.Tag(ext.DBSystem))
+	}
+}
+
+func TestWithOperationNamer(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	cluster := newTracedCassandraCluster(t, WithOperationNamer(func(stmt string) string {
+		if strings.HasPrefix(strings.ToUpper(stmt), "SELECT") {
+			return ""
+		}
+		return "cassandra.write"
+	}))
+	session, err := cluster.CreateSession()
+	require.NoError(t, err)
+
+	err = session.Query("SELECT * FROM trace.person").Iter().Close()
+	require.NoError(t, err)
+	err = session.Query("INSERT INTO trace.person (name, age, description) VALUES (?, ?, ?)", "Kate", 80, "Cassandra's sister").Exec()
+	require.NoError(t, err)
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 2)
+	assert.Equal("cassandra.query", spans[0].OperationName())
+	assert.Equal("cassandra.write", spans[1].OperationName())
+}
+
+func TestWithStatementNormalizer(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	cluster := newTracedCassandraCluster(t, WithStatementNormalizer(func(stmt string) string {
+		return strings.ReplaceAll(stmt, "'Kate'", "?")
+	}))
+	session, err := cluster.CreateSession()
+	require.NoError(t, err)
+
+	err = session.Query("SELECT * FROM trace.person WHERE name = 'Kate'").Iter().Close()
+	require.NoError(t, err)
+	err = session.Query("SELECT * FROM trace.person WHERE name = 'Kate'").WithWrapOptions(WithResourceName("custom")).Iter().Close()
+	require.NoError(t, err)
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 2)
+	assert.Equal("SELECT * FROM trace.person WHERE name = ?", spans[0].Tag(ext.ResourceName))
+	assert.Equal("custom", spans[1].Tag(ext.ResourceName))
+}
+
+func TestWrapScanner(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	cluster := newCassandraCluster(t)
+	session, err := cluster.CreateSession()
+	require.NoError(t, err)
+	defer session.Close()
+
+	root, ctx := tracer.StartSpanFromContext(context.Background(), "parent")
+	sc := WrapScanner(session.Query("SELECT name FROM trace.person").Iter().Scanner(), WithResourceName("scan-persons")).WithContext(ctx)
+	var n int
+	for sc.Next() {
+		var name string
+		require.NoError(t, sc.Scan(&name))
+		n++
+	}
+	assert.NotZero(n)
+	require.Len(t, mt.FinishedSpans(), 1, "the span is finished once the rows are exhausted")
+	assert.NoError(sc.Err())
+	assert.NoError(sc.Err())
+	root.Finish()
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 2)
+	span := spans[0]
+	assert.Equal("cassandra.query", span.OperationName())
+	assert.Equal("scan-persons", span.Tag(ext.ResourceName))
+	assert.Equal(ext.SpanTypeCassandra, span.Tag(ext.SpanType))
+	assert.Equal(componentName, span.Tag(ext.Component))
+	assert.Equal(root.Context().SpanID(), span.ParentID())
+
+	mt.Reset()
+	sc = WrapScanner(session.Query("SELECT * FROM trace.nonexistent").Iter().Scanner())
+	assert.False(sc.Next())
+	assert.Error(sc.Err())
+	spans = mt.FinishedSpans()
+	require.Len(t, spans, 1)
+	assert.NotNil(spans[0].Tag(ext.Error))
+}
+
+func TestWithResourceObfuscation(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	cluster := newCassandraCluster(t)
+	session, err := cluster.CreateSession()
+	require.NoError(t, err)
+	defer session.Close()
+
+	stmt := "SELECT * FROM trace.person WHERE name = 'Kate' AND age = 80 ALLOW FILTERING"
+	err = WrapQuery(session.Query(stmt)).Iter().Close()
+	require.NoError(t, err)
+	err = WrapQuery(session.Query(stmt), WithResourceObfuscation(false)).Iter().Close()
+	require.NoError(t, err)
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 2)
+	assert.Equal("SELECT * FROM trace.person WHERE name = ? AND age = ? ALLOW FILTERING", spans[0].Tag(ext.ResourceName))
+	assert.Equal(stmt, spans[1].Tag(ext.ResourceName))
+}
+
+func TestQueryStatement(t *testing.T) {
+	// queries can be created without connecting to a cluster
+	session := new(gocql.Session)
+
+	stmt := "SELECT * FROM trace.person WHERE name IN ('" + strings.Repeat("a", 2*maxStatementLen) + "')"
+	got := queryStatement(session.Query(stmt, "value"))
+	assert.True(t, strings.HasPrefix(stmt, got))
+	assert.Len(t, got, maxStatementLen)
+	assert.Equal(t, "SELECT * FROM trace.person", queryStatement(session.Query("SELECT * FROM trace.person")))
+	assert.Equal(t, `SELECT "Name" FROM trace.person WHERE age = ?`, queryStatement(session.Query(`SELECT "Name" FROM trace.person WHERE age = ?`, 42)))
+}
+
+func TestIsPrepared(t *testing.T) {
+	for stmt, prepared := range map[string]bool{
+		"SELECT * FROM trace.person":                               true,
+		"  insert INTO trace.person (name) VALUES (?);":            true,
+		"UPDATE trace.person SET age = 1 WHERE name = 'a'":         true,
+		"DELETE FROM trace.person WHERE name = 'a'":                true,
+		"BEGIN BATCH INSERT INTO t (a) VALUES (1) APPLY BATCH ;\n": true,
+		"BEGIN UNLOGGED BATCH INSERT INTO t (a) VALUES (1) APPLY":  false,
+		"CREATE TABLE t (a int PRIMARY KEY)":                       false,
+		"USE trace":                                                false,
+		"select":                                                   false,
+		"":                                                         false,
+	} {
+		assert.Equal(t, prepared, isPrepared(stmt), stmt)
+	}
+}
+
+func TestWithFilter(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	cluster := newTracedCassandraCluster(t, WithFilter(func(stmt string) bool {
+		return strings.Contains(stmt, "system.")
+	}))
+	session, err := cluster.CreateSession()
+	require.NoError(t, err)
+
+	err = session.Query("SELECT * FROM system.local").Iter().Close()
+	require.NoError(t, err)
+	var name string
+	err = session.Query("SELECT name FROM system.local").Scan(&name)
+	require.NoError(t, err)
+	assert.Empty(mt.FinishedSpans())
+
+	err = session.Query("SELECT * FROM trace.person").Iter().Close()
+	require.NoError(t, err)
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 1)
+	assert.Equal("SELECT * FROM trace.person", spans[0].Tag(ext.ResourceName))
+
+	mt.Reset()
+
+	tb := session.NewBatch(gocql.UnloggedBatch)
+	stmt := "INSERT INTO trace.person (name, age, description) VALUES (?, ?, ?)"
+	tb.Query(stmt, "Kate", 80, "Cassandra's sister running in kubernetes")
+	err = tb.ExecuteBatch(session.Session)
+	require.NoError(t, err)
+	assert.Len(mt.FinishedSpans(), 1)
+}
+
+func TestWithSpanSampleRate(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	cluster := newTracedCassandraCluster(t, WithSpanSampleRate(0))
+	session, err := cluster.CreateSession()
+	require.NoError(t, err)
+
+	err = session.Query("SELECT * FROM trace.person").Iter().Close()
+	require.NoError(t, err)
+	tb := session.NewBatch(gocql.UnloggedBatch)
+	stmt := "INSERT INTO trace.person (name, age, description) VALUES (?, ?, ?)"
+	tb.Query(stmt, "Kate", 80, "Cassandra's sister running in kubernetes")
+	err = tb.ExecuteBatch(session.Session)
+	require.NoError(t, err)
+	assert.Empty(mt.FinishedSpans())
+
+	// failed queries are always traced
+	start := time.Now()
+	var name string
+	err = session.Query("SELECT name FROM trace.person WHERE name = 'This does not exist'").Scan(&name)
+	assert.Equal(gocql.ErrNotFound, err)
+	err = session.Query("SELECT * FROM non_existing_table").Iter().Close()
+	assert.Error(err)
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 2)
+	for _, span := range spans {
+		assert.Equal("cassandra.query", span.OperationName())
+		assert.NotNil(span.Tag(ext.Error))
+		assert.False(span.StartTime().Before(start))
+	}
+
+	mt.Reset()
+	cluster = newTracedCassandraCluster(t,
+		WithSpanSampleRate(0),
+		WithErrorCheck(tracer.IgnoreErrors(gocql.ErrNotFound)),
+	)
+	session, err = cluster.CreateSession()
+	require.NoError(t, err)
+	err = session.Query("SELECT name FROM trace.person WHERE name = 'This does not exist'").Scan(&name)
+	assert.Equal(gocql.ErrNotFound, err)
+	assert.Empty(mt.FinishedSpans())
+}
+
+// recordingStatsd is a statsd client recording the calls to Incr.
+type recordingStatsd struct {
+	statsd.NoOpClient
+	mu     sync.Mutex
+	counts map[string][]string // tags of the calls by metric name
+}
+
+func (c *recordingStatsd) Incr(name string, tags []string, _ float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = make(map[string][]string)
+	}
+	c.counts[name] = append(c.counts[name], strings.Join(tags, ","))
+	return nil
+}
+
+func TestWithStatsdClient(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	client := new(recordingStatsd)
+	cluster := newTracedCassandraCluster(t, WithStatsdClient(client), WithSpanSampleRate(0))
+	cluster.Keyspace = "trace"
+	cluster.Consistency = gocql.One
+	session, err := cluster.CreateSession()
+	require.NoError(t, err)
+
+	err = session.Query("SELECT * FROM person").Iter().Close()
+	require.NoError(t, err)
+	var name string
+	err = session.Query("SELECT name FROM person WHERE name = 'This does not exist'").Scan(&name)
+	assert.Equal(gocql.ErrNotFound, err)
+	tb := session.NewBatch(gocql.UnloggedBatch)
+	tb.Query("INSERT INTO person (name, age, description) VALUES (?, ?, ?)", "Kate", 80, "Cassandra's sister running in kubernetes")
+	err = tb.ExecuteBatch(session.Session)
+	require.NoError(t, err)
+
+	// the metrics don't depend on the spans being created
+	assert.Len(mt.FinishedSpans(), 1)
+	tags := "keyspace:trace,consistency:ONE"
+	assert.Equal([]string{tags, tags, tags}, client.counts[metricQueryCount])
+	assert.Equal([]string{tags}, client.counts[metricQueryErrors])
+}
+
+func TestWithSQLCommentInjection(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	cluster := newTracedCassandraCluster(t, WithSQLCommentInjection())
+	session, err := cluster.CreateSession()
+	require.NoError(t, err)
+
+	root, ctx := tracer.StartSpanFromContext(context.Background(), "parent")
+	q1 := session.QueryContext(ctx, "SELECT * FROM trace.person")
+	q2 := session.QueryContext(ctx, "SELECT * FROM trace.person")
+	assert.Contains(q1.String(), "dddbs='gocql.query'")
+	assert.NotContains(q1.String(), "traceparent=")
+	assert.Equal(q1.String(), q2.String())
+	require.NoError(t, q1.Iter().Close())
+	root.Finish()
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 2)
+	assert.Nil(spans[0].Tag(keyDBMTraceInjected))
+}
+
+func TestWithSQLCommentTraceInjection(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	cluster := newTracedCassandraCluster(t, WithSQLCommentTraceInjection(), WithSpanSampleRate(0))
+	session, err := cluster.CreateSession()
+	require.NoError(t, err)
+
+	root, ctx := tracer.StartSpanFromContext(context.Background(), "parent")
+	q := session.QueryContext(ctx, "SELECT * FROM trace.person")
+	assert.Contains(q.String(), "traceparent=")
+	assert.Contains(q.String(), "*/ SELECT * FROM trace.person")
+	err = q.Iter().Close()
+	require.NoError(t, err)
+	root.Finish()
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 2)
+	span := spans[0]
+	assert.Equal("SELECT * FROM trace.person", span.Tag(ext.ResourceName))
+	assert.Equal(true, span.Tag(keyDBMTraceInjected))
+	assert.Equal(root.Context().SpanID(), span.ParentID())
+	assert.Contains(q.String(), fmt.Sprintf("-%016x-", span.SpanID()))
+
+	// The trace context isn't injected in the statements of filtered queries
+	session.Close()
+	cluster = newTracedCassandraCluster(t, WithSQLCommentTraceInjection(), WithFilter(func(string) bool { return true }))
+	session, err = cluster.CreateSession()
+	require.NoError(t, err)
+	defer session.Close()
+	q = session.QueryContext(context.Background(), "SELECT * FROM trace.person")
+	assert.Contains(q.String(), "dddbs='gocql.query'")
+	assert.NotContains(q.String(), "traceparent=")
+}
+
 func TestNamingSchema(t *testing.T) {
 	genSpans := namingschematest.GenSpansFn(func(t *testing.T, serviceOverride string) []mocktracer.Span {
 		var opts []WrapOption
@@ -470,7 +911,7 @@ func TestNamingSchema(t *testing.T) {
 		mt := mocktracer.Start()
 		defer mt.Stop()
 
-		cluster := newTracedCassandraCluster(opts...)
+		cluster := newTracedCassandraCluster(t, opts...)
 		session, err := cluster.CreateSession()
 		require.NoError(t, err)
 
@@ -0,0 +1,48 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package gocql
+
+import (
+	"github.com/DataDog/datadog-go/v5/statsd"
+)
+
+const (
+	// metricQueryCount is the count of CQL requests, queries and batches.
+	metricQueryCount = "cassandra.query.count"
+	// metricQueryErrors is the count of CQL requests which failed.
+	metricQueryErrors = "cassandra.query.errors"
+)
+
+// WithStatsdClient specifies a statsd client to which the count of queries and
+// batches, and the count of the ones which failed, are sent as the
+// cassandra.query.count and cassandra.query.errors metrics, tagged with their
+// keyspace and consistency. The metrics are sent for every request, regardless
+// of whether it's traced or its trace is kept, and errors ignored by the error
+// check (see WithErrorCheck) aren't counted as failures. When used with a
+// TracingObserver, the metrics are sent for every attempt and aren't tagged
+// with the consistency.
+func WithStatsdClient(client statsd.ClientInterface) WrapOption {
+	return func(cfg *queryConfig) {
+		cfg.statsd = client
+	}
+}
+
+// reportRequest sends the metrics of a query or batch run against keyspace
+// with the given consistency, which finished with err. An empty consistency
+// leaves the metrics untagged with it, as it isn't known to observers.
+func (c *queryConfig) reportRequest(keyspace, consistency string, err error) {
+	if c.statsd == nil {
+		return
+	}
+	tags := []string{"keyspace:" + keyspace}
+	if consistency != "" {
+		tags = append(tags, "consistency:"+consistency)
+	}
+	c.statsd.Incr(metricQueryCount, tags, 1)
+	if err != nil && !c.shouldIgnoreError(err) {
+		c.statsd.Incr(metricQueryErrors, tags, 1)
+	}
+}
@@ -0,0 +1,188 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package gocql
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+
+	"github.com/gocql/gocql"
+)
+
+// TracingObserver implements gocql.QueryObserver, gocql.BatchObserver and
+// gocql.ConnectObserver, creating spans from the observations reported by gocql.
+// It allows tracing queries and connection attempts at the cluster
+// configuration level, without wrapping queries.
+type TracingObserver struct {
+	cfg *queryConfig
+}
+
+var (
+	_ gocql.QueryObserver   = (*TracingObserver)(nil)
+	_ gocql.BatchObserver   = (*TracingObserver)(nil)
+	_ gocql.ConnectObserver = (*TracingObserver)(nil)
+)
+
+// connectSpanName is the operation name of the spans created for connection
+// attempts.
+const connectSpanName = "cassandra.connect"
+
+// NewTracingObserver returns a new TracingObserver configured with the given
+// options. It should be set as the QueryObserver, BatchObserver and
+// ConnectObserver of a gocql.ClusterConfig, e.g.:
+//
+//	obs := NewTracingObserver(WithServiceName("my-cassandra"))
+//	cluster := gocql.NewCluster("127.0.0.1:9042")
+//	cluster.QueryObserver = obs
+//	cluster.BatchObserver = obs
+//	cluster.ConnectObserver = obs
+//
+// Note that gocql calls the observers once per attempt and per page, so a span
+// is created for each of them. The spans of the queries are tagged with the
+// index of their attempt, which is non-zero for retries and speculative
+// executions, which are also tagged with cassandra.speculative. The queries should not be wrapped as well, as
+// they would be traced twice.
+func NewTracingObserver(opts ...WrapOption) *TracingObserver {
+	cfg := defaultConfig()
+	for _, fn := range opts {
+		fn(cfg)
+	}
+	log.Debug("contrib/gocql/gocql: Configuring TracingObserver: %#v", cfg)
+	return &TracingObserver{cfg: cfg}
+}
+
+// ObserveQuery implements gocql.QueryObserver.
+func (o *TracingObserver) ObserveQuery(ctx context.Context, q gocql.ObservedQuery) {
+	o.cfg.reportRequest(q.Keyspace, "", q.Err)
+	if o.cfg.shouldSkip(q.Statement) || o.sampledOut(q.Err) {
+		return
+	}
+	resource := o.cfg.resourceName
+	if resource == "" {
+		resource = o.cfg.normalize(q.Statement)
+	}
+	opts := o.startSpanOptions(q.Start, resource, q.Keyspace, q.Host)
+	opts = append(opts,
+		tracer.Tag(ext.CassandraRowCount, strconv.Itoa(q.Rows)),
+		tracer.Tag(ext.CassandraPrepared, strconv.FormatBool(isPrepared(q.Statement))),
+		tracer.Tag(tagAttempt, strconv.Itoa(q.Attempt)),
+	)
+	if q.Attempt > 0 {
+		opts = append(opts, tracer.Tag(tagSpeculative, true))
+	}
+	spanName := o.cfg.querySpanName
+	if o.cfg.operationNamer != nil {
+		if name := o.cfg.operationNamer(q.Statement); name != "" {
+			spanName = name
+		}
+	}
+	span, _ := tracer.StartSpanFromContext(ctx, spanName, opts...)
+	o.finishSpan(span, q.End, q.Err)
+}
+
+// ObserveBatch implements gocql.BatchObserver.
+func (o *TracingObserver) ObserveBatch(ctx context.Context, b gocql.ObservedBatch) {
+	o.cfg.reportRequest(b.Keyspace, "", b.Err)
+	if o.cfg.shouldSkip(b.Statements...) || o.sampledOut(b.Err) {
+		return
+	}
+	opts := o.startSpanOptions(b.Start, o.cfg.resourceName, b.Keyspace, b.Host)
+	span, _ := tracer.StartSpanFromContext(ctx, o.cfg.batchSpanName, opts...)
+	o.finishSpan(span, b.End, b.Err)
+}
+
+// ObserveConnect implements gocql.ConnectObserver. A span is created for each
+// connection attempt, including the ones made to warm up the connection pools
+// and to reconnect to nodes which are down.
+func (o *TracingObserver) ObserveConnect(c gocql.ObservedConnect) {
+	opts := []ddtrace.StartSpanOption{
+		tracer.StartTime(c.Start),
+		tracer.SpanType(ext.SpanTypeCassandra),
+		tracer.ServiceName(o.cfg.serviceName),
+		tracer.Tag(ext.Component, componentName),
+		tracer.Tag(ext.SpanKind, ext.SpanKindClient),
+		tracer.Tag(ext.DBSystem, ext.DBSystemCassandra),
+	}
+	if c.Host != nil {
+		opts = append(opts,
+			tracer.ResourceName(c.Host.HostnameAndPort()),
+			tracer.Tag(ext.TargetHost, c.Host.ConnectAddress().String()),
+			tracer.Tag(ext.TargetPort, strconv.Itoa(c.Host.Port())),
+			tracer.Tag(ext.CassandraCluster, c.Host.DataCenter()),
+			tracer.Tag(tagDatacenter, c.Host.DataCenter()),
+			tracer.Tag(tagRack, c.Host.Rack()),
+		)
+	}
+	for k, v := range o.cfg.customTags {
+		opts = append(opts, tracer.Tag(k, v))
+	}
+	span := tracer.StartSpan(connectSpanName, opts...)
+	// Connection errors are always reported: the error check only applies to
+	// CQL requests.
+	finishOpts := []ddtrace.FinishOption{tracer.FinishTime(c.End), tracer.WithError(c.Err)}
+	if o.cfg.noDebugStack {
+		finishOpts = append(finishOpts, tracer.NoDebugStack())
+	}
+	span.Finish(finishOpts...)
+}
+
+// sampledOut reports whether no span should be created for a query or batch
+// which finished with err. Failed requests are always traced.
+func (o *TracingObserver) sampledOut(err error) bool {
+	if err != nil && !o.cfg.shouldIgnoreError(err) {
+		return false
+	}
+	return o.cfg.sampledOut()
+}
+
+func (o *TracingObserver) startSpanOptions(start time.Time, resource, keyspace string, host *gocql.HostInfo) []ddtrace.StartSpanOption {
+	opts := []ddtrace.StartSpanOption{
+		tracer.StartTime(start),
+		tracer.SpanType(ext.SpanTypeCassandra),
+		tracer.ServiceName(o.cfg.serviceName),
+		tracer.Tag(ext.CassandraKeyspace, keyspace),
+		tracer.Tag(ext.Component, componentName),
+		tracer.Tag(ext.SpanKind, ext.SpanKindClient),
+		tracer.Tag(ext.DBSystem, ext.DBSystemCassandra),
+	}
+	if resource != "" {
+		opts = append(opts, tracer.ResourceName(resource))
+	}
+	if !math.IsNaN(o.cfg.analyticsRate) {
+		opts = append(opts, tracer.Tag(ext.EventSampleRate, o.cfg.analyticsRate))
+	}
+	if host != nil {
+		opts = append(opts,
+			tracer.Tag(ext.TargetHost, host.HostID()),
+			tracer.Tag(ext.TargetPort, strconv.Itoa(host.Port())),
+			tracer.Tag(ext.CassandraCluster, host.DataCenter()),
+			tracer.Tag(tagDatacenter, host.DataCenter()),
+			tracer.Tag(tagRack, host.Rack()),
+		)
+	}
+	for k, v := range o.cfg.customTags {
+		opts = append(opts, tracer.Tag(k, v))
+	}
+	return opts
+}
+
+func (o *TracingObserver) finishSpan(span ddtrace.Span, end time.Time, err error) {
+	if err != nil && o.cfg.shouldIgnoreError(err) {
+		err = nil
+	}
+	opts := []ddtrace.FinishOption{tracer.FinishTime(end), tracer.WithError(err)}
+	if o.cfg.noDebugStack {
+		opts = append(opts, tracer.NoDebugStack())
+	}
+	span.Finish(opts...)
+}
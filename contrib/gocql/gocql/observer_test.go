@@ -0,0 +1,140 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package gocql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracingObserver(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	obs := NewTracingObserver(WithServiceName("test-cassandra"), WithCustomTag("tenant", "acme"))
+	skipIntegrationTest(t)
+	cluster := gocql.NewCluster(cassandraHost)
+	updateTestClusterConfig(cluster)
+	cluster.QueryObserver = obs
+	cluster.BatchObserver = obs
+	session, err := cluster.CreateSession()
+	require.NoError(t, err)
+	defer session.Close()
+
+	root, ctx := tracer.StartSpanFromContext(context.Background(), "parent")
+	err = session.Query("SELECT * FROM trace.person").WithContext(ctx).Exec()
+	require.NoError(t, err)
+
+	stmt := "INSERT INTO trace.person (name, age, description) VALUES (?, ?, ?)"
+	b := session.NewBatch(gocql.UnloggedBatch).WithContext(ctx)
+	b.Query(stmt, "Kate", 80, "Cassandra's sister running in kubernetes")
+	err = session.ExecuteBatch(b)
+	require.NoError(t, err)
+	root.Finish()
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 3)
+	query, batch := spans[0], spans[1]
+
+	assert.Equal("cassandra.query", query.OperationName())
+	assert.Equal("SELECT * FROM trace.person", query.Tag(ext.ResourceName))
+	assert.Equal("true", query.Tag(ext.CassandraPrepared))
+	assert.NotNil(query.Tag(ext.CassandraRowCount))
+	assert.Equal("0", query.Tag(tagAttempt))
+	assert.Nil(query.Tag(tagSpeculative))
+
+	assert.Equal("cassandra.batch", batch.OperationName())
+
+	for _, span := range []mocktracer.Span{query, batch} {
+		assert.Equal(root.Context().SpanID(), span.ParentID())
+		assert.Equal("test-cassandra", span.Tag(ext.ServiceName))
+		assert.Equal(ext.SpanTypeCassandra, span.Tag(ext.SpanType))
+		assert.NotEmpty(span.Tag(ext.TargetHost))
+		assert.Equal("9042", span.Tag(ext.TargetPort))
+		assert.Equal("acme", span.Tag("tenant"))
+		assert.Equal(componentName, span.Tag(ext.Component))
+		assert.Equal(ext.SpanKindClient, span.Tag(ext.SpanKind))
+		assert.Equal(ext.DBSystemCassandra, span.Tag(ext.DBSystem))
+		assert.False(span.FinishTime().Before(span.StartTime()))
+	}
+}
+
+func TestTracingObserverAttempts(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	obs := NewTracingObserver()
+	start := time.Now()
+	for attempt := 0; attempt < 2; attempt++ {
+		obs.ObserveQuery(context.Background(), gocql.ObservedQuery{
+			Keyspace:  "trace",
+			Statement: "SELECT * FROM trace.person",
+			Start:     start,
+			End:       start.Add(time.Millisecond),
+			Attempt:   attempt,
+		})
+	}
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 2)
+	assert.Equal("0", spans[0].Tag(tagAttempt))
+	assert.Nil(spans[0].Tag(tagSpeculative))
+	assert.Equal("1", spans[1].Tag(tagAttempt))
+	assert.Equal(true, spans[1].Tag(tagSpeculative))
+}
+
+func TestTracingObserverConnect(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	obs := NewTracingObserver(WithServiceName("test-cassandra"))
+	skipIntegrationTest(t)
+	cluster := gocql.NewCluster(cassandraHost)
+	updateTestClusterConfig(cluster)
+	cluster.NumConns = 1
+	cluster.ConnectObserver = obs
+	session, err := cluster.CreateSession()
+	require.NoError(t, err)
+	session.Close()
+
+	spans := mt.FinishedSpans()
+	require.NotEmpty(t, spans)
+	for _, span := range spans {
+		assert.Equal("cassandra.connect", span.OperationName())
+		assert.Equal("test-cassandra", span.Tag(ext.ServiceName))
+		assert.Equal("127.0.0.1", span.Tag(ext.TargetHost))
+		assert.Equal("9042", span.Tag(ext.TargetPort))
+		assert.NotNil(span.Tag(ext.CassandraCluster))
+		assert.Equal(span.Tag(ext.CassandraCluster), span.Tag(tagDatacenter))
+		assert.NotNil(span.Tag(tagRack))
+		assert.Nil(span.Tag(ext.Error))
+	}
+
+	mt.Reset()
+	cluster = gocql.NewCluster("127.0.0.1:9043")
+	updateTestClusterConfig(cluster)
+	cluster.ConnectObserver = obs
+	_, err = cluster.CreateSession()
+	require.Error(t, err)
+
+	spans = mt.FinishedSpans()
+	require.NotEmpty(t, spans)
+	assert.Equal("cassandra.connect", spans[0].OperationName())
+	assert.Equal("9043", spans[0].Tag(ext.TargetPort))
+	assert.NotNil(spans[0].Tag(ext.Error))
+}
@@ -7,9 +7,15 @@ package gocql
 
 import (
 	"math"
+	"math/rand"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/namingschema"
+
+	"github.com/DataDog/datadog-agent/pkg/obfuscate"
+	"github.com/DataDog/datadog-go/v5/statsd"
 )
 
 const defaultServiceName = "gocql.query"
@@ -19,7 +25,15 @@ type queryConfig struct {
 	querySpanName, batchSpanName string
 	noDebugStack                 bool
 	analyticsRate                float64
-	errCheck                     func(err error) bool
+	spanSampleRate               float64
+	errCheck                     tracer.ErrorChecker
+	filter                       func(statement string) bool
+	customTags                   map[string]interface{}
+	operationNamer               func(statement string) string
+	statementNormalizer          func(statement string) string
+	obfuscation                  bool
+	commentInjection             tracer.DBMPropagationMode
+	statsd                       statsd.ClientInterface
 }
 
 // WrapOption represents an option that can be passed to WrapQuery.
@@ -41,7 +55,8 @@ func defaultConfig() *queryConfig {
 	} else {
 		cfg.analyticsRate = math.NaN()
 	}
-	cfg.errCheck = func(error) bool { return true }
+	cfg.spanSampleRate = 1.0
+	cfg.obfuscation = true
 	return cfg
 }
 
@@ -53,11 +68,12 @@ func WithServiceName(name string) WrapOption {
 }
 
 // WithResourceName sets a custom resource name to be used with the traced query.
-// By default, the query statement is extracted automatically. This method should
-// be used when a different resource name is desired or in performance critical
-// environments. The gocql library returns the query statement using an fmt.Sprintf
-// call, which can be costly when called repeatedly. Using WithResourceName will
-// avoid that call. Under normal circumstances, it is safe to rely on the default.
+// By default, the query statement is used, once normalized (see
+// WithResourceObfuscation and WithStatementNormalizer). This method should be
+// used when a different resource name is desired or in performance critical
+// environments, as normalizing the statements can be costly when done
+// repeatedly. Using WithResourceName will avoid it. Under normal circumstances,
+// it is safe to rely on the default.
 func WithResourceName(name string) WrapOption {
 	return func(cfg *queryConfig) {
 		cfg.resourceName = name
@@ -87,6 +103,30 @@ func WithAnalyticsRate(rate float64) WrapOption {
 	}
 }
 
+// WithSpanSampleRate sets the rate, between 0 and 1, at which spans are created
+// for the queries and batches. Unlike WithAnalyticsRate, the queries which are
+// sampled out aren't traced at all, which saves the cost of creating their
+// spans. Failed queries are always traced though: when a query which was
+// sampled out fails, its span is created afterwards, starting at the time the
+// query was sent. Such spans lack the tags which are only known while the query
+// runs, like the row count and the host. Errors ignored by the error check (see
+// WithErrorCheck) don't count as failures. The default rate is 1.
+func WithSpanSampleRate(rate float64) WrapOption {
+	return func(cfg *queryConfig) {
+		if rate >= 0.0 && rate <= 1.0 {
+			cfg.spanSampleRate = rate
+		} else {
+			cfg.spanSampleRate = 1.0
+		}
+	}
+}
+
+// sampledOut reports whether the span of a query or batch should only be
+// created if it fails (see WithSpanSampleRate).
+func (c *queryConfig) sampledOut() bool {
+	return c.spanSampleRate < 1 && rand.Float64() >= c.spanSampleRate
+}
+
 // NoDebugStack prevents stack traces from being attached to spans finishing
 // with an error. This is useful in situations where errors are frequent and
 // performance is critical.
@@ -97,21 +137,138 @@ func NoDebugStack() WrapOption {
 }
 
 func (c *queryConfig) shouldIgnoreError(err error) bool {
-	return c != nil && c.errCheck != nil && !c.errCheck(err)
+	return c != nil && err != nil && !c.errCheck.Check(err)
+}
+
+// WithCustomTag will attach the value to the spans tagged by the key. It can be
+// used several times, and the custom tags take precedence over the built-in tags.
+func WithCustomTag(key string, value interface{}) WrapOption {
+	return func(cfg *queryConfig) {
+		if cfg.customTags == nil {
+			cfg.customTags = make(map[string]interface{})
+		}
+		cfg.customTags[key] = value
+	}
+}
+
+// WithOperationNamer specifies a function fn which returns the operation name
+// of the span created for the given query statement, e.g. to name reads and
+// writes differently. If fn returns an empty string, the default operation name
+// is used. It doesn't apply to batches.
+func WithOperationNamer(fn func(statement string) string) WrapOption {
+	return func(cfg *queryConfig) {
+		cfg.operationNamer = fn
+	}
+}
+
+// WithStatementNormalizer specifies a function fn which normalizes the query
+// statements before they are used as resource names, e.g. an obfuscator
+// replacing the literals with placeholders to bound the cardinality of the
+// resource names. It takes precedence over the built-in obfuscation (see
+// WithResourceObfuscation). It isn't used when a resource name is set with
+// WithResourceName, and the statements passed to the other functions, like the
+// filter and the operation namer, aren't normalized.
+func WithStatementNormalizer(fn func(statement string) string) WrapOption {
+	return func(cfg *queryConfig) {
+		cfg.statementNormalizer = fn
+	}
+}
+
+// WithResourceObfuscation enables or disables the obfuscation of the query
+// statements used as resource names, which replaces their string and number
+// literals and their bind markers with "?", the same way the Datadog Agent
+// obfuscates SQL queries. This prevents the literals from leaking in the
+// resource names and bounds their cardinality. It is enabled by default.
+func WithResourceObfuscation(on bool) WrapOption {
+	return func(cfg *queryConfig) {
+		cfg.obfuscation = on
+	}
+}
+
+// textNonParsable is the resource name of the queries whose statement can't
+// be obfuscated.
+const textNonParsable = "Non-parsable CQL query"
+
+// obfuscator obfuscates the statements used as resource names. It caches the
+// obfuscated statements, as the same statements are usually run repeatedly.
+var obfuscator = obfuscate.NewObfuscator(obfuscate.Config{
+	SQL: obfuscate.SQLConfig{Cache: true},
+})
+
+func (c *queryConfig) normalize(statement string) string {
+	if c.statementNormalizer != nil {
+		return c.statementNormalizer(statement)
+	}
+	if !c.obfuscation || statement == "" {
+		return statement
+	}
+	oq, err := obfuscator.ObfuscateSQLString(statement)
+	if err != nil {
+		log.Debug("contrib/gocql/gocql: failed to obfuscate statement: %v", err)
+		return textNonParsable
+	}
+	return oq.Query
+}
+
+// WithSQLCommentInjection enables the injection of the service names, env and
+// version as a leading comment (e.g. /*dddbs='...',dde='...'*/) in the
+// statements of queries created with Session.QueryContext, allowing proxies and
+// query logs to be correlated with services. The comment doesn't vary across
+// executions, so the statements can still be prepared once by gocql. See
+// WithSQLCommentTraceInjection to inject the trace context too.
+//
+// Note that the service names are then visible to anyone with access to the
+// database logs.
+func WithSQLCommentInjection() WrapOption {
+	return func(cfg *queryConfig) {
+		cfg.commentInjection = tracer.DBMPropagationModeService
+	}
+}
+
+// WithSQLCommentTraceInjection is like WithSQLCommentInjection, but it also
+// injects the trace context in the comment (e.g. /*traceparent='...'*/), which
+// allows correlating the statements with the span of their query. The trace
+// context holds the id of the span, which makes every statement unique: gocql
+// prepares DML statements, so this defeats its cache of prepared statements
+// and should be enabled with care. The span of the first execution of the query
+// is always created with the injected id, regardless of WithSpanSampleRate, and
+// the trace context isn't injected in the statements filtered with WithFilter.
+func WithSQLCommentTraceInjection() WrapOption {
+	return func(cfg *queryConfig) {
+		cfg.commentInjection = tracer.DBMPropagationModeFull
+	}
+}
+
+// WithFilter specifies a function fn which determines whether a statement
+// should be left untraced. No span is created for the statements for which fn
+// returns true. It can be used, for example, to skip queries against the
+// system and system_schema keyspaces. A batch is only left untraced when all
+// of its statements are filtered.
+func WithFilter(fn func(statement string) bool) WrapOption {
+	return func(cfg *queryConfig) {
+		cfg.filter = fn
+	}
+}
+
+func (c *queryConfig) shouldSkip(statements ...string) bool {
+	if c.filter == nil || len(statements) == 0 {
+		return false
+	}
+	for _, stmt := range statements {
+		if !c.filter(stmt) {
+			return false
+		}
+	}
+	return true
 }
 
 // WithErrorCheck specifies a function fn which determines whether the passed
 // error should be marked as an error. The fn is called whenever a CQL request
-// finishes with an error.
-func WithErrorCheck(fn func(err error) bool) WrapOption {
+// finishes with an error. A typical use-case is ignoring gocql.ErrNotFound,
+// which is returned when scanning data but no rows are available, using
+// tracer.IgnoreErrors(gocql.ErrNotFound). See tracer.ErrorChecker.
+func WithErrorCheck(fn tracer.ErrorChecker) WrapOption {
 	return func(cfg *queryConfig) {
-		// When the error is explicitly marked as not-an-error, that is
-		// when this errCheck function returns false, the APM code will
-		// just skip the error and pretend the span was successful.
-		//
-		// A typical use-case is gocql.ErrNotFound which is returned when scanning data,
-		// but no data is available so zero rows are returned.
-		//
 		// This only affects whether the span/trace is marked as success/error,
 		// the calls to the gocql API still return the upstream error code.
 		cfg.errCheck = fn
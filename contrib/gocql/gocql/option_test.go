@@ -0,0 +1,79 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package gocql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	const stmt = "SELECT * FROM trace.person WHERE name = 'Kate' AND age = 80 AND id IN (?, ?)"
+
+	t.Run("obfuscation", func(t *testing.T) {
+		cfg := defaultConfig()
+		assert.Equal(t, "SELECT * FROM trace.person WHERE name = ? AND age = ? AND id IN ( ? )", cfg.normalize(stmt))
+		// the obfuscated statements are cached
+		assert.Equal(t, cfg.normalize(stmt), cfg.normalize(stmt))
+		assert.Equal(t, "", cfg.normalize(""))
+		assert.Equal(t, textNonParsable, cfg.normalize("SELECT * FROM t WHERE name = 'unterminated"))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		cfg := defaultConfig()
+		WithResourceObfuscation(false)(cfg)
+		assert.Equal(t, stmt, cfg.normalize(stmt))
+	})
+
+	t.Run("normalizer", func(t *testing.T) {
+		cfg := defaultConfig()
+		WithStatementNormalizer(strings.ToLower)(cfg)
+		assert.Equal(t, strings.ToLower(stmt), cfg.normalize(stmt))
+	})
+}
+
+func TestShouldSkip(t *testing.T) {
+	cfg := defaultConfig()
+	assert.False(t, cfg.shouldSkip("SELECT * FROM system.local"))
+
+	WithFilter(func(stmt string) bool {
+		return strings.Contains(stmt, "system.")
+	})(cfg)
+	assert.True(t, cfg.shouldSkip("SELECT * FROM system.local"))
+	assert.False(t, cfg.shouldSkip("SELECT * FROM trace.person"))
+	assert.False(t, cfg.shouldSkip())
+	// batches are only skipped when all their statements are
+	assert.True(t, cfg.shouldSkip("SELECT * FROM system.local", "SELECT * FROM system.peers"))
+	assert.False(t, cfg.shouldSkip("SELECT * FROM system.local", "SELECT * FROM trace.person"))
+}
+
+func TestSampledOut(t *testing.T) {
+	cfg := defaultConfig()
+	for i := 0; i < 100; i++ {
+		assert.False(t, cfg.sampledOut())
+	}
+
+	WithSpanSampleRate(0)(cfg)
+	for i := 0; i < 100; i++ {
+		assert.True(t, cfg.sampledOut())
+	}
+
+	// invalid rates restore the default rate
+	WithSpanSampleRate(2)(cfg)
+	assert.Equal(t, 1.0, cfg.spanSampleRate)
+	assert.False(t, cfg.sampledOut())
+
+	WithSpanSampleRate(0.5)(cfg)
+	var n int
+	for i := 0; i < 1000; i++ {
+		if cfg.sampledOut() {
+			n++
+		}
+	}
+	assert.InDelta(t, 500, n, 150)
+}
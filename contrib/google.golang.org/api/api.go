@@ -18,6 +18,7 @@ package api // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/google.golang.org
 import (
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"math"
 	"net/http"
 
@@ -36,27 +37,82 @@ var endpointBytes []byte
 
 const componentName = "google.golang.org/api"
 
+// defaultEndpointCacheSize is the default number of recent lookups of the
+// endpoints tree which are cached, cf. WithEndpointCacheSize.
+const defaultEndpointCacheSize = 1024
+
 // apiEndpoints are the defined endpoints for the Google API; it is populated
-// by "go generate".
+// by "go generate". It is never nil, and is safe for concurrent use.
 var apiEndpointsTree *tree.Tree
 
 func init() {
 	telemetry.LoadIntegration(componentName)
-	initAPIEndpointsTree()
+	apiEndpointsTree = newAPIEndpointsTree()
 }
 
-func initAPIEndpointsTree() {
+// newAPIEndpointsTree returns the tree of the generated endpoints, caching the
+// results of its recent lookups. When they can't be loaded, an empty tree is
+// returned, to which endpoints can still be registered.
+func newAPIEndpointsTree() *tree.Tree {
 	var apiEndpoints []tree.Endpoint
 	if err := json.Unmarshal(endpointBytes, &apiEndpoints); err != nil {
 		log.Warn("contrib/google.golang.org/api: failed load json endpoints: %v", err)
-		return
+		return emptyTree()
 	}
 	tr, err := tree.New(apiEndpoints...)
-	if err != nil {
+	var aerr *tree.AmbiguityError
+	if errors.As(err, &aerr) {
+		// the generated catalogue is known to contain some overlapping
+		// endpoints; the tree remains usable.
+		log.Debug("contrib/google.golang.org/api: %v", err)
+	} else if err != nil {
 		log.Warn("contrib/google.golang.org/api: failed to create endpoints tree: %v", err)
-		return
+		return emptyTree()
 	}
-	apiEndpointsTree = tr
+	tr.WithCache(defaultEndpointCacheSize)
+	return tr
+}
+
+func emptyTree() *tree.Tree {
+	tr, _ := tree.New() // no endpoints, no error
+	tr.WithCache(defaultEndpointCacheSize)
+	return tr
+}
+
+// An Endpoint describes a Google API endpoint, used to set the service and
+// resource names of the spans of the requests it matches.
+type Endpoint = tree.Endpoint
+
+// RegisterEndpoints adds the given endpoints to the catalogue used to set the
+// service and resource names of spans, e.g. for internal Google APIs which are
+// not part of the public catalogue. It can be called at any time, concurrently
+// with the requests being traced, and returns an error if an endpoint's path
+// regex does not compile or if an endpoint with the same hostname, HTTP method
+// and path template exists.
+func RegisterEndpoints(es ...Endpoint) error {
+	for _, e := range es {
+		if err := apiEndpointsTree.Add(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetServiceNameMapper sets a function computing the service name of the spans
+// of the requests matching an endpoint of the catalogue, e.g. to prefix it
+// with the name of a tenant, instead of using the endpoint's ServiceName. It
+// applies to all the traced clients, unless their service name is set with
+// WithServiceName. A nil function restores the service names of the endpoints.
+func SetServiceNameMapper(fn func(Endpoint) string) {
+	apiEndpointsTree.WithServiceNameMapper(fn)
+}
+
+// Endpoints returns the endpoints of the catalogue for the given hostname,
+// sorted by HTTP method and path template. It helps finding out whether a
+// request whose span has generic service and resource names is missing from
+// the catalogue, or doesn't match the path regex of its endpoint.
+func Endpoints(hostname string) []Endpoint {
+	return apiEndpointsTree.Dump(hostname)
 }
 
 // NewClient creates a new oauth http client suitable for use with the google
@@ -77,6 +133,9 @@ func NewClient(options ...Option) (*http.Client, error) {
 func WrapRoundTripper(transport http.RoundTripper, options ...Option) http.RoundTripper {
 	cfg := newConfig(options...)
 	log.Debug("contrib/google.golang.org/api: Wrapping RoundTripper: %#v", cfg)
+	if cfg.endpointCacheSizeSet {
+		apiEndpointsTree.WithCache(cfg.endpointCacheSize)
+	}
 	rtOpts := []httptrace.RoundTripperOption{
 		httptrace.WithBefore(func(req *http.Request, span ddtrace.Span) {
 			if !cfg.endpointMetadataDisabled {
@@ -98,7 +157,7 @@ func WrapRoundTripper(transport http.RoundTripper, options ...Option) http.Round
 }
 
 func setTagsWithEndpointMetadata(req *http.Request, span ddtrace.Span) {
-	e, ok := apiEndpointsTree.Get(req.URL.Hostname(), req.Method, req.URL.Path)
+	e, ok := apiEndpointsTree.GetWithQuery(req.URL.Hostname(), req.Method, req.URL.Path, req.URL.RawQuery)
 	if ok {
 		span.SetTag(ext.ServiceName, e.ServiceName)
 		span.SetTag(ext.ResourceName, e.ResourceName)
@@ -7,9 +7,11 @@ package api
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"testing"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
@@ -144,6 +146,147 @@ func TestWithEndpointMetadataDisabled(t *testing.T) {
 	assert.Equal(t, ext.SpanKindClient, s0.Tag(ext.SpanKind))
 }
 
+func TestRegisterEndpoints(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	err := RegisterEndpoints(Endpoint{
+		Hostname:     "widgets.googleapis.com",
+		HTTPMethod:   "GET",
+		PathTemplate: "/v1/widgets/{widgetId}",
+		ServiceName:  "google.widgets",
+		ResourceName: "widgets.get",
+	})
+	require.NoError(t, err)
+
+	client := &http.Client{Transport: WrapRoundTripper(badRequestTransport)}
+	resp, err := client.Get("https://widgets.googleapis.com/v1/widgets/1234")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "google.widgets", spans[0].Tag(ext.ServiceName))
+	assert.Equal(t, "widgets.get", spans[0].Tag(ext.ResourceName))
+
+	err = RegisterEndpoints(Endpoint{
+		Hostname:     "widgets.googleapis.com",
+		HTTPMethod:   "GET",
+		PathTemplate: "/v1/widgets/{widgetId}",
+		ServiceName:  "google.widgets",
+		ResourceName: "widgets.get",
+	})
+	assert.Error(t, err)
+
+	mt.Reset()
+	err = RegisterEndpoints(Endpoint{
+		Hostname:     "widgets.googleapis.com",
+		HTTPMethod:   "GET",
+		PathTemplate: "/v1/widgets/{widgetId}",
+		QueryParams:  map[string]string{"alt": "media"},
+		ServiceName:  "google.widgets",
+		ResourceName: "widgets.download",
+	})
+	require.NoError(t, err)
+	resp, err = client.Get("https://widgets.googleapis.com/v1/widgets/1234?alt=media")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	spans = mt.FinishedSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "widgets.download", spans[0].Tag(ext.ResourceName))
+
+	var resources []string
+	for _, e := range Endpoints("widgets.googleapis.com") {
+		resources = append(resources, e.ResourceName)
+	}
+	assert.ElementsMatch(t, []string{"widgets.get", "widgets.download"}, resources)
+}
+
+func TestRegisterEndpointsConcurrently(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	client := &http.Client{Transport: WrapRoundTripper(badRequestTransport)}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			err := RegisterEndpoints(Endpoint{
+				Hostname:     "gadgets.googleapis.com",
+				HTTPMethod:   "GET",
+				PathTemplate: fmt.Sprintf("/v%d/gadgets/{gadgetId}", i),
+				ServiceName:  "google.gadgets",
+				ResourceName: "gadgets.get",
+			})
+			assert.NoError(t, err)
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := client.Get(fmt.Sprintf("https://gadgets.googleapis.com/v%d/gadgets/1234", i))
+			if assert.NoError(t, err) {
+				resp.Body.Close()
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, Endpoints("gadgets.googleapis.com"), 10)
+	assert.Len(t, mt.FinishedSpans(), 10)
+}
+
+func TestSetServiceNameMapper(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	SetServiceNameMapper(func(e Endpoint) string {
+		return "tenant-a." + e.ServiceName
+	})
+	defer SetServiceNameMapper(nil)
+
+	client := &http.Client{Transport: WrapRoundTripper(badRequestTransport)}
+	resp, err := client.Get("https://books.googleapis.com/books/v1/users/montana.banana/bookshelves")
+	require.NoError(t, err)
+	resp.Body.Close()
+	client = &http.Client{Transport: WrapRoundTripper(badRequestTransport, WithServiceName("books"))}
+	resp, err = client.Get("https://books.googleapis.com/books/v1/users/montana.banana/bookshelves")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "tenant-a.google.books", spans[0].Tag(ext.ServiceName))
+	assert.Equal(t, "books.bookshelves.list", spans[0].Tag(ext.ResourceName))
+	assert.Equal(t, "books", spans[1].Tag(ext.ServiceName))
+}
+
+func TestWithEndpointCacheSize(t *testing.T) {
+	defer apiEndpointsTree.WithCache(defaultEndpointCacheSize)
+	for _, size := range []int{0, 1, defaultEndpointCacheSize} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			mt := mocktracer.Start()
+			defer mt.Stop()
+
+			client := &http.Client{Transport: WrapRoundTripper(badRequestTransport, WithEndpointCacheSize(size))}
+			for _, u := range []string{
+				"https://books.googleapis.com/books/v1/users/montana.banana/bookshelves",
+				"https://books.googleapis.com/books/v1/users/montana.banana/bookshelves/1",
+				"https://books.googleapis.com/books/v1/users/montana.banana/bookshelves",
+			} {
+				resp, err := client.Get(u)
+				require.NoError(t, err)
+				resp.Body.Close()
+			}
+
+			spans := mt.FinishedSpans()
+			require.Len(t, spans, 3)
+			assert.Equal(t, "books.bookshelves.list", spans[0].Tag(ext.ResourceName))
+			assert.Equal(t, "books.bookshelves.get", spans[1].Tag(ext.ResourceName))
+			assert.Equal(t, "books.bookshelves.list", spans[2].Tag(ext.ResourceName))
+		})
+	}
+}
+
 func TestAnalyticsSettings(t *testing.T) {
 	assertRate := func(t *testing.T, mt mocktracer.Tracer, rate interface{}, opts ...Option) {
 		svc, err := books.New(&http.Client{
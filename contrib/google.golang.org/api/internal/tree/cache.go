@@ -0,0 +1,90 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tree
+
+import (
+	"container/list"
+	"sync"
+)
+
+// cacheKey identifies a lookup in the tree. The hostname is lowercased, and
+// query only holds the query parameters which discriminate endpoints.
+type cacheKey struct {
+	host, method, path, query string
+}
+
+// cacheEntry is the value of the elements of a lookupCache list.
+type cacheEntry struct {
+	key cacheKey
+	e   Endpoint
+	ok  bool
+}
+
+// lookupCache is a bounded LRU cache of the results of the tree lookups,
+// including the misses.
+type lookupCache struct {
+	mu    sync.Mutex // guards ll and items
+	size  int
+	ll    *list.List // most recently used first
+	items map[cacheKey]*list.Element
+}
+
+// newLookupCache creates a lookupCache holding up to size results.
+func newLookupCache(size int) *lookupCache {
+	return &lookupCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[cacheKey]*list.Element, size),
+	}
+}
+
+// get returns the cached result of the lookup identified by k. The last
+// return value reports whether it was found in the cache.
+func (c *lookupCache) get(k cacheKey) (e Endpoint, ok, cached bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, cached := c.items[k]
+	if !cached {
+		return Endpoint{}, false, false
+	}
+	c.ll.MoveToFront(el)
+	ce := el.Value.(*cacheEntry)
+	return ce.e, ce.ok, true
+}
+
+// put caches the result of the lookup identified by k, evicting the least
+// recently used result if the cache is full.
+func (c *lookupCache) put(k cacheKey, e Endpoint, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, found := c.items[k]; found {
+		c.ll.MoveToFront(el)
+		ce := el.Value.(*cacheEntry)
+		ce.e, ce.ok = e, ok
+		return
+	}
+	if c.ll.Len() >= c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+	c.items[k] = c.ll.PushFront(&cacheEntry{key: k, e: e, ok: ok})
+}
+
+// len returns the number of cached results.
+func (c *lookupCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// purge removes all the cached results.
+func (c *lookupCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = make(map[cacheKey]*list.Element, c.size)
+}
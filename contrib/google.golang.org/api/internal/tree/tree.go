@@ -6,47 +6,118 @@
 package tree
 
 import (
+	"fmt"
+	"net/url"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
+)
+
+// AnyMethod can be used as the HTTPMethod of an Endpoint to match requests of
+// any HTTP method which don't match an endpoint registered for that specific
+// method.
+const AnyMethod = "*"
+
+const (
+	// wildcardSegment is the key of the children of a node holding path
+	// segments which contain a template variable.
+	wildcardSegment = "{}"
+	// wildcardDirSegment is like wildcardSegment, for path segments which are
+	// followed by a slash.
+	wildcardDirSegment = "{}/"
+	// reservedSegment is the key of the children of a node holding the
+	// endpoints whose remaining path starts with a reserved expansion, which
+	// may span any number of path segments.
+	reservedSegment = "{+}"
 )
 
 type (
 	// A Tree is a prefix tree for matching endpoints based on http requests.
 	Tree struct {
+		mu   sync.RWMutex // guards root, serviceNameMapper, queryKeys and cache
 		root *treeNode
+		// serviceNameMapper, when set, computes the service name of the
+		// endpoints returned by Get.
+		serviceNameMapper func(Endpoint) string
+		// queryKeys holds the sorted names of the QueryParams of the
+		// endpoints in the tree.
+		queryKeys []string
+		// cache, when set, holds the results of the recent lookups.
+		cache *lookupCache
 	}
 	// A treeNode is a node in the tree. Each node may have children based on
-	// path segments:
+	// path segments, where segments containing template variables share the
+	// wildcard keys:
 	//
 	// "" ->
 	//   "v1/" ->
-	//     "users/" ...
+	//     "users/" ->
+	//       "{}" ...
 	//     "blogs/" ...
 	// ...
 	treeNode struct {
 		Children  map[string]*treeNode
 		Endpoints []Endpoint
 	}
-	// An Endpoint is an API endpoint associated with a (host, method, path)
+	// An Endpoint is an API endpoint associated with a (host, method, path).
+	// When PathRegex is empty, it is generated from PathTemplate, where
+	// "{var}" matches a single path segment and the reserved expansion
+	// "{+var}" matches any number of segments, including slashes.
+	//
+	// QueryParams optionally discriminates endpoints sharing the same path
+	// by the query parameters of the requests, e.g. {"alt": "media"} for
+	// downloads. Such an endpoint only matches requests having all the given
+	// query parameters with the given values, and takes precedence over the
+	// endpoints of the same path without QueryParams.
 	Endpoint struct {
-		Hostname     string `json:"hostname"`
-		HTTPMethod   string `json:"http_method"`
-		PathTemplate string `json:"path_template"`
-		PathRegex    string `json:"path_regex"`
-		ServiceName  string `json:"service_name"`
-		ResourceName string `json:"resource_name"`
+		Hostname     string            `json:"hostname"`
+		HTTPMethod   string            `json:"http_method"`
+		PathTemplate string            `json:"path_template"`
+		PathRegex    string            `json:"path_regex"`
+		QueryParams  map[string]string `json:"query_params,omitempty"`
+		ServiceName  string            `json:"service_name"`
+		ResourceName string            `json:"resource_name"`
 
 		pathMatcher *regexp.Regexp
+		// paramNames holds the name of the path parameter captured by each
+		// subexpression of pathMatcher, indexed as in (*regexp.Regexp).SubexpNames.
+		paramNames []string
 	}
 )
 
+// An AmbiguityError is returned by New when endpoints sharing the same
+// hostname, HTTP method and path prefix have overlapping path regexes, such
+// that a sample path generated from the template of one of them is matched by
+// both. In that case Get returns whichever endpoint was given first.
+// Endpoints with distinct path shapes, such as "/posts/search" and
+// "/posts/{postId}", are not ambiguous: literal path segments take
+// precedence over variables.
+type AmbiguityError struct {
+	// Conflicts holds the pairs of overlapping endpoints. Within a pair, the
+	// endpoint which was given first, and thus takes precedence, comes first.
+	Conflicts [][2]Endpoint
+}
+
+// Error implements error.
+func (e *AmbiguityError) Error() string {
+	c := e.Conflicts[0]
+	return fmt.Sprintf("%d ambiguous endpoints found, e.g. %s %s%s (%s) and %s (%s)",
+		len(e.Conflicts), c[0].HTTPMethod, c[0].Hostname, c[0].PathTemplate, c[0].ResourceName,
+		c[1].PathTemplate, c[1].ResourceName)
+}
+
 // New creates a new Tree. You can optionally pass endpoints to add to the
-// tree.
+// tree. If some of the endpoints are ambiguous, New returns the usable tree
+// along with an *AmbiguityError describing them.
 func New(es ...Endpoint) (*Tree, error) {
 	t := &Tree{root: newTreeNode()}
 	if err := t.addEndpoints(es...); err != nil {
 		return nil, err
 	}
+	if conflicts := t.root.ambiguities(nil); len(conflicts) > 0 {
+		return t, &AmbiguityError{Conflicts: conflicts}
+	}
 	return t, nil
 }
 
@@ -58,42 +129,372 @@ func newTreeNode() *treeNode {
 // addEndpoints adds zero or more endpoints to the tree.
 func (t *Tree) addEndpoints(es ...Endpoint) error {
 	for _, e := range es {
-		prefix := e.PathTemplate
-		if idx := strings.IndexByte(prefix, '{'); idx >= 0 {
-			prefix = prefix[:idx]
-		}
-		path := strings.SplitAfter(prefix, "/")
-		if path[len(path)-1] == "" {
-			path = path[:len(path)-1]
-		}
-		pathMatcher, err := regexp.Compile(e.PathRegex)
+		segments, err := e.init()
 		if err != nil {
 			return err
 		}
-		e.pathMatcher = pathMatcher
-
-		segments := append([]string{e.Hostname, e.HTTPMethod}, path...)
 		t.root.add(segments, e)
+		t.addQueryKeys(e.QueryParams)
+	}
+	return nil
+}
+
+// addQueryKeys adds the names of the query parameters qp to t.queryKeys.
+// Callers must hold t.mu, unless t isn't shared yet.
+func (t *Tree) addQueryKeys(qp map[string]string) {
+	for k := range qp {
+		i := sort.SearchStrings(t.queryKeys, k)
+		if i < len(t.queryKeys) && t.queryKeys[i] == k {
+			continue
+		}
+		t.queryKeys = append(t.queryKeys, "")
+		copy(t.queryKeys[i+1:], t.queryKeys[i:])
+		t.queryKeys[i] = k
+	}
+}
+
+// Add adds the endpoint e to the tree. It returns an error if the endpoint's
+// path regex does not compile, or if an endpoint with the same hostname, HTTP
+// method, path template and query parameters was already added. It is safe to
+// call Add concurrently with Get.
+func (t *Tree) Add(e Endpoint) error {
+	segments, err := e.init()
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if n := t.root.find(segments); n != nil {
+		for _, x := range n.Endpoints {
+			if x.PathTemplate == e.PathTemplate && sameQueryParams(x.QueryParams, e.QueryParams) {
+				return fmt.Errorf("endpoint %s %s%s already exists (%s)", e.HTTPMethod, e.Hostname, e.PathTemplate, x.ResourceName)
+			}
+		}
+	}
+	t.root.add(segments, e)
+	t.addQueryKeys(e.QueryParams)
+	if t.cache != nil {
+		// previous lookups may now resolve to e
+		t.cache.purge()
 	}
 	return nil
 }
 
+// init compiles the path regex of e, generating it from the path template if
+// needed, and returns the segments under which e is stored in the tree.
+func (e *Endpoint) init() ([]string, error) {
+	// Host names are case-insensitive, see RFC 4343.
+	segments := []string{strings.ToLower(e.Hostname), e.HTTPMethod}
+	for _, seg := range strings.SplitAfter(e.PathTemplate, "/") {
+		if seg == "" {
+			break
+		}
+		if strings.Contains(seg, "{+") {
+			segments = append(segments, reservedSegment)
+			break
+		}
+		if strings.IndexByte(seg, '{') >= 0 {
+			seg = wildcardKey(seg)
+		}
+		segments = append(segments, seg)
+	}
+	if e.PathRegex == "" {
+		e.PathRegex = templateRegex(e.PathTemplate)
+	}
+	pathMatcher, err := regexp.Compile(e.PathRegex)
+	if err != nil {
+		return nil, err
+	}
+	e.pathMatcher = pathMatcher
+	e.paramNames = paramNames(pathMatcher, e.PathTemplate)
+	return segments, nil
+}
+
+// wildcardKey returns the key of the wildcard child matching path segment seg.
+func wildcardKey(seg string) string {
+	if strings.HasSuffix(seg, "/") {
+		return wildcardDirSegment
+	}
+	return wildcardSegment
+}
+
+// WithServiceNameMapper sets a function computing the service name of the
+// endpoints returned by Get from the endpoint found in the tree, e.g. to
+// prefix it with the name of a tenant. It allows remapping the service names
+// without rebuilding the tree. A nil function restores the service names of
+// the endpoints added to the tree.
+func (t *Tree) WithServiceNameMapper(fn func(Endpoint) string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.serviceNameMapper = fn
+}
+
+// WithCache enables caching the results of the last size lookups, such that
+// repeated lookups of the same hostname, http method and http path don't need
+// to match the path regexes again. The cache is invalidated whenever an
+// endpoint is added to the tree. A size of zero or less disables the cache.
+func (t *Tree) WithCache(size int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if size <= 0 {
+		t.cache = nil
+		return
+	}
+	t.cache = newLookupCache(size)
+}
+
 // Get attempts to find the endpoints associated with the given hostname, http
-// http method and http path. It returns false if no endpoints matched.
+// http method and http path. The hostname is matched case-insensitively. If no
+// endpoint matches the http method, endpoints registered with AnyMethod are
+// considered. It returns false if no endpoints matched. Endpoints with
+// QueryParams are never returned, see GetWithQuery.
 func (t *Tree) Get(hostname string, httpMethod string, httpPath string) (Endpoint, bool) {
+	return t.lookup(hostname, httpMethod, httpPath, nil)
+}
+
+// GetWithQuery is like Get, but additionally considers the endpoints whose
+// QueryParams are found in the given raw query string, such as
+// "alt=media&generation=1", which take precedence over the other endpoints.
+func (t *Tree) GetWithQuery(hostname string, httpMethod string, httpPath string, query string) (Endpoint, bool) {
+	var values url.Values
+	if query != "" {
+		// Invalid parameters are ignored, keeping the valid ones.
+		values, _ = url.ParseQuery(query)
+	}
+	return t.lookup(hostname, httpMethod, httpPath, values)
+}
+
+// lookup finds the endpoint associated with the given hostname, http method,
+// http path and query parameters, applying the service name mapper.
+func (t *Tree) lookup(hostname string, httpMethod string, httpPath string, query url.Values) (Endpoint, bool) {
 	if t == nil {
 		return Endpoint{}, false
 	}
-	segments := append([]string{hostname, httpMethod}, strings.SplitAfter(httpPath, "/")...)
-	endpoints := t.root.getLongestPrefixMatch(segments)
-	for _, e := range endpoints {
-		if e.pathMatcher.MatchString(httpPath) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var (
+		e  Endpoint
+		ok bool
+	)
+	if t.cache != nil {
+		e, ok = t.cachedGet(hostname, httpMethod, httpPath, query)
+	} else {
+		e, ok = t.get(hostname, httpMethod, httpPath, query)
+	}
+	if ok && t.serviceNameMapper != nil {
+		e.ServiceName = t.serviceNameMapper(e)
+	}
+	return e, ok
+}
+
+// cachedGet is like get, looking up the endpoint in t.cache first. The
+// endpoints are cached before applying the service name mapper, which may thus
+// change without invalidating the cache. Callers must hold t.mu.
+func (t *Tree) cachedGet(hostname string, httpMethod string, httpPath string, query url.Values) (Endpoint, bool) {
+	k := cacheKey{
+		host:   strings.ToLower(hostname),
+		method: httpMethod,
+		path:   httpPath,
+		query:  t.queryKey(query),
+	}
+	if e, ok, cached := t.cache.get(k); cached {
+		return e, ok
+	}
+	e, ok := t.get(hostname, httpMethod, httpPath, query)
+	t.cache.put(k, e, ok)
+	return e, ok
+}
+
+// queryKey returns the part of the cache key of a lookup with the given query
+// parameters. Only the parameters found in the QueryParams of some endpoints
+// are kept, such that the parameters which can't change the result of the
+// lookup, e.g. page tokens, don't split the cache entries. Callers must hold
+// t.mu.
+func (t *Tree) queryKey(query url.Values) string {
+	if len(query) == 0 || len(t.queryKeys) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for _, k := range t.queryKeys {
+		if vs, ok := query[k]; ok {
+			sb.WriteString(url.QueryEscape(k))
+			sb.WriteByte('=')
+			sb.WriteString(url.QueryEscape(vs[0]))
+			sb.WriteByte('&')
+		}
+	}
+	return sb.String()
+}
+
+// get looks up the endpoint associated with the given hostname, http method,
+// http path and query parameters. Callers must hold t.mu.
+func (t *Tree) get(hostname string, httpMethod string, httpPath string, query url.Values) (Endpoint, bool) {
+	host, ok := t.root.Children[strings.ToLower(hostname)]
+	if !ok {
+		return Endpoint{}, false
+	}
+	if n, ok := host.Children[httpMethod]; ok {
+		if e, ok := n.get(httpPath, httpPath, query); ok {
 			return e, true
 		}
 	}
+	if n, ok := host.Children[AnyMethod]; ok && httpMethod != AnyMethod {
+		return n.get(httpPath, httpPath, query)
+	}
 	return Endpoint{}, false
 }
 
+// Dump returns the endpoints registered for the given hostname, matched
+// case-insensitively, sorted by HTTP method and path template. It allows
+// checking whether the endpoint of a request which didn't match is missing
+// from the tree. The service names are the ones of the endpoints added to the
+// tree, regardless of the service name mapper.
+func (t *Tree) Dump(hostname string) []Endpoint {
+	if t == nil {
+		return nil
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	host, ok := t.root.Children[strings.ToLower(hostname)]
+	if !ok {
+		return nil
+	}
+	es := host.endpoints(nil)
+	for i := range es {
+		if qp := es[i].QueryParams; qp != nil {
+			es[i].QueryParams = make(map[string]string, len(qp))
+			for k, v := range qp {
+				es[i].QueryParams[k] = v
+			}
+		}
+	}
+	sort.SliceStable(es, func(i, j int) bool {
+		if es[i].HTTPMethod != es[j].HTTPMethod {
+			return es[i].HTTPMethod < es[j].HTTPMethod
+		}
+		return es[i].PathTemplate < es[j].PathTemplate
+	})
+	return es
+}
+
+// GetWithParams is like Get, but additionally returns the values of the path
+// parameters named in the endpoint's PathTemplate, keyed by their name. For
+// example, "/blogger/v3/blogs/1234/pages/5678" matching the template
+// "/blogger/v3/blogs/{blogId}/pages/{pageId}" returns
+// {"blogId": "1234", "pageId": "5678"}.
+func (t *Tree) GetWithParams(hostname string, httpMethod string, httpPath string) (Endpoint, map[string]string, bool) {
+	e, ok := t.Get(hostname, httpMethod, httpPath)
+	if !ok {
+		return Endpoint{}, nil, false
+	}
+	return e, e.params(httpPath), true
+}
+
+// params returns the path parameters captured by e when matching httpPath.
+func (e *Endpoint) params(httpPath string) map[string]string {
+	m := e.pathMatcher.FindStringSubmatch(httpPath)
+	params := make(map[string]string, len(m))
+	for i := 1; i < len(m) && i < len(e.paramNames); i++ {
+		if name := e.paramNames[i]; name != "" {
+			params[name] = m[i]
+		}
+	}
+	return params
+}
+
+// paramNames returns the parameter names captured by each subexpression of re.
+// Named groups in re are used as-is; otherwise, the capturing groups are
+// assumed to map, in order, to the variables in the path template tpl, which
+// is how generated path regexes are built.
+func paramNames(re *regexp.Regexp, tpl string) []string {
+	names := re.SubexpNames()
+	for _, name := range names {
+		if name != "" {
+			return names
+		}
+	}
+	vars := templateVars(tpl)
+	if len(vars) != re.NumSubexp() {
+		return nil
+	}
+	return append([]string{""}, vars...)
+}
+
+// templateParts splits the path template tpl into its literal parts and the
+// expressions in between them, such that len(literals) == len(exprs)+1. The
+// expressions are returned without braces, e.g. "+name" for "{+name}".
+func templateParts(tpl string) (literals, exprs []string) {
+	for {
+		start := strings.IndexByte(tpl, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(tpl[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+		literals = append(literals, tpl[:start])
+		exprs = append(exprs, tpl[start+1:end])
+		tpl = tpl[end+1:]
+	}
+	return append(literals, tpl), exprs
+}
+
+// isReservedExpansion reports whether the template expression expr is a
+// reserved expansion (e.g. "+name"), which may contain slashes.
+func isReservedExpansion(expr string) bool {
+	return strings.HasPrefix(expr, "+")
+}
+
+// templateVars returns the names of the variables in the path template tpl,
+// in order of appearance.
+func templateVars(tpl string) []string {
+	_, exprs := templateParts(tpl)
+	vars := make([]string, len(exprs))
+	for i, expr := range exprs {
+		vars[i] = strings.TrimPrefix(expr, "+")
+	}
+	return vars
+}
+
+// templateRegex generates a path regex from the given path template. A
+// "{var}" expression matches a single path segment, while a reserved expansion
+// "{+var}" also matches slashes.
+func templateRegex(tpl string) string {
+	literals, exprs := templateParts(tpl)
+	var sb strings.Builder
+	sb.WriteByte('^')
+	for i, expr := range exprs {
+		sb.WriteString(regexp.QuoteMeta(literals[i]))
+		if isReservedExpansion(expr) {
+			sb.WriteString("(.*)")
+		} else {
+			sb.WriteString("([^/]*)")
+		}
+	}
+	sb.WriteString(regexp.QuoteMeta(literals[len(literals)-1]))
+	sb.WriteByte('$')
+	return sb.String()
+}
+
+// samplePath generates a path matching the given path template, replacing
+// each variable with a placeholder value.
+func samplePath(tpl string) string {
+	literals, exprs := templateParts(tpl)
+	var sb strings.Builder
+	for i, expr := range exprs {
+		sb.WriteString(literals[i])
+		if isReservedExpansion(expr) {
+			sb.WriteString("x/x")
+		} else {
+			sb.WriteString("x")
+		}
+	}
+	sb.WriteString(literals[len(literals)-1])
+	return sb.String()
+}
+
 // add adds an endpoint to the tree.
 func (n *treeNode) add(segments []string, e Endpoint) {
 	if len(segments) > 0 {
@@ -110,19 +511,149 @@ func (n *treeNode) add(segments []string, e Endpoint) {
 	n.Endpoints = append(n.Endpoints, e)
 }
 
-// getLongestPrefixMatch gets the endpoints for the longest prefix which match
-// the segments.
+// endpoints appends to es the endpoints of n and its children.
+func (n *treeNode) endpoints(es []Endpoint) []Endpoint {
+	es = append(es, n.Endpoints...)
+	for _, child := range n.Children {
+		es = child.endpoints(es)
+	}
+	return es
+}
+
+// find returns the node at the given segments, or nil if there is none.
+func (n *treeNode) find(segments []string) *treeNode {
+	for _, s := range segments {
+		child, ok := n.Children[s]
+		if !ok {
+			return nil
+		}
+		n = child
+	}
+	return n
+}
+
+// get returns the first endpoint under n matching httpPath, given the
+// remaining path segments rest. Literal segments take precedence over
+// variables, which take precedence over reserved expansions.
 //
-// For example: `/api/v1/users/1234` might return `/api/v1/users/`
-func (n *treeNode) getLongestPrefixMatch(segments []string) []Endpoint {
-	if len(segments) > 0 {
-		child, ok := n.Children[segments[0]]
-		if ok {
-			Endpoints := child.getLongestPrefixMatch(segments[1:])
-			if len(Endpoints) > 0 {
-				return Endpoints
+// For example: `/api/v1/users/1234` might match `/api/v1/users/{id}`, or
+// otherwise `/api/v1/{+name}`.
+func (n *treeNode) get(rest, httpPath string, query url.Values) (Endpoint, bool) {
+	if rest == "" {
+		if e, ok := match(n.Endpoints, httpPath, query); ok {
+			return e, true
+		}
+	} else {
+		seg := rest
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			seg = rest[:i+1]
+		}
+		rest = rest[len(seg):]
+		if child, ok := n.Children[seg]; ok {
+			if e, ok := child.get(rest, httpPath, query); ok {
+				return e, true
 			}
 		}
+		if child, ok := n.Children[wildcardKey(seg)]; ok {
+			if e, ok := child.get(rest, httpPath, query); ok {
+				return e, true
+			}
+		}
+	}
+	if child, ok := n.Children[reservedSegment]; ok {
+		return match(child.Endpoints, httpPath, query)
+	}
+	return Endpoint{}, false
+}
+
+// match returns the first of the endpoints es whose path regex matches httpPath
+// and whose query parameters are found in query, preferring the endpoints with
+// query parameters.
+func match(es []Endpoint, httpPath string, query url.Values) (Endpoint, bool) {
+	var (
+		fallback Endpoint
+		found    bool
+	)
+	for _, e := range es {
+		if len(e.QueryParams) == 0 {
+			if !found && e.pathMatcher.MatchString(httpPath) {
+				fallback, found = e, true
+			}
+			continue
+		}
+		if e.matchesQuery(query) && e.pathMatcher.MatchString(httpPath) {
+			return e, true
+		}
+	}
+	return fallback, found
+}
+
+// matchesQuery reports whether all the query parameters of e are found in query
+// with the expected values.
+func (e *Endpoint) matchesQuery(query url.Values) bool {
+	for k, v := range e.QueryParams {
+		if vs, ok := query[k]; !ok || vs[0] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// sameQueryParams reports whether a and b hold the same query parameters.
+func sameQueryParams(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
+
+// ambiguities appends to conflicts the pairs of endpoints of n and its
+// children which overlap. Identical duplicate endpoints are not considered
+// ambiguous since they resolve to the same service and resource names.
+func (n *treeNode) ambiguities(conflicts [][2]Endpoint) [][2]Endpoint {
+	for i, a := range n.Endpoints {
+		for _, b := range n.Endpoints[i+1:] {
+			if a.ServiceName == b.ServiceName && a.ResourceName == b.ResourceName && a.PathRegex == b.PathRegex {
+				continue
+			}
+			if !sameQueryParams(a.QueryParams, b.QueryParams) {
+				// discriminated by the query parameters
+				continue
+			}
+			if !mayOverlap(a.PathTemplate, b.PathTemplate) {
+				continue
+			}
+			if p := samplePath(a.PathTemplate); a.pathMatcher.MatchString(p) && b.pathMatcher.MatchString(p) {
+				conflicts = append(conflicts, [2]Endpoint{a, b})
+				continue
+			}
+			if p := samplePath(b.PathTemplate); a.pathMatcher.MatchString(p) && b.pathMatcher.MatchString(p) {
+				conflicts = append(conflicts, [2]Endpoint{a, b})
+			}
+		}
+	}
+	for _, child := range n.Children {
+		conflicts = child.ambiguities(conflicts)
+	}
+	return conflicts
+}
+
+// mayOverlap is a cheap check reporting whether paths generated from the
+// templates a and b may match each other's regexes: their trailing literals
+// must be compatible and, without reserved expansions, matching paths must
+// have the same number of segments.
+func mayOverlap(a, b string) bool {
+	la, lb := a[strings.LastIndexByte(a, '}')+1:], b[strings.LastIndexByte(b, '}')+1:]
+	if !strings.HasSuffix(la, lb) && !strings.HasSuffix(lb, la) {
+		return false
+	}
+	if strings.Contains(a, "{+") || strings.Contains(b, "{+") {
+		return true
 	}
-	return n.Endpoints
+	return strings.Count(a, "/") == strings.Count(b, "/")
 }
@@ -6,6 +6,9 @@
 package tree
 
 import (
+	"encoding/json"
+	"os"
+	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -43,3 +46,567 @@ func TestTree(t *testing.T) {
 	assert.Equal(t, "blogger", e.ServiceName)
 	assert.Equal(t, "blogger.pageViews.get", e.ResourceName)
 }
+
+func TestTreeTemplate(t *testing.T) {
+	tr, err := New([]Endpoint{
+		{
+			Hostname:     "cloudresourcemanager.googleapis.com",
+			HTTPMethod:   "GET",
+			PathTemplate: "/v1/{+name}",
+			ServiceName:  "google.cloudresourcemanager",
+			ResourceName: "cloudresourcemanager.operations.get",
+		},
+		{
+			Hostname:     "cloudresourcemanager.googleapis.com",
+			HTTPMethod:   "GET",
+			PathTemplate: "/v1/projects/{projectId}",
+			ServiceName:  "google.cloudresourcemanager",
+			ResourceName: "cloudresourcemanager.projects.get",
+		},
+	}...)
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		path     string
+		resource string
+	}{
+		{"/v1/projects/foo", "cloudresourcemanager.projects.get"},
+		{"/v1/projects/foo/locations/bar", "cloudresourcemanager.operations.get"},
+		{"/v1/operations/1234", "cloudresourcemanager.operations.get"},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			e, ok := tr.Get("cloudresourcemanager.googleapis.com", "GET", tt.path)
+			assert.True(t, ok)
+			assert.Equal(t, tt.resource, e.ResourceName)
+		})
+	}
+
+	_, ok := tr.Get("cloudresourcemanager.googleapis.com", "GET", "/v2/projects/foo")
+	assert.False(t, ok)
+}
+
+func TestTemplateRegex(t *testing.T) {
+	for tpl, want := range map[string]string{
+		"/map":                               `^/map$`,
+		"/v1/{+name}":                        `^/v1/(.*)$`,
+		"/v1/{+name}:cancel":                 `^/v1/(.*):cancel$`,
+		"/blogger/v3/blogs/{blogId}/pages":   `^/blogger/v3/blogs/([^/]*)/pages$`,
+		"/v1/projects/{projectId}/jobs.list": `^/v1/projects/([^/]*)/jobs\.list$`,
+	} {
+		assert.Equal(t, want, templateRegex(tpl), tpl)
+	}
+}
+
+func TestTreeGetWithParams(t *testing.T) {
+	tr, err := New([]Endpoint{
+		{
+			Hostname:     "www.googleapis.com",
+			HTTPMethod:   "DELETE",
+			PathTemplate: "/blogger/v3/blogs/{blogId}/pages/{pageId}",
+			PathRegex:    `^/blogger/v3/blogs/([0-9]+)/pages/([0-9]+)$`,
+			ServiceName:  "blogger",
+			ResourceName: "blogger.pages.delete",
+		},
+		{
+			Hostname:     "www.googleapis.com",
+			HTTPMethod:   "GET",
+			PathTemplate: "/blogger/v3/blogs/{blogId}/pageviews",
+			PathRegex:    `^/blogger/v3/blogs/(?P<blog>[0-9]+)/pageviews$`,
+			ServiceName:  "blogger",
+			ResourceName: "blogger.pageViews.get",
+		},
+		{
+			Hostname:     "cloudresourcemanager.googleapis.com",
+			HTTPMethod:   "GET",
+			PathTemplate: "/v1/{+name}",
+			ServiceName:  "google.cloudresourcemanager",
+			ResourceName: "cloudresourcemanager.operations.get",
+		},
+	}...)
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		host, method, path string
+		resource           string
+		params             map[string]string
+	}{
+		{
+			"www.googleapis.com", "DELETE", "/blogger/v3/blogs/1234/pages/5678",
+			"blogger.pages.delete",
+			map[string]string{"blogId": "1234", "pageId": "5678"},
+		},
+		{
+			"www.googleapis.com", "GET", "/blogger/v3/blogs/1234/pageviews",
+			"blogger.pageViews.get",
+			map[string]string{"blog": "1234"},
+		},
+		{
+			"cloudresourcemanager.googleapis.com", "GET", "/v1/projects/foo/locations/bar",
+			"cloudresourcemanager.operations.get",
+			map[string]string{"name": "projects/foo/locations/bar"},
+		},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			e, params, ok := tr.GetWithParams(tt.host, tt.method, tt.path)
+			assert.True(t, ok)
+			assert.Equal(t, tt.resource, e.ResourceName)
+			assert.Equal(t, tt.params, params)
+		})
+	}
+
+	_, params, ok := tr.GetWithParams("www.googleapis.com", "GET", "/blogger/v3/blogs/abc/pageviews")
+	assert.False(t, ok)
+	assert.Nil(t, params)
+}
+
+func TestTreeAnyMethod(t *testing.T) {
+	tr, err := New([]Endpoint{
+		{
+			Hostname:     "storage.googleapis.com",
+			HTTPMethod:   "GET",
+			PathTemplate: "/storage/v1/b/{bucket}",
+			ServiceName:  "google.storage",
+			ResourceName: "storage.buckets.get",
+		},
+		{
+			Hostname:     "storage.googleapis.com",
+			HTTPMethod:   AnyMethod,
+			PathTemplate: "/{+path}",
+			ServiceName:  "google.storage",
+			ResourceName: "storage",
+		},
+	}...)
+	require.NoError(t, err)
+
+	e, ok := tr.Get("storage.googleapis.com", "GET", "/storage/v1/b/bucket")
+	assert.True(t, ok)
+	assert.Equal(t, "storage.buckets.get", e.ResourceName)
+
+	e, ok = tr.Get("storage.googleapis.com", "PATCH", "/storage/v1/b/bucket")
+	assert.True(t, ok)
+	assert.Equal(t, "google.storage", e.ServiceName)
+	assert.Equal(t, "storage", e.ResourceName)
+
+	e, ok = tr.Get("storage.googleapis.com", "GET", "/upload/storage/v1/b/bucket/o")
+	assert.True(t, ok)
+	assert.Equal(t, "storage", e.ResourceName)
+
+	_, ok = tr.Get("www.googleapis.com", "PATCH", "/storage/v1/b/bucket")
+	assert.False(t, ok)
+}
+
+func TestTreeAmbiguity(t *testing.T) {
+	get := Endpoint{
+		Hostname:     "www.googleapis.com",
+		HTTPMethod:   "GET",
+		PathTemplate: "/blogger/v3/blogs/{blogId}/posts/{postId}",
+		ServiceName:  "blogger",
+		ResourceName: "blogger.posts.get",
+	}
+	getByPath := Endpoint{
+		Hostname:     "www.googleapis.com",
+		HTTPMethod:   "GET",
+		PathTemplate: "/blogger/v3/blogs/{blogId}/posts/{path}",
+		ServiceName:  "blogger",
+		ResourceName: "blogger.posts.getByPath",
+	}
+	search := Endpoint{
+		Hostname:     "www.googleapis.com",
+		HTTPMethod:   "GET",
+		PathTemplate: "/blogger/v3/blogs/{blogId}/posts/search",
+		ServiceName:  "blogger",
+		ResourceName: "blogger.posts.search",
+	}
+	list := Endpoint{
+		Hostname:     "www.googleapis.com",
+		HTTPMethod:   "GET",
+		PathTemplate: "/blogger/v3/blogs/{blogId}/posts",
+		ServiceName:  "blogger",
+		ResourceName: "blogger.posts.list",
+	}
+
+	t.Run("none", func(t *testing.T) {
+		_, err := New(get, list, get)
+		assert.NoError(t, err)
+	})
+
+	t.Run("literal-precedence", func(t *testing.T) {
+		for _, es := range [][]Endpoint{{get, search}, {search, get}} {
+			tr, err := New(es...)
+			require.NoError(t, err)
+			e, ok := tr.Get("www.googleapis.com", "GET", "/blogger/v3/blogs/1234/posts/search")
+			assert.True(t, ok)
+			assert.Equal(t, "blogger.posts.search", e.ResourceName)
+			e, ok = tr.Get("www.googleapis.com", "GET", "/blogger/v3/blogs/1234/posts/5678")
+			assert.True(t, ok)
+			assert.Equal(t, "blogger.posts.get", e.ResourceName)
+		}
+	})
+
+	t.Run("overlap", func(t *testing.T) {
+		tr, err := New(getByPath, search, get, list)
+		var aerr *AmbiguityError
+		require.ErrorAs(t, err, &aerr)
+		require.Len(t, aerr.Conflicts, 1)
+		assert.Equal(t, "blogger.posts.getByPath", aerr.Conflicts[0][0].ResourceName)
+		assert.Equal(t, "blogger.posts.get", aerr.Conflicts[0][1].ResourceName)
+		assert.Equal(t, "1 ambiguous endpoints found, e.g. GET www.googleapis.com/blogger/v3/blogs/{blogId}/posts/{path} (blogger.posts.getByPath) and /blogger/v3/blogs/{blogId}/posts/{postId} (blogger.posts.get)", err.Error())
+
+		// the tree is still usable
+		require.NotNil(t, tr)
+		e, ok := tr.Get("www.googleapis.com", "GET", "/blogger/v3/blogs/1234/posts/5678")
+		assert.True(t, ok)
+		assert.Equal(t, "blogger.posts.getByPath", e.ResourceName)
+	})
+
+	t.Run("different-method", func(t *testing.T) {
+		post := get
+		post.HTTPMethod = "POST"
+		_, err := New(get, post)
+		assert.NoError(t, err)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		bad := get
+		bad.PathRegex = "^(/blogger$"
+		tr, err := New(bad)
+		assert.Error(t, err)
+		assert.Nil(t, tr)
+	})
+}
+
+func TestTreeHostCase(t *testing.T) {
+	tr, err := New(Endpoint{
+		Hostname:     "WWW.GoogleAPIs.com",
+		HTTPMethod:   "GET",
+		PathTemplate: "/blogger/v3/blogs/{blogId}",
+		ServiceName:  "blogger",
+		ResourceName: "blogger.blogs.get",
+	})
+	require.NoError(t, err)
+
+	for _, host := range []string{"www.googleapis.com", "WWW.GOOGLEAPIS.COM", "WWW.GoogleAPIs.com"} {
+		e, ok := tr.Get(host, "GET", "/blogger/v3/blogs/1234")
+		assert.True(t, ok, host)
+		assert.Equal(t, "blogger.blogs.get", e.ResourceName)
+	}
+	assert.Error(t, tr.Add(Endpoint{
+		Hostname:     "www.googleapis.com",
+		HTTPMethod:   "GET",
+		PathTemplate: "/blogger/v3/blogs/{blogId}",
+	}), "duplicate endpoint with a differently cased hostname")
+}
+
+func TestTreeServiceNameMapper(t *testing.T) {
+	tr, err := New(Endpoint{
+		Hostname:     "www.googleapis.com",
+		HTTPMethod:   "GET",
+		PathTemplate: "/blogger/v3/blogs/{blogId}",
+		ServiceName:  "blogger",
+		ResourceName: "blogger.blogs.get",
+	})
+	require.NoError(t, err)
+
+	tr.WithServiceNameMapper(func(e Endpoint) string {
+		return "acme-" + e.ServiceName
+	})
+	e, ok := tr.Get("www.googleapis.com", "GET", "/blogger/v3/blogs/1234")
+	assert.True(t, ok)
+	assert.Equal(t, "acme-blogger", e.ServiceName)
+	assert.Equal(t, "blogger.blogs.get", e.ResourceName)
+
+	e, params, ok := tr.GetWithParams("www.googleapis.com", "GET", "/blogger/v3/blogs/1234")
+	assert.True(t, ok)
+	assert.Equal(t, "acme-blogger", e.ServiceName)
+	assert.Equal(t, map[string]string{"blogId": "1234"}, params)
+
+	// the endpoints of the tree are left untouched
+	tr.WithServiceNameMapper(nil)
+	e, ok = tr.Get("www.googleapis.com", "GET", "/blogger/v3/blogs/1234")
+	assert.True(t, ok)
+	assert.Equal(t, "blogger", e.ServiceName)
+}
+
+func TestTreeQuery(t *testing.T) {
+	tr, err := New([]Endpoint{
+		{
+			Hostname:     "storage.googleapis.com",
+			HTTPMethod:   "GET",
+			PathTemplate: "/storage/v1/b/{bucket}/o/{object}",
+			ServiceName:  "google.storage",
+			ResourceName: "storage.objects.get",
+		},
+		{
+			Hostname:     "storage.googleapis.com",
+			HTTPMethod:   "GET",
+			PathTemplate: "/storage/v1/b/{bucket}/o/{object}",
+			QueryParams:  map[string]string{"alt": "media"},
+			ServiceName:  "google.storage",
+			ResourceName: "storage.objects.download",
+		},
+	}...)
+	require.NoError(t, err, "endpoints discriminated by their query parameters are not ambiguous")
+
+	const path = "/storage/v1/b/my-bucket/o/my-object"
+	for query, resource := range map[string]string{
+		"":                       "storage.objects.get",
+		"alt=json":               "storage.objects.get",
+		"alt=media":              "storage.objects.download",
+		"generation=2&alt=media": "storage.objects.download",
+		"alt=media&%zz":          "storage.objects.download",
+	} {
+		e, ok := tr.GetWithQuery("storage.googleapis.com", "GET", path, query)
+		assert.True(t, ok, query)
+		assert.Equal(t, resource, e.ResourceName, query)
+	}
+	e, ok := tr.Get("storage.googleapis.com", "GET", path)
+	assert.True(t, ok)
+	assert.Equal(t, "storage.objects.get", e.ResourceName)
+
+	err = tr.Add(Endpoint{
+		Hostname:     "storage.googleapis.com",
+		HTTPMethod:   "GET",
+		PathTemplate: "/storage/v1/b/{bucket}/o/{object}",
+		QueryParams:  map[string]string{"alt": "media"},
+	})
+	assert.Error(t, err)
+	err = tr.Add(Endpoint{
+		Hostname:     "storage.googleapis.com",
+		HTTPMethod:   "GET",
+		PathTemplate: "/storage/v1/b/{bucket}/o/{object}",
+		QueryParams:  map[string]string{"alt": "proto"},
+		ResourceName: "storage.objects.getProto",
+	})
+	assert.NoError(t, err)
+	e, ok = tr.GetWithQuery("storage.googleapis.com", "GET", path, "alt=proto")
+	assert.True(t, ok)
+	assert.Equal(t, "storage.objects.getProto", e.ResourceName)
+}
+
+func TestTreeAdd(t *testing.T) {
+	tr, err := New(Endpoint{
+		Hostname:     "www.googleapis.com",
+		HTTPMethod:   "GET",
+		PathTemplate: "/blogger/v3/blogs/{blogId}/pageviews",
+		ServiceName:  "blogger",
+		ResourceName: "blogger.pageViews.get",
+	})
+	require.NoError(t, err)
+
+	e := Endpoint{
+		Hostname:     "internal.googleapis.com",
+		HTTPMethod:   "GET",
+		PathTemplate: "/v1/widgets/{widgetId}",
+		ServiceName:  "google.internal",
+		ResourceName: "internal.widgets.get",
+	}
+	_, ok := tr.Get("internal.googleapis.com", "GET", "/v1/widgets/1234")
+	assert.False(t, ok)
+	require.NoError(t, tr.Add(e))
+	got, ok := tr.Get("internal.googleapis.com", "GET", "/v1/widgets/1234")
+	assert.True(t, ok)
+	assert.Equal(t, "internal.widgets.get", got.ResourceName)
+
+	t.Run("duplicate", func(t *testing.T) {
+		dup := e
+		dup.ResourceName = "internal.widgets.fetch"
+		assert.EqualError(t, tr.Add(dup), "endpoint GET internal.googleapis.com/v1/widgets/{widgetId} already exists (internal.widgets.get)")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		bad := e
+		bad.PathTemplate = "/v1/gadgets/{gadgetId}"
+		bad.PathRegex = "^(/v1/gadgets$"
+		assert.Error(t, tr.Add(bad))
+		_, ok := tr.Get("internal.googleapis.com", "GET", "/v1/gadgets/1234")
+		assert.False(t, ok)
+	})
+}
+
+func TestTreeCache(t *testing.T) {
+	tr, err := New([]Endpoint{
+		{
+			Hostname:     "storage.googleapis.com",
+			HTTPMethod:   "GET",
+			PathTemplate: "/storage/v1/b/{bucket}/o/{object}",
+			ServiceName:  "google.storage",
+			ResourceName: "storage.objects.get",
+		},
+		{
+			Hostname:     "storage.googleapis.com",
+			HTTPMethod:   "GET",
+			PathTemplate: "/storage/v1/b/{bucket}/o/{object}",
+			QueryParams:  map[string]string{"alt": "media"},
+			ServiceName:  "google.storage",
+			ResourceName: "storage.objects.download",
+		},
+	}...)
+	require.NoError(t, err)
+	tr.WithCache(2)
+
+	const path = "/storage/v1/b/my-bucket/o/my-object"
+	for i := 0; i < 2; i++ {
+		e, ok := tr.Get("storage.googleapis.com", "GET", path)
+		assert.True(t, ok)
+		assert.Equal(t, "storage.objects.get", e.ResourceName)
+		e, ok = tr.GetWithQuery("storage.googleapis.com", "GET", path, "alt=media&pageToken="+strconv.Itoa(i))
+		assert.True(t, ok)
+		assert.Equal(t, "storage.objects.download", e.ResourceName)
+	}
+	assert.Equal(t, 2, tr.cache.len(), "unrelated query parameters are not part of the cache key")
+
+	t.Run("params", func(t *testing.T) {
+		e, params, ok := tr.GetWithParams("STORAGE.googleapis.com", "GET", path)
+		assert.True(t, ok)
+		assert.Equal(t, "storage.objects.get", e.ResourceName)
+		assert.Equal(t, map[string]string{"bucket": "my-bucket", "object": "my-object"}, params)
+		assert.Equal(t, 2, tr.cache.len(), "hostnames are lowercased in the cache key")
+	})
+
+	t.Run("evict", func(t *testing.T) {
+		_, ok := tr.Get("storage.googleapis.com", "GET", "/storage/v1/b/my-bucket")
+		assert.False(t, ok)
+		assert.Equal(t, 2, tr.cache.len())
+		_, _, cached := tr.cache.get(cacheKey{host: "storage.googleapis.com", method: "GET", path: path})
+		assert.True(t, cached, "most recently used")
+		_, _, cached = tr.cache.get(cacheKey{host: "storage.googleapis.com", method: "GET", path: path, query: "alt=media&"})
+		assert.False(t, cached, "least recently used")
+	})
+
+	t.Run("add", func(t *testing.T) {
+		require.NoError(t, tr.Add(Endpoint{
+			Hostname:     "storage.googleapis.com",
+			HTTPMethod:   "GET",
+			PathTemplate: "/storage/v1/b/{bucket}",
+			ServiceName:  "google.storage",
+			ResourceName: "storage.buckets.get",
+		}))
+		assert.Equal(t, 0, tr.cache.len())
+		e, ok := tr.Get("storage.googleapis.com", "GET", "/storage/v1/b/my-bucket")
+		assert.True(t, ok, "cached misses are invalidated")
+		assert.Equal(t, "storage.buckets.get", e.ResourceName)
+
+		require.NoError(t, tr.Add(Endpoint{
+			Hostname:     "storage.googleapis.com",
+			HTTPMethod:   "GET",
+			PathTemplate: "/storage/v1/b/{bucket}/o/{object}",
+			QueryParams:  map[string]string{"projection": "full"},
+			ServiceName:  "google.storage",
+			ResourceName: "storage.objects.getFull",
+		}))
+		e, ok = tr.GetWithQuery("storage.googleapis.com", "GET", path, "projection=full")
+		assert.True(t, ok)
+		assert.Equal(t, "storage.objects.getFull", e.ResourceName)
+		e, ok = tr.GetWithQuery("storage.googleapis.com", "GET", path, "projection=noAcl")
+		assert.True(t, ok)
+		assert.Equal(t, "storage.objects.get", e.ResourceName)
+	})
+
+	t.Run("mapper", func(t *testing.T) {
+		tr.WithServiceNameMapper(func(e Endpoint) string {
+			return "acme-" + e.ServiceName
+		})
+		defer tr.WithServiceNameMapper(nil)
+		for i := 0; i < 2; i++ {
+			e, ok := tr.Get("storage.googleapis.com", "GET", path)
+			assert.True(t, ok)
+			assert.Equal(t, "acme-google.storage", e.ServiceName)
+		}
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		tr.WithCache(0)
+		assert.Nil(t, tr.cache)
+		e, ok := tr.Get("storage.googleapis.com", "GET", path)
+		assert.True(t, ok)
+		assert.Equal(t, "storage.objects.get", e.ResourceName)
+	})
+}
+
+func TestTreeDump(t *testing.T) {
+	es := []Endpoint{
+		{
+			Hostname:     "www.googleapis.com",
+			HTTPMethod:   "GET",
+			PathTemplate: "/blogger/v3/blogs/{blogId}/posts",
+			ServiceName:  "blogger",
+			ResourceName: "blogger.posts.list",
+		},
+		{
+			Hostname:     "www.googleapis.com",
+			HTTPMethod:   "GET",
+			PathTemplate: "/blogger/v3/blogs/{blogId}",
+			ServiceName:  "blogger",
+			ResourceName: "blogger.blogs.get",
+		},
+		{
+			Hostname:     "www.googleapis.com",
+			HTTPMethod:   "DELETE",
+			PathTemplate: "/blogger/v3/blogs/{blogId}/posts/{postId}",
+			ServiceName:  "blogger",
+			ResourceName: "blogger.posts.delete",
+		},
+		{
+			Hostname:     "storage.googleapis.com",
+			HTTPMethod:   "GET",
+			PathTemplate: "/storage/v1/b/{bucket}/o/{object}",
+			QueryParams:  map[string]string{"alt": "media"},
+			ServiceName:  "google.storage",
+			ResourceName: "storage.objects.download",
+		},
+	}
+	tr, err := New(es...)
+	require.NoError(t, err)
+	tr.WithServiceNameMapper(func(e Endpoint) string {
+		return "acme-" + e.ServiceName
+	})
+
+	var resources []string
+	for _, e := range tr.Dump("WWW.googleapis.com") {
+		assert.Equal(t, "blogger", e.ServiceName)
+		resources = append(resources, e.ResourceName)
+	}
+	assert.Equal(t, []string{"blogger.posts.delete", "blogger.blogs.get", "blogger.posts.list"}, resources)
+
+	dump := tr.Dump("storage.googleapis.com")
+	require.Len(t, dump, 1)
+	assert.Equal(t, "storage.objects.download", dump[0].ResourceName)
+	dump[0].QueryParams["alt"] = "json"
+	e, ok := tr.GetWithQuery("storage.googleapis.com", "GET", "/storage/v1/b/my-bucket/o/my-object", "alt=media")
+	assert.True(t, ok, "the dumped endpoints are copies")
+	assert.Equal(t, "storage.objects.download", e.ResourceName)
+
+	assert.Empty(t, tr.Dump("unknown.googleapis.com"))
+	var nilTree *Tree
+	assert.Empty(t, nilTree.Dump("www.googleapis.com"))
+}
+
+func BenchmarkTreeGet(b *testing.B) {
+	data, err := os.ReadFile("../../gen_endpoints.json")
+	require.NoError(b, err)
+	var es []Endpoint
+	require.NoError(b, json.Unmarshal(data, &es))
+	tr, err := New(es...)
+	if _, ok := err.(*AmbiguityError); !ok {
+		require.NoError(b, err)
+	}
+
+	for _, bm := range []struct {
+		name, host, method, path string
+		cache                    int
+	}{
+		{"hit", "compute.googleapis.com", "GET", "/compute/v1/projects/my-project/zones/us-east1-b/instances/my-instance", 0},
+		{"hit-reserved", "cloudresourcemanager.googleapis.com", "GET", "/v1/operations/my-operation", 0},
+		{"miss", "compute.googleapis.com", "GET", "/compute/v1/projects/my-project/unknown/my-resource", 0},
+		{"hit-cached", "compute.googleapis.com", "GET", "/compute/v1/projects/my-project/zones/us-east1-b/instances/my-instance", 128},
+		{"miss-cached", "compute.googleapis.com", "GET", "/compute/v1/projects/my-project/unknown/my-resource", 128},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			tr.WithCache(bm.cache)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				tr.Get(bm.host, bm.method, bm.path)
+			}
+		})
+	}
+}
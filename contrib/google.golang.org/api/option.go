@@ -18,6 +18,8 @@ type config struct {
 	analyticsRate            float64
 	scopes                   []string
 	endpointMetadataDisabled bool
+	endpointCacheSize        int
+	endpointCacheSizeSet     bool
 }
 
 func newConfig(options ...Option) *config {
@@ -94,3 +96,15 @@ func WithEndpointMetadataDisabled() Option {
 		cfg.endpointMetadataDisabled = true
 	}
 }
+
+// WithEndpointCacheSize sets the number of recent endpoint lookups which are
+// cached, so that the requests to the same endpoints don't need to match the
+// path regexes of the catalogue again. The cache is shared by all the traced
+// clients, so that the size of the last wrapped client applies. A size of zero
+// or less disables the cache. It defaults to 1024.
+func WithEndpointCacheSize(size int) Option {
+	return func(cfg *config) {
+		cfg.endpointCacheSize = size
+		cfg.endpointCacheSizeSet = true
+	}
+}
@@ -7,6 +7,9 @@ package grpc
 
 import (
 	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation"
@@ -23,24 +26,43 @@ import (
 // UnaryHandler wrapper to use when AppSec is enabled to monitor its execution.
 func appsecUnaryHandlerMiddleware(span ddtrace.Span, handler grpc.UnaryHandler) grpc.UnaryHandler {
 	instrumentation.SetAppSecEnabledTags(span)
-	return func(ctx context.Context, req interface{}) (interface{}, error) {
+	return func(ctx context.Context, req interface{}) (res interface{}, err error) {
 		md, _ := metadata.FromIncomingContext(ctx)
-		clientIP := setClientIP(ctx, span, md)
+		minimalTags := instrumentation.MinimalTags()
+		ipTags, clientIP := clientIPTags(ctx, md)
+		if !minimalTags {
+			instrumentation.SetStringTags(span, ipTags)
+		}
 		ctx, op := grpcsec.StartHandlerOperation(ctx, grpcsec.HandlerOperationArgs{Metadata: md, ClientIP: clientIP}, nil)
+		resMD := new(responseMetadata)
+		ctx = resMD.withTransportStream(ctx)
 		defer func() {
-			events := op.Finish(grpcsec.HandlerOperationRes{})
-			instrumentation.SetTags(span, op.Tags())
+			events, blockErr := finishHandlerOperation(op, resMD)
+			if blockErr != nil {
+				res, err = nil, blockErr
+			}
 			if len(events) == 0 {
+				if !minimalTags {
+					instrumentation.SetTags(span, op.Tags())
+					grpcsec.SetActionMetadataTags(span, op.ActionMetadata())
+				}
 				return
 			}
+			if minimalTags {
+				instrumentation.SetStringTags(span, ipTags)
+			}
+			instrumentation.SetTags(span, op.Tags())
+			grpcsec.SetActionMetadataTags(span, op.ActionMetadata())
 			setAppSecEventsTags(ctx, span, events)
 		}()
 
+		// The request message was already received when the handler is called,
+		// so the receive operation is also finished when the request is
+		// blocked, before the handler operation.
+		defer grpcsec.StartReceiveOperation(grpcsec.ReceiveOperationArgs{}, op).Finish(grpcsec.ReceiveOperationRes{Message: req})
 		if op.Error != nil {
 			return nil, op.Error
 		}
-
-		defer grpcsec.StartReceiveOperation(grpcsec.ReceiveOperationArgs{}, op).Finish(grpcsec.ReceiveOperationRes{Message: req})
 		return handler(ctx, req)
 	}
 }
@@ -48,23 +70,40 @@ func appsecUnaryHandlerMiddleware(span ddtrace.Span, handler grpc.UnaryHandler)
 // StreamHandler wrapper to use when AppSec is enabled to monitor its execution.
 func appsecStreamHandlerMiddleware(span ddtrace.Span, handler grpc.StreamHandler) grpc.StreamHandler {
 	instrumentation.SetAppSecEnabledTags(span)
-	return func(srv interface{}, stream grpc.ServerStream) error {
+	return func(srv interface{}, stream grpc.ServerStream) (err error) {
 		ctx := stream.Context()
 		md, _ := metadata.FromIncomingContext(ctx)
-		clientIP := setClientIP(ctx, span, md)
+		minimalTags := instrumentation.MinimalTags()
+		ipTags, clientIP := clientIPTags(ctx, md)
+		if !minimalTags {
+			instrumentation.SetStringTags(span, ipTags)
+		}
 
 		ctx, op := grpcsec.StartHandlerOperation(ctx, grpcsec.HandlerOperationArgs{Metadata: md, ClientIP: clientIP}, nil)
+		resMD := new(responseMetadata)
 		stream = appsecServerStream{
 			ServerStream:     stream,
 			handlerOperation: op,
-			ctx:              ctx,
+			ctx:              resMD.withTransportStream(ctx),
+			responseMetadata: resMD,
 		}
 		defer func() {
-			events := op.Finish(grpcsec.HandlerOperationRes{})
-			instrumentation.SetTags(span, op.Tags())
+			events, blockErr := finishHandlerOperation(op, resMD)
+			if blockErr != nil {
+				err = blockErr
+			}
 			if len(events) == 0 {
+				if !minimalTags {
+					instrumentation.SetTags(span, op.Tags())
+					grpcsec.SetActionMetadataTags(span, op.ActionMetadata())
+				}
 				return
 			}
+			if minimalTags {
+				instrumentation.SetStringTags(span, ipTags)
+			}
+			instrumentation.SetTags(span, op.Tags())
+			grpcsec.SetActionMetadataTags(span, op.ActionMetadata())
 			setAppSecEventsTags(stream.Context(), span, events)
 		}()
 
@@ -76,10 +115,25 @@ func appsecStreamHandlerMiddleware(span ddtrace.Span, handler grpc.StreamHandler
 	}
 }
 
+// finishHandlerOperation finishes the handler operation with the response
+// metadata set by the handler. Besides the security events, it returns the
+// error the handler must return when its response was blocked.
+func finishHandlerOperation(op *grpcsec.HandlerOperation, md *responseMetadata) ([]json.RawMessage, error) {
+	// The operation error is only replaced when the response is blocked by
+	// the finish event listeners.
+	opErr := op.Error
+	events := op.Finish(md.result())
+	if op.Error != opErr {
+		return events, op.Error
+	}
+	return events, nil
+}
+
 type appsecServerStream struct {
 	grpc.ServerStream
 	handlerOperation *grpcsec.HandlerOperation
 	ctx              context.Context
+	responseMetadata *responseMetadata
 }
 
 // RecvMsg implements grpc.ServerStream interface method to monitor its
@@ -96,20 +150,183 @@ func (ss appsecServerStream) Context() context.Context {
 	return ss.ctx
 }
 
+// SetHeader implements grpc.ServerStream interface method to monitor the
+// response headers with AppSec.
+func (ss appsecServerStream) SetHeader(md metadata.MD) error {
+	if err := ss.ServerStream.SetHeader(md); err != nil {
+		return err
+	}
+	ss.responseMetadata.addHeader(md)
+	return nil
+}
+
+// SendHeader implements grpc.ServerStream interface method to monitor the
+// response headers with AppSec.
+func (ss appsecServerStream) SendHeader(md metadata.MD) error {
+	if err := ss.ServerStream.SendHeader(md); err != nil {
+		return err
+	}
+	ss.responseMetadata.addHeader(md)
+	return nil
+}
+
+// SetTrailer implements grpc.ServerStream interface method to monitor the
+// response trailers with AppSec.
+func (ss appsecServerStream) SetTrailer(md metadata.MD) {
+	ss.ServerStream.SetTrailer(md)
+	ss.responseMetadata.addTrailer(md)
+}
+
+// responseMetadata holds the metadata set by a handler as the headers and
+// trailers of its response.
+type responseMetadata struct {
+	mu      sync.Mutex // guards header and trailer
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+func (m *responseMetadata) addHeader(md metadata.MD) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.header = metadata.Join(m.header, md)
+}
+
+func (m *responseMetadata) addTrailer(md metadata.MD) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.trailer = metadata.Join(m.trailer, md)
+}
+
+func (m *responseMetadata) result() grpcsec.HandlerOperationRes {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return grpcsec.HandlerOperationRes{Header: m.header, Trailer: m.trailer}
+}
+
+// withTransportStream returns a copy of ctx whose server transport stream
+// records the metadata set with grpc.SetHeader, grpc.SendHeader and
+// grpc.SetTrailer.
+func (m *responseMetadata) withTransportStream(ctx context.Context) context.Context {
+	ts := grpc.ServerTransportStreamFromContext(ctx)
+	if ts == nil {
+		return ctx
+	}
+	return grpc.NewContextWithServerTransportStream(ctx, appsecTransportStream{ServerTransportStream: ts, md: m})
+}
+
+// appsecTransportStream is a grpc.ServerTransportStream recording the response
+// metadata.
+type appsecTransportStream struct {
+	grpc.ServerTransportStream
+	md *responseMetadata
+}
+
+func (s appsecTransportStream) SetHeader(md metadata.MD) error {
+	if err := s.ServerTransportStream.SetHeader(md); err != nil {
+		return err
+	}
+	s.md.addHeader(md)
+	return nil
+}
+
+func (s appsecTransportStream) SendHeader(md metadata.MD) error {
+	if err := s.ServerTransportStream.SendHeader(md); err != nil {
+		return err
+	}
+	s.md.addHeader(md)
+	return nil
+}
+
+func (s appsecTransportStream) SetTrailer(md metadata.MD) error {
+	if err := s.ServerTransportStream.SetTrailer(md); err != nil {
+		return err
+	}
+	s.md.addTrailer(md)
+	return nil
+}
+
+// UnaryInvoker wrapper to use when AppSec is enabled to monitor the outgoing
+// RPCs. The RPC isn't sent when it is blocked.
+func appsecUnaryInvokerMiddleware(invoker grpc.UnaryInvoker) grpc.UnaryInvoker {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if err := protectClientCall(ctx, clientCallURL(cc, method), req); err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// Streamer wrapper to use when AppSec is enabled to monitor the outgoing
+// streams and the messages they send. The stream isn't created when it is
+// blocked, and blocked messages aren't sent.
+func appsecStreamerMiddleware(streamer grpc.Streamer) grpc.Streamer {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		url := clientCallURL(cc, method)
+		if err := protectClientCall(ctx, url, nil); err != nil {
+			return nil, err
+		}
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return appsecClientStream{ClientStream: stream, ctx: ctx, url: url}, nil
+	}
+}
+
+type appsecClientStream struct {
+	grpc.ClientStream
+	// ctx is the context the stream was created with, which holds the
+	// operation of the handler sending it.
+	ctx context.Context
+	url string
+}
+
+// SendMsg implements grpc.ClientStream interface method to monitor the
+// messages sent with AppSec.
+func (cs appsecClientStream) SendMsg(m interface{}) error {
+	if err := protectClientCall(cs.ctx, cs.url, m); err != nil {
+		return err
+	}
+	return cs.ClientStream.SendMsg(m)
+}
+
+// protectClientCall monitors the outgoing RPC to url, along with the message
+// m when it's not nil. It is a no-op when the context isn't the one of an
+// HTTP request or gRPC handler monitored by AppSec.
+func protectClientCall(ctx context.Context, url string, m interface{}) error {
+	if err := grpcsec.ProtectClientCall(ctx, grpcsec.ClientCallOperationArgs{URL: url, Message: m}); err != nil {
+		return err
+	}
+	// gRPC requests are HTTP/2 POST requests
+	return httpsec.ProtectRoundTrip(ctx, httpsec.RoundTripOperationArgs{URL: url, Method: http.MethodPost})
+}
+
+// clientCallURL returns the URL of the RPC to the given full method name sent
+// with cc, e.g. grpc://localhost:50051/package.Service/Method. The resolver
+// scheme of the target of cc is removed, if any.
+func clientCallURL(cc *grpc.ClientConn, method string) string {
+	var target string
+	if cc != nil {
+		target = cc.Target()
+		if _, after, ok := strings.Cut(target, ":///"); ok {
+			target = after
+		}
+	}
+	return "grpc://" + target + method
+}
+
 // Set the AppSec tags when security events were found.
 func setAppSecEventsTags(ctx context.Context, span ddtrace.Span, events []json.RawMessage) {
 	md, _ := metadata.FromIncomingContext(ctx)
 	grpcsec.SetSecurityEventTags(span, events, md)
 }
 
-func setClientIP(ctx context.Context, span ddtrace.Span, md metadata.MD) netip.Addr {
+// clientIPTags returns the client IP span tags and the client IP address of
+// the gRPC request.
+func clientIPTags(ctx context.Context, md metadata.MD) (map[string]string, netip.Addr) {
 	var remoteAddr string
 	if p, ok := peer.FromContext(ctx); ok {
 		remoteAddr = p.Addr.String()
 	}
-	ipTags, clientIP := httpsec.ClientIPTags(md, false, remoteAddr)
-	if len(ipTags) > 0 {
-		instrumentation.SetStringTags(span, ipTags)
-	}
-	return clientIP
+	return httpsec.ClientIPTags(md, false, remoteAddr)
 }
@@ -14,7 +14,10 @@ import (
 
 	pappsec "gopkg.in/DataDog/dd-trace-go.v1/appsec"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/grpcsec"
 
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
@@ -133,6 +136,9 @@ func TestBlocking(t *testing.T) {
 		event, _ := finished[0].Tag("_dd.appsec.json").(string)
 		require.NotNil(t, event)
 		require.True(t, strings.Contains(event, "blk-001-001"))
+		// The span should describe the rule which triggered the blocking
+		require.Equal(t, "blk-001-001", finished[0].Tag("appsec.action.rule.id"))
+		require.Equal(t, "block_ip", finished[0].Tag("appsec.action.rule.tags.type"))
 	})
 
 	t.Run("unary-no-block", func(t *testing.T) {
@@ -186,6 +192,74 @@ func TestBlocking(t *testing.T) {
 		require.NoError(t, err)
 	})
 
+	t.Run("unary-response-metadata-block", func(t *testing.T) {
+		for _, name := range []string{"leak-header", "leak-trailer"} {
+			t.Run(name, func(t *testing.T) {
+				mt := mocktracer.Start()
+				defer mt.Stop()
+
+				reply, err := client.Ping(context.Background(), &FixtureRequest{Name: name})
+				require.Nil(t, reply)
+				require.Equal(t, codes.Aborted, status.Code(err))
+
+				finished := mt.FinishedSpans()
+				require.Len(t, finished, 1)
+				event, _ := finished[0].Tag("_dd.appsec.json").(string)
+				require.True(t, strings.Contains(event, "blk-001-004"))
+				require.Equal(t, "blk-001-004", finished[0].Tag("appsec.action.rule.id"))
+			})
+		}
+	})
+
+	t.Run("stream-response-metadata-block", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		stream, err := client.StreamPing(context.Background())
+		require.NoError(t, err)
+		err = stream.Send(&FixtureRequest{Name: "leak-trailer"})
+		require.NoError(t, err)
+		// the reply is sent before the handler returns
+		reply, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, "passed", reply.Message)
+		err = stream.CloseSend()
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		require.Equal(t, codes.Aborted, status.Code(err))
+	})
+}
+
+// Test that the receive operation of a unary call blocked before calling its
+// handler is still finished, so that its request message can be monitored.
+func TestBlockedUnaryReceiveOperation(t *testing.T) {
+	var received interface{}
+	root := dyngo.NewRootOperation()
+	root.On(grpcsec.OnHandlerOperationStart(func(op *grpcsec.HandlerOperation, _ grpcsec.HandlerOperationArgs) {
+		op.Error = status.Error(codes.Aborted, "blocked")
+		op.On(grpcsec.OnReceiveOperationFinish(func(_ grpcsec.ReceiveOperation, res grpcsec.ReceiveOperationRes) {
+			received = res.Message
+		}))
+	}))
+	dyngo.SwapRootOperation(root)
+	defer dyngo.SwapRootOperation(nil)
+
+	mt := mocktracer.Start()
+	defer mt.Stop()
+	span := tracer.StartSpan("grpc.server")
+	defer span.Finish()
+
+	var called bool
+	handler := appsecUnaryHandlerMiddleware(span, func(ctx context.Context, req interface{}) (interface{}, error) {
+		called = true
+		return nil, nil
+	})
+	req := &FixtureRequest{Name: "blocked"}
+	res, err := handler(context.Background(), req)
+	require.Nil(t, res)
+	require.Equal(t, codes.Aborted, status.Code(err))
+	require.False(t, called)
+	require.Equal(t, req, received)
 }
 
 // Test that user blocking works by using custom rules/rules data
@@ -391,3 +465,89 @@ func (s *appsecFixtureServer) Ping(ctx context.Context, in *FixtureRequest) (*Fi
 
 	return s.s.Ping(ctx, in)
 }
+
+// Test that the outgoing RPCs sent by a gRPC handler are monitored
+func TestClientBlocking(t *testing.T) {
+	t.Setenv("DD_APPSEC_RULES", "../../../internal/appsec/testdata/blocking.json")
+	appsec.Start()
+	defer appsec.Stop()
+	if !appsec.Enabled() {
+		t.Skip("appsec disabled")
+	}
+
+	rig, err := newRig(false)
+	require.NoError(t, err)
+	defer rig.Close()
+	// connections are lazily established
+	metadataConn, err := grpc.Dial("169.254.169.254:80", grpc.WithInsecure())
+	require.NoError(t, err)
+	defer metadataConn.Close()
+
+	for _, tc := range []struct {
+		name    string
+		conn    *grpc.ClientConn
+		message string
+		blocked bool
+	}{
+		{name: "allowed", conn: rig.conn, message: "passed"},
+		{name: "url", conn: metadataConn, message: "passed", blocked: true},
+		{name: "message", conn: rig.conn, message: "exfiltrated-secret", blocked: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Run("unary", func(t *testing.T) {
+				ctx, op := grpcsec.StartHandlerOperation(context.Background(), grpcsec.HandlerOperationArgs{}, nil)
+				interceptor := UnaryClientInterceptor()
+				var called bool
+				invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+					called = true
+					return nil
+				}
+				err := interceptor(ctx, "/grpc.Fixture/Ping", &FixtureRequest{Name: tc.message}, new(FixtureReply), tc.conn, invoker)
+				events := op.Finish(grpcsec.HandlerOperationRes{})
+				if !tc.blocked {
+					require.NoError(t, err)
+					require.True(t, called)
+					require.Empty(t, events)
+					return
+				}
+				require.Equal(t, codes.Aborted, status.Code(err))
+				require.False(t, called)
+				require.Len(t, events, 1)
+				require.Contains(t, string(events[0]), "blk-001-005")
+			})
+
+			t.Run("stream", func(t *testing.T) {
+				// the stream span is finished once the context is done
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				ctx, op := grpcsec.StartHandlerOperation(ctx, grpcsec.HandlerOperationArgs{}, nil)
+				interceptor := StreamClientInterceptor()
+				stream, err := interceptor(ctx, &grpc.StreamDesc{ClientStreams: true}, tc.conn, "/grpc.Fixture/StreamPing",
+					func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+						return fakeClientStream{ctx: ctx}, nil
+					})
+				if err == nil {
+					err = stream.SendMsg(&FixtureRequest{Name: tc.message})
+				}
+				events := op.Finish(grpcsec.HandlerOperationRes{})
+				if !tc.blocked {
+					require.NoError(t, err)
+					require.Empty(t, events)
+					return
+				}
+				require.Equal(t, codes.Aborted, status.Code(err))
+				require.Len(t, events, 1)
+				require.Contains(t, string(events[0]), "blk-001-005")
+			})
+		})
+	}
+}
+
+// fakeClientStream is a grpc.ClientStream sending its messages nowhere.
+type fakeClientStream struct {
+	grpc.ClientStream
+	ctx context.Context
+}
+
+func (s fakeClientStream) Context() context.Context    { return s.ctx }
+func (s fakeClientStream) SendMsg(m interface{}) error { return nil }
@@ -12,6 +12,7 @@ import (
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 
 	context "golang.org/x/net/context"
@@ -80,6 +81,9 @@ func StreamClientInterceptor(opts ...Option) grpc.StreamClientInterceptor {
 	}
 	log.Debug("contrib/google.golang.org/grpc: Configuring StreamClientInterceptor: %#v", cfg)
 	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if appsec.Enabled() {
+			streamer = appsecStreamerMiddleware(streamer)
+		}
 		var methodKind string
 		if desc != nil {
 			switch {
@@ -151,6 +155,9 @@ func UnaryClientInterceptor(opts ...Option) grpc.UnaryClientInterceptor {
 	}
 	log.Debug("contrib/google.golang.org/grpc: Configuring UnaryClientInterceptor: %#v", cfg)
 	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if appsec.Enabled() {
+			invoker = appsecUnaryInvokerMiddleware(invoker)
+		}
 		if _, ok := cfg.untracedMethods[method]; ok {
 			return invoker(ctx, method, req, reply, cc, opts...)
 		}
@@ -577,6 +577,10 @@ func (s *fixtureServer) Ping(ctx context.Context, in *FixtureRequest) (*FixtureR
 		return &FixtureReply{Message: "disabled"}, nil
 	case in.Name == "invalid":
 		return nil, status.Error(codes.InvalidArgument, "invalid")
+	case in.Name == "leak-header":
+		grpc.SetHeader(ctx, metadata.Pairs("x-secret", "leaked-secret"))
+	case in.Name == "leak-trailer":
+		grpc.SetTrailer(ctx, metadata.Pairs("x-secret", "leaked-secret"))
 	}
 	return &FixtureReply{Message: "passed"}, nil
 }
@@ -15,6 +15,8 @@ import (
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/httpsec"
 )
 
 type roundTripper struct {
@@ -66,6 +68,16 @@ func (rt *roundTripper) RoundTrip(req *http.Request) (res *http.Response, err er
 	if rt.cfg.before != nil {
 		rt.cfg.before(req, span)
 	}
+	if appsec.Enabled() {
+		// The outgoing request is not sent when AppSec blocks it, but its
+		// body must still be closed as required by http.RoundTripper.
+		if err = httpsec.ProtectRoundTrip(ctx, httpsec.RoundTripOperationArgs{URL: url.String(), Method: req.Method}); err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, err
+		}
+	}
 	r2 := req.Clone(ctx)
 	// inject the span context into the http request copy
 	err = tracer.Inject(span.Context(), tracer.HTTPHeadersCarrier(r2.Header))
@@ -94,6 +94,29 @@ type SpanContext interface {
 	ForeachBaggageItem(handler func(k, v string) bool)
 }
 
+// SpanLink represents a reference from a span to another span, which isn't its
+// parent. The linked span may belong to another trace.
+type SpanLink struct {
+	// TraceID is the lower 64 bits of the trace ID of the linked span.
+	TraceID uint64
+
+	// TraceIDHigh is the upper 64 bits of the trace ID of the linked span,
+	// or zero when using 64-bit trace IDs.
+	TraceIDHigh uint64
+
+	// SpanID is the ID of the linked span.
+	SpanID uint64
+
+	// Attributes describes the relationship with the linked span.
+	Attributes map[string]string
+
+	// Tracestate is the W3C tracestate of the linked span, if any.
+	Tracestate string
+
+	// Flags holds the W3C trace flags of the linked span, if any.
+	Flags uint32
+}
+
 // StartSpanOption is a configuration option that can be used with a Tracer's StartSpan method.
 type StartSpanOption func(cfg *StartSpanConfig)
 
@@ -142,6 +165,10 @@ type StartSpanConfig struct {
 	// TraceID to the same value.
 	SpanID uint64
 
+	// TraceID will be the TraceID of the Span, overriding the SpanID or random number
+	// that would be used otherwise. It has no effect when a Parent SpanContext is present.
+	TraceID uint64
+
 	// Context is the parent context where the span should be stored.
 	Context context.Context
 }
@@ -84,4 +84,7 @@ const (
 
 	// CassandraContactPoints holds the list of cassandra initial seed nodes used to discover the cluster.
 	CassandraContactPoints = "db.cassandra.contact.points"
+
+	// CassandraPrepared specifies the tag name for queries executed as prepared statements.
+	CassandraPrepared = "cassandra.prepared"
 )
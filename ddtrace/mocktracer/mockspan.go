@@ -71,7 +71,11 @@ func newSpan(t *mocktracer, operationName string, cfg *ddtrace.StartSpanConfig)
 	if id == 0 {
 		id = nextID()
 	}
-	s.context = &spanContext{spanID: id, traceID: id, span: s}
+	traceID := cfg.TraceID
+	if traceID == 0 {
+		traceID = id
+	}
+	s.context = &spanContext{spanID: id, traceID: traceID, span: s}
 	if ctx, ok := cfg.Parent.(*spanContext); ok {
 		if ctx.span != nil && s.tags[ext.ServiceName] == nil {
 			// if we have a local parent and no service, inherit the parent's
@@ -200,6 +200,14 @@ func TestSpanWithID(t *testing.T) {
 	assert.Equal(spanID, span.Context().SpanID())
 }
 
+func TestSpanWithTraceID(t *testing.T) {
+	span := newMockTracer().StartSpan("", tracer.WithSpanID(1), tracer.WithTraceID(2))
+
+	assert := assert.New(t)
+	assert.Equal(uint64(1), span.Context().SpanID())
+	assert.Equal(uint64(2), span.Context().TraceID())
+}
+
 func TestSetUser(t *testing.T) {
 	const (
 		id        = "john.doe#12345"
@@ -0,0 +1,125 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"sync"
+	"time"
+)
+
+// breakerState is the state of a circuitBreaker.
+type breakerState int
+
+const (
+	// breakerClosed is the state where the payloads are sent to the agent.
+	breakerClosed breakerState = iota
+	// breakerOpen is the state where the payloads are dropped without being
+	// sent, until the cool-down window elapses.
+	breakerOpen
+	// breakerHalfOpen is the state where a single payload is sent to the
+	// agent to probe its recovery.
+	breakerHalfOpen
+)
+
+// circuitBreaker stops sending payloads to the agent after consecutive send
+// failures. It opens after threshold consecutive failures and drops the
+// payloads for the cool-down duration, after which it half-opens to let a
+// single payload probe the agent: the breaker closes if it is sent, and opens
+// again otherwise. A nil circuitBreaker is always closed.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	clock     clock
+
+	mu       sync.Mutex // guards the fields below
+	st       breakerState
+	failures int       // consecutive failures
+	openedAt time.Time // time at which the breaker last opened
+}
+
+// newCircuitBreaker returns a circuitBreaker opening after threshold
+// consecutive failures, for the given cool-down duration measured with clk. It
+// returns nil when threshold is not positive, disabling the circuit breaking.
+func newCircuitBreaker(threshold int, cooldown time.Duration, clk clock) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		clock:     clk,
+	}
+}
+
+// open reports whether the breaker is open and its cool-down window hasn't
+// elapsed yet, in which case the traces must be dropped without being
+// encoded.
+func (b *circuitBreaker) open() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.st == breakerOpen && b.clock.now().Sub(b.openedAt) < b.cooldown
+}
+
+// allow reports whether a payload can be sent. Once the cool-down window
+// elapsed, the breaker half-opens and allows a single payload until the
+// outcome of its sending is reported with success or failure.
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.st {
+	case breakerOpen:
+		if b.clock.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.st = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// the probing payload is being sent
+		return false
+	default:
+		return true
+	}
+}
+
+// success reports that a payload was sent, closing the breaker.
+func (b *circuitBreaker) success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.st, b.failures = breakerClosed, 0
+}
+
+// failure reports that a payload couldn't be sent, opening the breaker when
+// the failures threshold is reached or when probing the agent failed.
+func (b *circuitBreaker) failure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.st == breakerHalfOpen || b.failures >= b.threshold {
+		b.st, b.openedAt = breakerOpen, b.clock.now()
+	}
+}
+
+// state returns the current state of the breaker.
+func (b *circuitBreaker) state() breakerState {
+	if b == nil {
+		return breakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.st
+}
@@ -0,0 +1,64 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		b := newCircuitBreaker(0, time.Minute, systemClock{})
+		assert.Nil(t, b)
+		for i := 0; i < 10; i++ {
+			b.failure()
+		}
+		assert.False(t, b.open())
+		assert.True(t, b.allow())
+		assert.Equal(t, breakerClosed, b.state())
+	})
+
+	t.Run("states", func(t *testing.T) {
+		assert := assert.New(t)
+		clock := newFakeClock()
+		b := newCircuitBreaker(3, time.Minute, clock)
+
+		// non-consecutive failures don't open the breaker
+		b.failure()
+		b.failure()
+		b.success()
+		b.failure()
+		b.failure()
+		assert.Equal(breakerClosed, b.state())
+		assert.True(b.allow())
+
+		b.failure()
+		assert.Equal(breakerOpen, b.state())
+		assert.True(b.open())
+		assert.False(b.allow())
+
+		// the agent is probed once the cool-down window elapsed
+		clock.advance(time.Minute)
+		assert.False(b.open())
+		assert.True(b.allow())
+		assert.Equal(breakerHalfOpen, b.state())
+		assert.False(b.allow())
+
+		// the failed probe opens the breaker again
+		b.failure()
+		assert.Equal(breakerOpen, b.state())
+		assert.False(b.allow())
+
+		clock.advance(time.Minute)
+		assert.True(b.allow())
+		b.success()
+		assert.Equal(breakerClosed, b.state())
+		assert.True(b.allow())
+	})
+}
@@ -0,0 +1,24 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import "time"
+
+// clock provides the time to the components sending payloads to the agent,
+// allowing tests to control the passing of time.
+type clock interface {
+	// now returns the current time.
+	now() time.Time
+	// sleep pauses the current goroutine for at least the duration d.
+	sleep(d time.Duration)
+}
+
+// systemClock is the clock of the system.
+type systemClock struct{}
+
+func (systemClock) now() time.Time { return time.Now() }
+
+func (systemClock) sleep(d time.Duration) { time.Sleep(d) }
@@ -60,3 +60,14 @@ func StartSpanFromContext(ctx context.Context, operationName string, opts ...Sta
 	}
 	return s, ContextWithSpan(ctx, s)
 }
+
+// InjectFromContext injects the context of the span found in ctx into the
+// carrier, using the global tracer. It returns ErrSpanContextNotFound if ctx
+// holds no span.
+func InjectFromContext(ctx context.Context, carrier interface{}) error {
+	s, ok := SpanFromContext(ctx)
+	if !ok {
+		return ErrSpanContextNotFound
+	}
+	return Inject(s.Context(), carrier)
+}
@@ -9,6 +9,7 @@ import (
 	"context"
 	"encoding/binary"
 	"encoding/hex"
+	"strconv"
 	"testing"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
@@ -162,3 +163,20 @@ func TestStartSpanFromNilContext(t *testing.T) {
 	assert.True(ok)
 	assert.Equal(child, ctxSpan)
 }
+
+func TestInjectFromContext(t *testing.T) {
+	_, _, _, stop := startTestTracer(t)
+	defer stop()
+	assert := assert.New(t)
+
+	s, ctx := StartSpanFromContext(context.Background(), "http.request")
+	carrier := TextMapCarrier{}
+	assert.NoError(InjectFromContext(ctx, carrier))
+	assert.Equal(strconv.FormatUint(s.Context().TraceID(), 10), carrier[DefaultTraceIDHeader])
+	assert.Equal(strconv.FormatUint(s.Context().SpanID(), 10), carrier[DefaultParentIDHeader])
+
+	carrier = TextMapCarrier{}
+	assert.Equal(ErrSpanContextNotFound, InjectFromContext(context.Background(), carrier))
+	assert.Equal(ErrSpanContextNotFound, InjectFromContext(nil, carrier))
+	assert.Empty(carrier)
+}
@@ -0,0 +1,200 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/samplernames"
+)
+
+// DefaultJSONPropagatorKey specifies the key that will be used by the JSON
+// propagator to store the span context when no key is given.
+const DefaultJSONPropagatorKey = "_datadog"
+
+// NewJSONPropagator returns a new propagator which stores the whole span
+// context (IDs, sampling priority, origin, baggage and propagating tags) as a
+// single JSON document under the given key of TextMap carriers. It is meant for
+// transports which carry a single opaque string field rather than a set of
+// headers. If key is empty, DefaultJSONPropagatorKey is used.
+func NewJSONPropagator(key string) Propagator {
+	if key == "" {
+		key = DefaultJSONPropagatorKey
+	}
+	return &propagatorJSON{key: key}
+}
+
+// propagatorJSON implements Propagator and injects/extracts span contexts
+// as a JSON document stored under a single key. Only TextMap carriers are
+// supported.
+type propagatorJSON struct {
+	key string
+}
+
+// jsonSpanContext is the JSON representation of a span context. IDs are
+// encoded as decimal strings, to avoid losing precision with JSON parsers
+// using floating point numbers.
+type jsonSpanContext struct {
+	TraceID          string            `json:"trace_id"`
+	SpanID           string            `json:"span_id"`
+	SamplingPriority *int              `json:"sampling_priority,omitempty"`
+	Origin           string            `json:"origin,omitempty"`
+	Baggage          map[string]string `json:"baggage,omitempty"`
+	Tags             map[string]string `json:"tags,omitempty"`
+}
+
+func (p *propagatorJSON) Inject(spanCtx ddtrace.SpanContext, carrier interface{}) error {
+	switch c := carrier.(type) {
+	case TextMapWriter:
+		return p.injectTextMap(spanCtx, c)
+	default:
+		return ErrInvalidCarrier
+	}
+}
+
+func (p *propagatorJSON) injectTextMap(spanCtx ddtrace.SpanContext, writer TextMapWriter) error {
+	jctx, err := newJSONSpanContext(spanCtx)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(jctx)
+	if err != nil {
+		return err
+	}
+	writer.Set(p.key, string(b))
+	return nil
+}
+
+// newJSONSpanContext returns the JSON representation of the given span context.
+func newJSONSpanContext(spanCtx ddtrace.SpanContext) (jsonSpanContext, error) {
+	ctx, ok := spanCtx.(*spanContext)
+	if !ok || ctx.traceID.Empty() || ctx.spanID == 0 {
+		return jsonSpanContext{}, ErrInvalidSpanContext
+	}
+	if ctx.traceID.HasUpper() {
+		setPropagatingTag(ctx, keyTraceID128, ctx.traceID.UpperHex())
+	} else if ctx.trace != nil {
+		ctx.trace.unsetPropagatingTag(keyTraceID128)
+	}
+	jctx := jsonSpanContext{
+		TraceID: strconv.FormatUint(ctx.traceID.Lower(), 10),
+		SpanID:  strconv.FormatUint(ctx.spanID, 10),
+		Origin:  ctx.origin,
+	}
+	if sp, ok := ctx.samplingPriority(); ok {
+		jctx.SamplingPriority = &sp
+	}
+	ctx.ForeachBaggageItem(func(k, v string) bool {
+		if jctx.Baggage == nil {
+			jctx.Baggage = make(map[string]string)
+		}
+		jctx.Baggage[k] = v
+		return true
+	})
+	if ctx.trace != nil {
+		ctx.trace.iteratePropagatingTags(func(k, v string) bool {
+			if !strings.HasPrefix(k, "_dd.p.") {
+				return true
+			}
+			if jctx.Tags == nil {
+				jctx.Tags = make(map[string]string)
+			}
+			jctx.Tags[k] = v
+			return true
+		})
+	}
+	return jctx, nil
+}
+
+func (p *propagatorJSON) Extract(carrier interface{}) (ddtrace.SpanContext, error) {
+	switch c := carrier.(type) {
+	case TextMapReader:
+		return p.extractTextMap(c)
+	default:
+		return nil, ErrInvalidCarrier
+	}
+}
+
+func (p *propagatorJSON) extractTextMap(reader TextMapReader) (ddtrace.SpanContext, error) {
+	var (
+		jctx  jsonSpanContext
+		found bool
+	)
+	err := reader.ForeachKey(func(k, v string) error {
+		if k != p.key {
+			return nil
+		}
+		found = true
+		if err := json.Unmarshal([]byte(v), &jctx); err != nil {
+			return ErrSpanContextCorrupted
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrSpanContextNotFound
+	}
+	ctx, err := jctx.spanContext()
+	if err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
+
+// spanContext returns the span context represented by jctx.
+func (jctx *jsonSpanContext) spanContext() (*spanContext, error) {
+	var ctx spanContext
+	lowerTid, err := parseUint64(jctx.TraceID)
+	if err != nil {
+		return nil, ErrSpanContextCorrupted
+	}
+	ctx.traceID.SetLower(lowerTid)
+	if ctx.spanID, err = parseUint64(jctx.SpanID); err != nil {
+		return nil, ErrSpanContextCorrupted
+	}
+	if sp := jctx.SamplingPriority; sp != nil {
+		if !validPriority(*sp) {
+			return nil, ErrSpanContextCorrupted
+		}
+		ctx.setSamplingPriority(*sp, samplernames.Unknown)
+	}
+	ctx.origin = jctx.Origin
+	for k, v := range jctx.Baggage {
+		ctx.setBaggageItem(k, v)
+	}
+	if len(jctx.Tags) > 0 {
+		tags := make(map[string]string, len(jctx.Tags))
+		for k, v := range jctx.Tags {
+			if !strings.HasPrefix(k, "_dd.p.") {
+				continue
+			}
+			tags[k] = v
+		}
+		if ctx.trace == nil {
+			ctx.trace = newTrace()
+		}
+		ctx.trace.replacePropagatingTags(tags)
+		if tid, ok := tags[keyTraceID128]; ok {
+			if err := validateTID(tid); err != nil {
+				log.Debug("Invalid hex traceID: %s", err)
+				ctx.trace.unsetPropagatingTag(keyTraceID128)
+			} else if err := ctx.traceID.SetUpperFromHex(tid); err != nil {
+				log.Debug("Attempted to set an invalid hex traceID: %s", err)
+				ctx.trace.unsetPropagatingTag(keyTraceID128)
+			}
+		}
+	}
+	if ctx.traceID.Empty() || (ctx.spanID == 0 && !strings.HasPrefix(ctx.origin, "synthetics")) {
+		return nil, ErrSpanContextNotFound
+	}
+	return &ctx, nil
+}
@@ -0,0 +1,84 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONPropagatorRoundTrip(t *testing.T) {
+	t.Setenv("DD_TRACE_128_BIT_TRACEID_GENERATION_ENABLED", "true")
+	tracer := newTracer(WithPropagator(NewJSONPropagator("")))
+	defer tracer.Stop()
+	assert := assert.New(t)
+
+	root := tracer.StartSpan("web.request", Tag(ext.ManualKeep, true)).(*span)
+	root.SetBaggageItem("item", "x")
+	root.context.origin = "synthetics"
+	root.context.trace.setPropagatingTag("_dd.p.usr.id", "dXNlcg==")
+
+	carrier := TextMapCarrier{}
+	assert.NoError(tracer.Inject(root.Context(), carrier))
+	assert.Len(carrier, 1)
+	assert.Contains(carrier, DefaultJSONPropagatorKey)
+
+	ctx, err := tracer.Extract(carrier)
+	assert.NoError(err)
+	sctx := ctx.(*spanContext)
+	assert.Equal(root.context.traceID, sctx.traceID)
+	assert.Equal(root.SpanID, sctx.spanID)
+	p, ok := sctx.samplingPriority()
+	assert.True(ok)
+	assert.Equal(ext.PriorityUserKeep, p)
+	assert.Equal("synthetics", sctx.origin)
+	assert.Equal("x", sctx.baggageItem("item"))
+	assert.Equal("dXNlcg==", sctx.trace.propagatingTag("_dd.p.usr.id"))
+	assert.Equal("-4", sctx.trace.propagatingTag(keyDecisionMaker))
+}
+
+func TestJSONPropagatorKey(t *testing.T) {
+	p := NewJSONPropagator("ctx")
+	carrier := TextMapCarrier{}
+	assert.NoError(t, p.Inject(&spanContext{traceID: traceIDFrom64Bits(1), spanID: 2}, carrier))
+	assert.Equal(t, TextMapCarrier{"ctx": `{"trace_id":"1","span_id":"2"}`}, carrier)
+
+	ctx, err := p.Extract(carrier)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), ctx.TraceID())
+	assert.Equal(t, uint64(2), ctx.SpanID())
+
+	_, err = NewJSONPropagator("").Extract(carrier)
+	assert.Equal(t, ErrSpanContextNotFound, err)
+}
+
+func TestJSONPropagatorErrors(t *testing.T) {
+	p := NewJSONPropagator("")
+	assert := assert.New(t)
+
+	assert.Equal(ErrInvalidCarrier, p.Inject(&spanContext{}, 2))
+	assert.Equal(ErrInvalidSpanContext, p.Inject(&spanContext{}, TextMapCarrier{}))
+	_, err := p.Extract(2)
+	assert.Equal(ErrInvalidCarrier, err)
+
+	for _, tc := range []struct {
+		in  string
+		err error
+	}{
+		{in: `not json`, err: ErrSpanContextCorrupted},
+		{in: `{"trace_id":"A","span_id":"2"}`, err: ErrSpanContextCorrupted},
+		{in: `{"trace_id":"1","span_id":"B"}`, err: ErrSpanContextCorrupted},
+		{in: `{"trace_id":"1","span_id":"2","sampling_priority":3}`, err: ErrSpanContextCorrupted},
+		{in: `{"trace_id":"0","span_id":"0"}`, err: ErrSpanContextNotFound},
+		{in: `{"trace_id":"1","span_id":"0"}`, err: ErrSpanContextNotFound},
+	} {
+		_, err := p.Extract(TextMapCarrier{DefaultJSONPropagatorKey: tc.in})
+		assert.Equal(tc.err, err, tc.in)
+	}
+}
@@ -0,0 +1,62 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+)
+
+// spanContextFormatVersion is the version of the serialization format of the
+// span contexts produced by MarshalSpanContext. It must be incremented on any
+// breaking change of the format, UnmarshalSpanContext supporting all of them.
+const spanContextFormatVersion = 1
+
+// marshaledSpanContext is the versioned serialization format of span contexts.
+type marshaledSpanContext struct {
+	Version int `json:"version"`
+	jsonSpanContext
+}
+
+// MarshalSpanContext serializes the given span context, i.e. its IDs, sampling
+// priority, origin, baggage and propagating tags, into a stable and versioned
+// format. It allows persisting the span context, e.g. in a database row, to
+// continue the trace later with UnmarshalSpanContext, such as in long-running
+// workflows. The span context must be one of this package.
+func MarshalSpanContext(ctx ddtrace.SpanContext) ([]byte, error) {
+	jctx, err := newJSONSpanContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(marshaledSpanContext{
+		Version:         spanContextFormatVersion,
+		jsonSpanContext: jctx,
+	})
+}
+
+// UnmarshalSpanContext deserializes a span context serialized with
+// MarshalSpanContext, which can then be used as the parent of new spans with
+// ChildOf. ErrSpanContextCorrupted is returned when data is malformed.
+func UnmarshalSpanContext(data []byte) (ddtrace.SpanContext, error) {
+	var mctx marshaledSpanContext
+	if err := json.Unmarshal(data, &mctx); err != nil {
+		return nil, ErrSpanContextCorrupted
+	}
+	if mctx.Version != spanContextFormatVersion {
+		return nil, fmt.Errorf("unsupported span context format version %d", mctx.Version)
+	}
+	ctx, err := mctx.spanContext()
+	if err == ErrSpanContextNotFound {
+		// the IDs are missing
+		return nil, ErrSpanContextCorrupted
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
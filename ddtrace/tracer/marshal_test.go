@@ -0,0 +1,74 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalSpanContext(t *testing.T) {
+	t.Run("round-trip", func(t *testing.T) {
+		tracer := newTracer()
+		defer tracer.Stop()
+		root := tracer.StartSpan("workflow.start")
+		root.SetBaggageItem("workflow", "42")
+		root.SetTag(ext.ManualKeep, true)
+		sctx := root.Context().(*spanContext)
+		sctx.origin = "synthetics"
+		sctx.traceID.SetUpper(0x1234)
+		setPropagatingTag(sctx, "_dd.p.usr", "abc")
+
+		data, err := MarshalSpanContext(sctx)
+		require.NoError(t, err)
+		root.Finish()
+
+		ctx, err := UnmarshalSpanContext(data)
+		require.NoError(t, err)
+		got := ctx.(*spanContext)
+		assert.Equal(t, sctx.traceID, got.traceID)
+		assert.Equal(t, sctx.spanID, got.spanID)
+		assert.Equal(t, "synthetics", got.origin)
+		assert.Equal(t, "42", got.baggageItem("workflow"))
+		p, ok := got.samplingPriority()
+		assert.True(t, ok)
+		assert.Equal(t, ext.PriorityUserKeep, p)
+		assert.Equal(t, "abc", got.trace.propagatingTag("_dd.p.usr"))
+
+		// the trace can be continued
+		child := tracer.StartSpan("workflow.resume", ChildOf(ctx)).(*span)
+		assert.Equal(t, sctx.spanID, child.ParentID)
+		assert.Equal(t, sctx.traceID.Lower(), child.TraceID)
+		child.Finish()
+	})
+
+	t.Run("invalid-context", func(t *testing.T) {
+		_, err := MarshalSpanContext(&spanContext{})
+		assert.Equal(t, ErrInvalidSpanContext, err)
+	})
+
+	t.Run("corrupted", func(t *testing.T) {
+		for _, data := range []string{
+			``,
+			`{`,
+			`{"version":1}`,
+			`{"version":1,"trace_id":"abc","span_id":"1"}`,
+			`{"version":1,"trace_id":"1","span_id":"1","sampling_priority":5}`,
+		} {
+			_, err := UnmarshalSpanContext([]byte(data))
+			assert.Equal(t, ErrSpanContextCorrupted, err, data)
+		}
+	})
+
+	t.Run("unsupported-version", func(t *testing.T) {
+		_, err := UnmarshalSpanContext([]byte(`{"version":2,"trace_id":"1","span_id":"1"}`))
+		assert.EqualError(t, err, "unsupported span context format version 2")
+	})
+}
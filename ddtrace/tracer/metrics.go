@@ -23,6 +23,7 @@ type statsdClient interface {
 	Count(name string, value int64, tags []string, rate float64) error
 	Gauge(name string, value float64, tags []string, rate float64) error
 	Timing(name string, value time.Duration, tags []string, rate float64) error
+	Distribution(name string, value float64, tags []string, rate float64) error
 	Flush() error
 	Close() error
 }
@@ -103,6 +104,12 @@ func (t *tracer) reportHealthMetrics(interval time.Duration) {
 			t.statsd.Count("datadog.tracer.spans_started", int64(atomic.SwapUint32(&t.spansStarted, 0)), nil, 1)
 			t.statsd.Count("datadog.tracer.spans_finished", int64(atomic.SwapUint32(&t.spansFinished, 0)), nil, 1)
 			t.statsd.Count("datadog.tracer.traces_dropped", int64(atomic.SwapUint32(&t.tracesDropped, 0)), []string{"reason:trace_too_large"}, 1)
+			if p, ok := t.config.propagator.(*chainedPropagator); ok {
+				p.reportExtractMetrics(t.statsd)
+			}
+			if w, ok := t.traceWriter.(*agentTraceWriter); ok && w.breaker != nil {
+				t.statsd.Gauge("datadog.tracer.circuit_breaker.state", float64(w.breaker.state()), nil, 1)
+			}
 		case <-t.stop:
 			return
 		}
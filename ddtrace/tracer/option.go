@@ -7,7 +7,9 @@ package tracer
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"net"
@@ -66,6 +68,23 @@ type config struct {
 	// failure.
 	sendRetries int
 
+	// breakerThreshold is the number of consecutive payload send failures
+	// after which the agent circuit breaker opens. Circuit breaking is
+	// disabled when it is zero.
+	breakerThreshold int
+
+	// breakerCooldown is the duration during which the agent circuit breaker
+	// stays open before probing the agent again.
+	breakerCooldown time.Duration
+
+	// clock provides the time when sending payloads to the agent, for the
+	// retries and the circuit breaker; replaced in tests.
+	clock clock
+
+	// maxPayloadSize is the maximum size in bytes of the trace payloads sent to
+	// the agent. Larger traces are split into several chunks.
+	maxPayloadSize int
+
 	// logStartup, when true, causes various startup info to be written
 	// when the tracer starts.
 	logStartup bool
@@ -89,6 +108,10 @@ type config struct {
 	// agentURL is the agent URL that receives traces from the tracer.
 	agentURL *url.URL
 
+	// agentPathPrefix, when non-empty, is prepended to the path of all requests
+	// made to the agent.
+	agentPathPrefix string
+
 	// serviceMappings holds a set of service mappings to dynamically rename services
 	serviceMappings map[string]string
 
@@ -99,12 +122,28 @@ type config struct {
 	// transport specifies the Transport interface which will be used to send data to the agent.
 	transport transport
 
+	// secondaryAgentURL is the URL of the agent to which the payloads are
+	// mirrored, if any.
+	secondaryAgentURL *url.URL
+
 	// propagator propagates span context cross-process
 	propagator Propagator
 
 	// httpClient specifies the HTTP client to be used by the agent's transport.
 	httpClient *http.Client
 
+	// udsMaxIdleConns and udsIdleConnTimeout configure the pool of idle
+	// connections of the HTTP client used over a unix domain socket. Zero
+	// values mean the defaults are used.
+	udsMaxIdleConns    int
+	udsIdleConnTimeout time.Duration
+
+	// forceHTTP1 disables the negotiation of HTTP/2 with the agent.
+	forceHTTP1 bool
+
+	// requestInterceptors are called on every request sent to the agent.
+	requestInterceptors []func(*http.Request)
+
 	// hostname is automatically assigned when the DD_TRACE_REPORT_HOSTNAME is set to true,
 	// and is added as a special tag to the root span of traces.
 	hostname string
@@ -180,6 +219,8 @@ const maxPropagatedTagsLength = 512
 func newConfig(opts ...StartOption) *config {
 	c := new(config)
 	c.sampler = NewAllSampler()
+	c.clock = systemClock{}
+	c.maxPayloadSize = payloadMaxLimit
 
 	if internal.BoolEnv("DD_TRACE_ANALYTICS_ENABLED", false) {
 		globalconfig.SetAnalyticsRate(1.0)
@@ -263,15 +304,13 @@ func newConfig(opts ...StartOption) *config {
 	}
 	if c.agentURL == nil {
 		c.agentURL = resolveAgentAddr()
-		if url := internal.AgentURLFromEnv(); url != nil {
-			c.agentURL = url
-		}
 	}
-	if c.agentURL.Scheme == "unix" {
+	uds := c.agentURL.Scheme == "unix"
+	if uds {
 		// If we're connecting over UDS we can just rely on the agent to provide the hostname
 		log.Debug("connecting to agent over unix, do not set hostname on any traces")
 		c.enableHostnameDetection = false
-		c.httpClient = udsClient(c.agentURL.Path)
+		c.httpClient = udsClient(c.agentURL.Path, c.udsMaxIdleConns, c.udsIdleConnTimeout)
 		c.agentURL = &url.URL{
 			Scheme: "http",
 			Host:   fmt.Sprintf("UDS_%s", strings.NewReplacer(":", "_", "/", "_", `\`, "_").Replace(c.agentURL.Path)),
@@ -279,6 +318,17 @@ func newConfig(opts ...StartOption) *config {
 	} else if c.httpClient == nil {
 		c.httpClient = defaultClient
 	}
+	if c.forceHTTP1 {
+		c.httpClient = http1Client(c.httpClient)
+	}
+	if len(c.requestInterceptors) > 0 {
+		c.httpClient = interceptingClient(c.httpClient, c.requestInterceptors)
+	}
+	if c.agentPathPrefix != "" {
+		u := *c.agentURL
+		u.Path = c.agentPathPrefix
+		c.agentURL = &u
+	}
 	WithGlobalTag(ext.RuntimeID, globalconfig.RuntimeID())(c)
 	if c.env == "" {
 		if v, ok := c.globalTags["env"]; ok {
@@ -306,6 +356,15 @@ func newConfig(opts ...StartOption) *config {
 	}
 	if c.transport == nil {
 		c.transport = newHTTPTransport(c.agentURL.String(), c.httpClient)
+		if c.secondaryAgentURL != nil {
+			// The secondary agent is reached with the client of the primary
+			// agent, unless it is a unix domain socket client.
+			client := c.httpClient
+			if uds {
+				client = defaultClient
+			}
+			c.transport = newMirroringTransport(c.transport, newHTTPTransport(c.secondaryAgentURL.String(), client))
+		}
 	}
 	if c.propagator == nil {
 		envKey := "DD_TRACE_X_DATADOG_TAGS_MAX_LENGTH"
@@ -371,13 +430,34 @@ func newStatsdClient(c *config) (statsdClient, error) {
 func defaultHTTPClient() *http.Client {
 	if _, err := os.Stat(defaultSocketAPM); err == nil {
 		// we have the UDS socket file, use it
-		return udsClient(defaultSocketAPM)
+		return udsClient(defaultSocketAPM, 0, 0)
 	}
 	return defaultClient
 }
 
+const (
+	// defaultUDSMaxIdleConns is the default number of idle connections kept
+	// open to the agent over a unix domain socket. It matches the number of
+	// concurrent payload uploads, so that connections are reused rather than
+	// re-dialed when the tracer is under heavy load.
+	defaultUDSMaxIdleConns = concurrentConnectionLimit
+
+	// defaultUDSIdleConnTimeout is the default duration after which idle
+	// connections to the agent over a unix domain socket are closed. Local
+	// sockets are cheap to keep open, so it is larger than the flush interval
+	// for connections to survive between flushes.
+	defaultUDSIdleConnTimeout = 90 * time.Second
+)
+
 // udsClient returns a new http.Client which connects using the given UDS socket path.
-func udsClient(socketPath string) *http.Client {
+// Zero values of maxIdleConns and idleConnTimeout select the defaults.
+func udsClient(socketPath string, maxIdleConns int, idleConnTimeout time.Duration) *http.Client {
+	if maxIdleConns <= 0 {
+		maxIdleConns = defaultUDSMaxIdleConns
+	}
+	if idleConnTimeout <= 0 {
+		idleConnTimeout = defaultUDSIdleConnTimeout
+	}
 	return &http.Client{
 		Transport: &http.Transport{
 			Proxy: http.ProxyFromEnvironment,
@@ -387,6 +467,87 @@ func udsClient(socketPath string) *http.Client {
 					Net:  "unix",
 				}).String())
 			},
+			// All the requests go to the same host, so the per-host limit,
+			// which defaults to 2, must be raised as well for the idle
+			// connections to be kept.
+			MaxIdleConns:          maxIdleConns,
+			MaxIdleConnsPerHost:   maxIdleConns,
+			IdleConnTimeout:       idleConnTimeout,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+		Timeout: defaultHTTPTimeout,
+	}
+}
+
+// interceptingRoundTripper calls the request interceptors on a copy of each
+// request before sending it with the underlying round tripper.
+type interceptingRoundTripper struct {
+	rt           http.RoundTripper
+	interceptors []func(*http.Request)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *interceptingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the request it is given.
+	req = req.Clone(req.Context())
+	for _, fn := range t.interceptors {
+		fn(req)
+	}
+	return t.rt.RoundTrip(req)
+}
+
+// interceptingClient returns a copy of the given client calling the given
+// interceptors on every request.
+func interceptingClient(client *http.Client, interceptors []func(*http.Request)) *http.Client {
+	rt := client.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	c := *client
+	c.Transport = &interceptingRoundTripper{rt: rt, interceptors: interceptors}
+	return &c
+}
+
+// http1Client returns a copy of the given client which only uses HTTP/1.1.
+// The client is returned as is if its transport is not an *http.Transport.
+func http1Client(client *http.Client) *http.Client {
+	rt := client.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	tr, ok := rt.(*http.Transport)
+	if !ok {
+		log.Warn("Unable to force HTTP/1.1 with a custom HTTP client transport of type %T", rt)
+		return client
+	}
+	tr = tr.Clone()
+	tr.ForceAttemptHTTP2 = false
+	// A non-nil empty map disables HTTP/2.
+	tr.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	if cfg := tr.TLSClientConfig; cfg != nil {
+		// The protocols may have been set up for HTTP/2 already.
+		var protos []string
+		for _, p := range cfg.NextProtos {
+			if p != "h2" {
+				protos = append(protos, p)
+			}
+		}
+		tr.TLSClientConfig.NextProtos = protos
+	}
+	c := *client
+	c.Transport = tr
+	return &c
+}
+
+// tlsClient returns a new http.Client which connects to the agent using the given TLS configuration.
+func tlsClient(cfg *tls.Config) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           defaultDialer.DialContext,
+			TLSClientConfig:       cfg.Clone(),
+			ForceAttemptHTTP2:     true,
 			MaxIdleConns:          100,
 			IdleConnTimeout:       90 * time.Second,
 			TLSHandshakeTimeout:   10 * time.Second,
@@ -431,6 +592,53 @@ type agentFeatures struct {
 
 	// featureFlags specifies all the feature flags reported by the trace-agent.
 	featureFlags map[string]struct{}
+
+	// info holds the response of the trace-agent's /info endpoint, if it
+	// could be loaded.
+	info *AgentCapabilities
+}
+
+// AgentCapabilities holds the information reported by the trace-agent's /info
+// endpoint, describing its version and the features it supports.
+type AgentCapabilities struct {
+	// Version is the version of the agent, e.g. "7.45.0".
+	Version string `json:"version"`
+
+	// GitCommit is the commit of the agent build.
+	GitCommit string `json:"git_commit"`
+
+	// Endpoints lists the endpoints exposed by the agent, e.g. "/v0.6/stats".
+	Endpoints []string `json:"endpoints"`
+
+	// FeatureFlags lists the feature flags enabled in the agent.
+	FeatureFlags []string `json:"feature_flags"`
+
+	// ClientDropP0s reports whether the agent allows the tracer to drop P0
+	// traces when computing stats.
+	ClientDropP0s bool `json:"client_drop_p0s"`
+
+	// StatsdPort specifies the Dogstatsd port configured in the agent.
+	StatsdPort int `json:"statsd_port"`
+}
+
+// HasEndpoint reports whether the agent exposes the given endpoint.
+func (a AgentCapabilities) HasEndpoint(endpoint string) bool {
+	for _, e := range a.Endpoints {
+		if e == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// HasFlag reports whether the agent has enabled the feat feature flag.
+func (a AgentCapabilities) HasFlag(feat string) bool {
+	for _, f := range a.FeatureFlags {
+		if f == feat {
+			return true
+		}
+	}
+	return false
 }
 
 // HasFlag reports whether the agent has set the feat feature flag.
@@ -443,7 +651,7 @@ func (a *agentFeatures) HasFlag(feat string) bool {
 // the tracer's behaviour.
 func (c *config) loadAgentFeatures() {
 	c.agent = agentFeatures{}
-	if c.logToStdout {
+	if c.logToStdout || c.dryRun() {
 		// there is no agent; all features off
 		return
 	}
@@ -457,13 +665,7 @@ func (c *config) loadAgentFeatures() {
 		return
 	}
 	defer resp.Body.Close()
-	type infoResponse struct {
-		Endpoints     []string `json:"endpoints"`
-		ClientDropP0s bool     `json:"client_drop_p0s"`
-		StatsdPort    int      `json:"statsd_port"`
-		FeatureFlags  []string `json:"feature_flags"`
-	}
-	var info infoResponse
+	var info AgentCapabilities
 	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
 		log.Error("Decoding features: %v", err)
 		return
@@ -480,6 +682,7 @@ func (c *config) loadAgentFeatures() {
 	for _, flag := range info.FeatureFlags {
 		c.agent.featureFlags[flag] = struct{}{}
 	}
+	c.agent.info = &info
 }
 
 func (c *config) canComputeStats() bool {
@@ -587,6 +790,44 @@ func WithSendRetries(retries int) StartOption {
 	}
 }
 
+// defaultBreakerCooldown is the default duration during which the agent circuit
+// breaker stays open.
+const defaultBreakerCooldown = 30 * time.Second
+
+// WithCircuitBreaker stops sending trace payloads to the agent after the given
+// number of consecutive failures, counting a payload as failed once its send
+// retries are exhausted. The traces are then dropped right away, without being
+// encoded, for the cool-down duration, which defaults to 30 seconds when not
+// positive. A single payload is then sent to probe the agent, resuming the
+// sending of traces if it succeeds, or starting another cool-down period
+// otherwise. The state of the breaker is reported by the
+// datadog.tracer.circuit_breaker.state health metric, which is 0 when closed,
+// 1 when open and 2 when probing the agent. A non-positive number of failures
+// disables the circuit breaking, which is the default.
+func WithCircuitBreaker(failures int, cooldown time.Duration) StartOption {
+	return func(c *config) {
+		if cooldown <= 0 {
+			cooldown = defaultBreakerCooldown
+		}
+		c.breakerThreshold, c.breakerCooldown = failures, cooldown
+	}
+}
+
+// WithMaxPayloadSize sets the maximum size in bytes of the trace payloads sent
+// to the agent, which defaults to 9.5MB. Traces which would not fit in a
+// payload of this size are split into chunks sent in separate requests, which
+// the agent reassembles. It should be lowered when a proxy with a lower
+// request size limit stands between the tracer and the agent.
+func WithMaxPayloadSize(bytes int) StartOption {
+	return func(c *config) {
+		if bytes <= 0 {
+			log.Warn("Ignoring invalid maximum payload size %d", bytes)
+			return
+		}
+		c.maxPayloadSize = bytes
+	}
+}
+
 // WithPropagator sets an alternative propagator to be used by the tracer.
 func WithPropagator(p Propagator) StartOption {
 	return func(c *config) {
@@ -636,6 +877,37 @@ func WithAgentAddr(addr string) StartOption {
 	}
 }
 
+// WithSecondaryAgent sets the address of a secondary agent, to which the trace
+// and stats payloads are also sent, e.g. to dual-write to an old and a new
+// agent during a migration. It should contain both host and port. Sending to
+// the secondary agent is best-effort: it happens in the background, once per
+// payload regardless of the retries of WithSendRetries, and its errors are
+// logged and do not affect the sending to the primary agent, whose responses
+// are the only ones used. It has no effect when a custom transport is used,
+// such as with WithDryRunTransport.
+func WithSecondaryAgent(addr string) StartOption {
+	return func(c *config) {
+		c.secondaryAgentURL = &url.URL{
+			Scheme: "http",
+			Host:   addr,
+		}
+	}
+}
+
+// WithAgentPathPrefix sets a path prefix which is prepended to the path of all requests
+// made to the agent, such as traces, stats, /info and telemetry. It is useful when the
+// agent is mounted under a path behind a reverse proxy, e.g. "/datadog/". The prefix
+// must start with "/", otherwise it is ignored.
+func WithAgentPathPrefix(prefix string) StartOption {
+	return func(c *config) {
+		if !strings.HasPrefix(prefix, "/") {
+			log.Warn("Invalid agent path prefix %q: must start with \"/\". Ignoring.", prefix)
+			return
+		}
+		c.agentPathPrefix = strings.TrimRight(prefix, "/")
+	}
+}
+
 // WithEnv sets the environment to which all traces started by the tracer will be submitted.
 // The default value is the environment variable DD_ENV, if it is set.
 func WithEnv(env string) StartOption {
@@ -708,6 +980,34 @@ func WithHTTPClient(client *http.Client) StartOption {
 	}
 }
 
+// WithAgentTLSConfig specifies the TLS configuration to use when connecting to an
+// agent over HTTPS, such as a custom CA bundle or a client certificate for mTLS. The
+// agent URL must use the https scheme, e.g. by setting DD_TRACE_AGENT_URL=https://host:8126.
+// This option replaces the HTTP client used by the tracer, so when used together with
+// WithHTTPClient, whichever option is passed last takes effect.
+func WithAgentTLSConfig(cfg *tls.Config) StartOption {
+	return func(c *config) {
+		c.httpClient = tlsClient(cfg)
+	}
+}
+
+// WithDryRunTransport configures the tracer to never send data to the agent.
+// The trace payloads are instead decoded, to surface any encoding error, and
+// discarded. It is meant to be used in CI and local development environments
+// to run the instrumentation without an agent. It takes precedence over any
+// other transport configuration, and disables the agent features discovery.
+func WithDryRunTransport() StartOption {
+	return func(c *config) {
+		c.transport = &dryRunTransport{}
+	}
+}
+
+// dryRun reports whether the tracer was configured with WithDryRunTransport.
+func (c *config) dryRun() bool {
+	_, ok := c.transport.(*dryRunTransport)
+	return ok
+}
+
 // WithUDS configures the HTTP client to dial the Datadog Agent via the specified Unix Domain Socket path.
 func WithUDS(socketPath string) StartOption {
 	return func(c *config) {
@@ -718,6 +1018,44 @@ func WithUDS(socketPath string) StartOption {
 	}
 }
 
+// WithForceHTTP1 disables the negotiation of HTTP/2 with the agent, which is
+// otherwise attempted when the agent is reached over TLS. It should be used
+// when an intermediary between the tracer and the agent mishandles HTTP/2.
+// It applies to the HTTP client set with WithHTTPClient too, when its
+// transport is an *http.Transport.
+func WithForceHTTP1() StartOption {
+	return func(c *config) {
+		c.forceHTTP1 = true
+	}
+}
+
+// WithRequestInterceptor adds a function called on every request sent to the
+// agent before it is sent, such as the trace and stats payloads. It allows
+// modifying the requests, e.g. to add the authentication headers required by
+// a proxy in front of the agent, while keeping the tracer's HTTP client. The
+// function is given a copy of the request, and must not retain it. The
+// interceptors are called in the order they were added.
+func WithRequestInterceptor(fn func(*http.Request)) StartOption {
+	return func(c *config) {
+		if fn != nil {
+			c.requestInterceptors = append(c.requestInterceptors, fn)
+		}
+	}
+}
+
+// WithUDSConnectionPool configures the pool of connections used to reach the
+// agent over a unix domain socket, such as when using WithUDS. maxIdleConns
+// is the maximum number of idle connections kept open, defaulting to 100, and
+// idleTimeout is the duration after which they are closed, defaulting to 90
+// seconds. Zero values keep the defaults. It has no effect when the agent is
+// not reached over a unix domain socket.
+func WithUDSConnectionPool(maxIdleConns int, idleTimeout time.Duration) StartOption {
+	return func(c *config) {
+		c.udsMaxIdleConns = maxIdleConns
+		c.udsIdleConnTimeout = idleTimeout
+	}
+}
+
 // WithAnalytics allows specifying whether Trace Search & Analytics should be enabled
 // for integrations.
 func WithAnalytics(on bool) StartOption {
@@ -891,6 +1229,16 @@ func WithSpanID(id uint64) StartSpanOption {
 	}
 }
 
+// WithTraceID sets the TraceID on the started span, instead of using the SpanID.
+// It has no effect if there is a parent Span (eg from ChildOf). Together with
+// WithSpanID, it allows starting spans with deterministic identifiers, e.g. to
+// assert propagated IDs in tests.
+func WithTraceID(id uint64) StartSpanOption {
+	return func(cfg *ddtrace.StartSpanConfig) {
+		cfg.TraceID = id
+	}
+}
+
 // ChildOf tells StartSpan to use the given span context as a parent for the
 // created span.
 func ChildOf(ctx ddtrace.SpanContext) StartSpanOption {
@@ -966,6 +1314,37 @@ func StackFrames(n, skip uint) FinishOption {
 	}
 }
 
+// An ErrorChecker determines whether the error err, returned by a traced
+// operation, should mark the span of the operation as erroneous. It returns
+// false for the errors which are part of the normal operation of a client, such
+// as cache misses or queries returning no rows. Integrations accepting an
+// ErrorChecker, e.g. through a WithErrorCheck option, only use it to decide how
+// to finish their spans: the error is still returned to the caller. A nil
+// ErrorChecker reports all errors.
+type ErrorChecker func(err error) bool
+
+// Check reports whether err should mark the span as erroneous. It returns false
+// for a nil error.
+func (fn ErrorChecker) Check(err error) bool {
+	if err == nil {
+		return false
+	}
+	return fn == nil || fn(err)
+}
+
+// IgnoreErrors returns an ErrorChecker ignoring the errors which match any of
+// the targets, as reported by errors.Is.
+func IgnoreErrors(targets ...error) ErrorChecker {
+	return func(err error) bool {
+		for _, target := range targets {
+			if errors.Is(err, target) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
 // WithHeaderTags enables the integration to attach HTTP request headers as span tags.
 // Warning:
 // Using this feature can risk exposing sensitive data such as authorization tokens to Datadog.
@@ -207,10 +207,17 @@ func TestLoadAgentFeatures(t *testing.T) {
 
 	t.Run("OK", func(t *testing.T) {
 		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-			w.Write([]byte(`{"endpoints":["/v0.6/stats"],"feature_flags":["a","b"],"client_drop_p0s":true,"statsd_port":8999}`))
+			w.Write([]byte(`{"version":"7.45.0","endpoints":["/v0.6/stats"],"feature_flags":["a","b"],"client_drop_p0s":true,"statsd_port":8999}`))
 		}))
 		defer srv.Close()
 		cfg := newConfig(WithAgentAddr(strings.TrimPrefix(srv.URL, "http://")))
+		assert.Equal(t, &AgentCapabilities{
+			Version:       "7.45.0",
+			Endpoints:     []string{"/v0.6/stats"},
+			FeatureFlags:  []string{"a", "b"},
+			ClientDropP0s: true,
+			StatsdPort:    8999,
+		}, cfg.agent.info)
 		assert.True(t, cfg.agent.DropP0s)
 		assert.Equal(t, cfg.agent.StatsdPort, 8999)
 		assert.EqualValues(t, cfg.agent.featureFlags, map[string]struct{}{
@@ -222,6 +229,25 @@ func TestLoadAgentFeatures(t *testing.T) {
 		assert.True(t, cfg.agent.HasFlag("b"))
 	})
 
+	t.Run("AgentInfo", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Write([]byte(`{"version":"7.45.0","endpoints":["/v0.4/traces","/v0.6/stats"],"feature_flags":["a"]}`))
+		}))
+		defer srv.Close()
+		_, ok := AgentInfo()
+		assert.False(t, ok)
+
+		Start(WithAgentAddr(strings.TrimPrefix(srv.URL, "http://")))
+		defer Stop()
+		info, ok := AgentInfo()
+		assert.True(t, ok)
+		assert.Equal(t, "7.45.0", info.Version)
+		assert.True(t, info.HasEndpoint("/v0.6/stats"))
+		assert.False(t, info.HasEndpoint("/v0.7/config"))
+		assert.True(t, info.HasFlag("a"))
+		assert.False(t, info.HasFlag("b"))
+	})
+
 	t.Run("discovery", func(t *testing.T) {
 		defer func(old string) { os.Setenv("DD_TRACE_FEATURES", old) }(os.Getenv("DD_TRACE_FEATURES"))
 		os.Setenv("DD_TRACE_FEATURES", "discovery")
@@ -8,6 +8,8 @@ package tracer
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 	"sync/atomic"
 
@@ -57,6 +59,15 @@ type payload struct {
 
 	// reader is used for reading the contents of buf.
 	reader *bytes.Reader
+
+	// flushID identifies the flush of the payload. It is sent to the agent
+	// along with the payload to correlate the agent logs with the tracer
+	// ones.
+	flushID string
+
+	// mirrored reports whether the payload was mirrored to a secondary agent,
+	// which must happen once regardless of the send retries.
+	mirrored bool
 }
 
 var _ io.Reader = (*payload)(nil)
@@ -101,6 +112,16 @@ func (p *payload) reset() {
 	}
 }
 
+// clone returns a copy of the payload which can be read independently of p.
+func (p *payload) clone() *payload {
+	c := newPayload()
+	c.buf.Write(p.buf.Bytes())
+	c.count = uint32(p.itemCount())
+	c.flushID = p.flushID
+	c.updateHeader()
+	return c
+}
+
 // clear empties the payload buffers.
 func (p *payload) clear() {
 	p.buf = bytes.Buffer{}
@@ -151,3 +172,247 @@ func (p *payload) Read(b []byte) (n int, err error) {
 	}
 	return p.reader.Read(b)
 }
+
+// SpanData is the exported representation of a finished span, as it is sent to
+// the agent. It can be used together with EncodeTraces and DecodeTraces to
+// produce and read agent-compatible payloads outside of the tracer, e.g. in
+// custom exporters or replay tools.
+type SpanData struct {
+	Name     string             // operation name
+	Service  string             // service name (i.e. "grpc.server", "http.request")
+	Resource string             // resource name (i.e. "/user?id=123", "SELECT * FROM users")
+	Type     string             // protocol associated with the span (i.e. "web", "db", "cache")
+	Start    int64              // span start time expressed in nanoseconds since epoch
+	Duration int64              // duration of the span expressed in nanoseconds
+	Meta     map[string]string  // arbitrary map of metadata
+	Metrics  map[string]float64 // arbitrary map of numeric metrics
+	SpanID   uint64             // identifier of this span
+	TraceID  uint64             // lower 64-bits of the root span identifier
+	ParentID uint64             // identifier of the span's direct parent
+	Error    int32              // error status of the span; 0 means no errors
+}
+
+// EncodeTraces writes the given traces to w using the msgpack encoding expected by
+// the agent's v0.4 traces endpoint. Each element of traces holds the spans of a
+// single trace.
+func EncodeTraces(w io.Writer, traces [][]SpanData) error {
+	p := newPayload()
+	for _, t := range traces {
+		list := make(spanList, len(t))
+		for i := range t {
+			sd := &t[i]
+			list[i] = &span{
+				Name:     sd.Name,
+				Service:  sd.Service,
+				Resource: sd.Resource,
+				Type:     sd.Type,
+				Start:    sd.Start,
+				Duration: sd.Duration,
+				Meta:     sd.Meta,
+				Metrics:  sd.Metrics,
+				SpanID:   sd.SpanID,
+				TraceID:  sd.TraceID,
+				ParentID: sd.ParentID,
+				Error:    sd.Error,
+			}
+		}
+		if err := p.push(list); err != nil {
+			return err
+		}
+	}
+	_, err := io.Copy(w, p)
+	return err
+}
+
+// DecodeTraces reads the traces encoded in r using one of the msgpack encodings
+// of the agent's traces endpoints, such as the payloads written by EncodeTraces.
+// The v0.4 and v0.5 encodings are supported, the version being detected from
+// the payload. Each element of the result holds the spans of a single trace.
+func DecodeTraces(r io.Reader) ([][]SpanData, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if isV05Payload(b) {
+		return decodeV05Traces(b)
+	}
+	// Checking that the payload is complete first ensures that its array
+	// headers are consistent with its size, which the decoder relies on to
+	// allocate the traces.
+	if _, err := msgp.Skip(b); err != nil {
+		return nil, fmt.Errorf("cannot decode v0.4 payload: %v", err)
+	}
+	var list spanLists
+	if err := list.DecodeMsg(msgp.NewReader(bytes.NewReader(b))); err != nil {
+		return nil, fmt.Errorf("cannot decode v0.4 payload: %v", err)
+	}
+	traces := make([][]SpanData, len(list))
+	for i, t := range list {
+		traces[i] = make([]SpanData, len(t))
+		for j, s := range t {
+			traces[i][j] = SpanData{
+				Name:     s.Name,
+				Service:  s.Service,
+				Resource: s.Resource,
+				Type:     s.Type,
+				Start:    s.Start,
+				Duration: s.Duration,
+				Meta:     s.Meta,
+				Metrics:  s.Metrics,
+				SpanID:   s.SpanID,
+				TraceID:  s.TraceID,
+				ParentID: s.ParentID,
+				Error:    s.Error,
+			}
+		}
+	}
+	return traces, nil
+}
+
+// isV05Payload reports whether b holds a v0.5 payload, which is an array made
+// of the string table, starting with the empty string, and of the traces. A
+// v0.4 payload is an array of traces, whose spans are maps.
+func isV05Payload(b []byte) bool {
+	n, b, err := msgp.ReadArrayHeaderBytes(b)
+	if err != nil || n != 2 {
+		return false
+	}
+	n, b, err = msgp.ReadArrayHeaderBytes(b)
+	if err != nil || n == 0 {
+		return false
+	}
+	return msgp.NextType(b) == msgp.StrType
+}
+
+// v05SpanFields is the number of fields of the spans encoded in the v0.5
+// format, as an array of: service, name, resource, trace ID, span ID, parent
+// ID, start, duration, error, meta, metrics and type. Strings are encoded as
+// indexes in the string table.
+const v05SpanFields = 12
+
+// errV05StringIndex is returned when a string index is out of the bounds of the
+// string table of a v0.5 payload.
+var errV05StringIndex = errors.New("string index out of range")
+
+// v05Decoder decodes a v0.5 payload.
+type v05Decoder struct {
+	b       []byte   // remaining bytes
+	strings []string // string table
+	err     error    // first error encountered
+}
+
+func decodeV05Traces(b []byte) ([][]SpanData, error) {
+	d := v05Decoder{b: b}
+	d.arrayHeader() // payload
+	d.strings = make([]string, d.arrayHeader())
+	for i := range d.strings {
+		if d.err != nil {
+			break
+		}
+		d.strings[i], d.b, d.err = msgp.ReadStringBytes(d.b)
+	}
+	traces := make([][]SpanData, d.arrayHeader())
+	for i := range traces {
+		if d.err != nil {
+			break
+		}
+		traces[i] = make([]SpanData, d.arrayHeader())
+		for j := range traces[i] {
+			d.span(&traces[i][j])
+		}
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("cannot decode v0.5 payload: %v", d.err)
+	}
+	return traces, nil
+}
+
+// arrayHeader reads an array header.
+func (d *v05Decoder) arrayHeader() uint32 {
+	return d.header(msgp.ReadArrayHeaderBytes)
+}
+
+// mapHeader reads a map header.
+func (d *v05Decoder) mapHeader() uint32 {
+	return d.header(msgp.ReadMapHeaderBytes)
+}
+
+// header reads a header using the given function, bounding its size by the
+// number of remaining bytes to avoid large allocations from malformed payloads.
+func (d *v05Decoder) header(read func([]byte) (uint32, []byte, error)) uint32 {
+	if d.err != nil {
+		return 0
+	}
+	var n uint32
+	n, d.b, d.err = read(d.b)
+	if d.err == nil && int(n) > len(d.b) {
+		d.err = msgp.ErrShortBytes
+	}
+	if d.err != nil {
+		return 0
+	}
+	return n
+}
+
+func (d *v05Decoder) string() string {
+	if d.err != nil {
+		return ""
+	}
+	var i uint32
+	i, d.b, d.err = msgp.ReadUint32Bytes(d.b)
+	if d.err == nil && int(i) >= len(d.strings) {
+		d.err = errV05StringIndex
+	}
+	if d.err != nil {
+		return ""
+	}
+	return d.strings[i]
+}
+
+func (d *v05Decoder) uint64() (v uint64) {
+	if d.err == nil {
+		v, d.b, d.err = msgp.ReadUint64Bytes(d.b)
+	}
+	return v
+}
+
+func (d *v05Decoder) int64() (v int64) {
+	if d.err == nil {
+		v, d.b, d.err = msgp.ReadInt64Bytes(d.b)
+	}
+	return v
+}
+
+func (d *v05Decoder) span(s *SpanData) {
+	if n := d.arrayHeader(); d.err == nil && n != v05SpanFields {
+		d.err = fmt.Errorf("span has %d fields, expected %d", n, v05SpanFields)
+	}
+	s.Service = d.string()
+	s.Name = d.string()
+	s.Resource = d.string()
+	s.TraceID = d.uint64()
+	s.SpanID = d.uint64()
+	s.ParentID = d.uint64()
+	s.Start = d.int64()
+	s.Duration = d.int64()
+	if d.err == nil {
+		s.Error, d.b, d.err = msgp.ReadInt32Bytes(d.b)
+	}
+	if n := d.mapHeader(); n > 0 {
+		s.Meta = make(map[string]string, n)
+		for i := uint32(0); i < n && d.err == nil; i++ {
+			k := d.string()
+			s.Meta[k] = d.string()
+		}
+	}
+	if n := d.mapHeader(); n > 0 {
+		s.Metrics = make(map[string]float64, n)
+		for i := uint32(0); i < n && d.err == nil; i++ {
+			k := d.string()
+			if d.err == nil {
+				s.Metrics[k], d.b, d.err = msgp.ReadFloat64Bytes(d.b)
+			}
+		}
+	}
+	s.Type = d.string()
+}
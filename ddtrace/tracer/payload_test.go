@@ -14,6 +14,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/tinylib/msgp/msgp"
 )
 
@@ -74,6 +75,162 @@ func TestPayloadDecode(t *testing.T) {
 	}
 }
 
+func TestEncodeTraces(t *testing.T) {
+	assert := assert.New(t)
+	traces := [][]SpanData{
+		{
+			{
+				Name:     "http.request",
+				Service:  "web",
+				Resource: "GET /",
+				Type:     "web",
+				Start:    fixedTime,
+				Duration: 1000,
+				Meta:     map[string]string{"http.method": "GET"},
+				Metrics:  map[string]float64{keySamplingPriority: 1},
+				SpanID:   2,
+				TraceID:  1,
+				Error:    1,
+			},
+			{Name: "db.query", Service: "db", SpanID: 3, TraceID: 1, ParentID: 2},
+		},
+		{
+			{Name: "worker", SpanID: 4, TraceID: 4},
+		},
+	}
+	var buf bytes.Buffer
+	assert.NoError(EncodeTraces(&buf, traces))
+
+	var got spanLists
+	assert.NoError(msgp.Decode(&buf, &got))
+	assert.Len(got, len(traces))
+	for i, trace := range traces {
+		assert.Len(got[i], len(trace))
+		for j, sd := range trace {
+			s := got[i][j]
+			assert.Equal(sd.Name, s.Name)
+			assert.Equal(sd.Service, s.Service)
+			assert.Equal(sd.Resource, s.Resource)
+			assert.Equal(sd.Type, s.Type)
+			assert.Equal(sd.Start, s.Start)
+			assert.Equal(sd.Duration, s.Duration)
+			assert.Equal(sd.SpanID, s.SpanID)
+			assert.Equal(sd.TraceID, s.TraceID)
+			assert.Equal(sd.ParentID, s.ParentID)
+			assert.Equal(sd.Error, s.Error)
+			for k, v := range sd.Meta {
+				assert.Equal(v, s.Meta[k])
+			}
+			for k, v := range sd.Metrics {
+				assert.Equal(v, s.Metrics[k])
+			}
+		}
+	}
+}
+
+func TestDecodeTraces(t *testing.T) {
+	want := [][]SpanData{
+		{
+			{
+				Name:     "http.request",
+				Service:  "web",
+				Resource: "GET /",
+				Type:     "web",
+				Start:    fixedTime,
+				Duration: 1000,
+				Meta:     map[string]string{"http.method": "GET"},
+				Metrics:  map[string]float64{keySamplingPriority: 1},
+				SpanID:   2,
+				TraceID:  1,
+				Error:    1,
+			},
+			{
+				Name:     "db.query",
+				Service:  "db",
+				SpanID:   3,
+				TraceID:  1,
+				ParentID: 2,
+			},
+		},
+	}
+
+	t.Run("v0.4", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, EncodeTraces(&buf, want))
+		got, err := DecodeTraces(&buf)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("v0.5", func(t *testing.T) {
+		strs := []string{"", "web", "http.request", "GET /", "http.method", "GET", keySamplingPriority, "db", "db.query"}
+		b := msgp.AppendArrayHeader(nil, 2)
+		b = msgp.AppendArrayHeader(b, uint32(len(strs)))
+		for _, s := range strs {
+			b = msgp.AppendString(b, s)
+		}
+		b = msgp.AppendArrayHeader(b, 1) // traces
+		b = msgp.AppendArrayHeader(b, 2) // spans
+		b = msgp.AppendArrayHeader(b, v05SpanFields)
+		b = msgp.AppendUint32(b, 1)
+		b = msgp.AppendUint32(b, 2)
+		b = msgp.AppendUint32(b, 3)
+		b = msgp.AppendUint64(b, 1)
+		b = msgp.AppendUint64(b, 2)
+		b = msgp.AppendUint64(b, 0)
+		b = msgp.AppendInt64(b, fixedTime)
+		b = msgp.AppendInt64(b, 1000)
+		b = msgp.AppendInt32(b, 1)
+		b = msgp.AppendMapHeader(b, 1)
+		b = msgp.AppendUint32(b, 4)
+		b = msgp.AppendUint32(b, 5)
+		b = msgp.AppendMapHeader(b, 1)
+		b = msgp.AppendUint32(b, 6)
+		b = msgp.AppendFloat64(b, 1)
+		b = msgp.AppendUint32(b, 1)
+		b = msgp.AppendArrayHeader(b, v05SpanFields)
+		b = msgp.AppendUint32(b, 7)
+		b = msgp.AppendUint32(b, 8)
+		b = msgp.AppendUint32(b, 0)
+		b = msgp.AppendUint64(b, 1)
+		b = msgp.AppendUint64(b, 3)
+		b = msgp.AppendUint64(b, 2)
+		b = msgp.AppendInt64(b, 0)
+		b = msgp.AppendInt64(b, 0)
+		b = msgp.AppendInt32(b, 0)
+		b = msgp.AppendMapHeader(b, 0)
+		b = msgp.AppendMapHeader(b, 0)
+		b = msgp.AppendUint32(b, 0)
+
+		got, err := DecodeTraces(bytes.NewReader(b))
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+
+		// the string indexes must be in the bounds of the string table
+		b[len(b)-1] = byte(len(strs))
+		_, err = DecodeTraces(bytes.NewReader(b))
+		assert.Error(t, err)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		got, err := DecodeTraces(bytes.NewReader(msgp.AppendArrayHeader(nil, 0)))
+		assert.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		for _, b := range [][]byte{
+			nil,
+			[]byte("not msgpack"),
+			msgp.AppendArrayHeader(nil, 3),
+			msgp.AppendArrayHeader(msgp.AppendArrayHeader(nil, 2), 1<<30),
+		} {
+			_, err := DecodeTraces(bytes.NewReader(b))
+			assert.Error(t, err)
+		}
+	})
+}
+
 func BenchmarkPayloadThroughput(b *testing.B) {
 	b.Run("10K", benchmarkPayloadThroughput(1))
 	b.Run("100K", benchmarkPayloadThroughput(10))
@@ -39,6 +39,30 @@ type TextMapReader interface {
 	ForeachKey(handler func(key, val string) error) error
 }
 
+// TextMapGetter is an optional interface which can be implemented by the
+// carriers implementing TextMapReader to look up keys directly. When extracting
+// Datadog headers from such carriers, the headers identifying the span context
+// are looked up with Get instead of being searched with ForeachKey, which is
+// then only used to find the baggage items, and is skipped when the carrier
+// also implements TextMapSizer and has no other keys. Keys are looked up as
+// configured in PropagatorConfig, lowercase by default: when any of the trace
+// ID, parent ID and sampling priority headers isn't found this way, e.g.
+// because the carrier holds it with a different case, the keys are searched
+// with ForeachKey.
+type TextMapGetter interface {
+	// Get returns the value of the given key, and whether it was found.
+	Get(key string) (string, bool)
+}
+
+// TextMapSizer is an optional interface which can be implemented by the
+// carriers implementing TextMapReader to report their number of keys. When a
+// carrier holds more keys than a map holds without growing, its baggage items
+// are counted before being extracted, to allocate room for them at once.
+type TextMapSizer interface {
+	// Len returns the number of keys in the carrier.
+	Len() int
+}
+
 var (
 	// ErrInvalidCarrier is returned when the carrier provided to the propagator
 	// does not implement the correct interfaces.
@@ -106,14 +106,18 @@ func newPrioritySampler() *prioritySampler {
 }
 
 // readRatesJSON will try to read the rates as JSON from the given io.ReadCloser.
+// The agent responses only hold the sampling rates: the agent doesn't report the
+// priority-0 traces it drops, the tracer reporting its own drops to the agent in
+// the Datadog-Client-Dropped-P0-* headers instead. There is therefore no agent
+// drop statistic to adapt the sampling to until the agent defines one.
 func (ps *prioritySampler) readRatesJSON(rc io.ReadCloser) error {
+	defer rc.Close()
 	var payload struct {
 		Rates map[string]float64 `json:"rate_by_service"`
 	}
 	if err := json.NewDecoder(rc).Decode(&payload); err != nil {
 		return err
 	}
-	rc.Close()
 	const defaultRateKey = "service:,env:"
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
@@ -698,12 +698,17 @@ const (
 	keyTracerHostname = "_dd.tracer_hostname"
 	// keyTraceID128 is the lowercase, hex encoded upper 64 bits of a 128-bit trace id, if present.
 	keyTraceID128 = "_dd.p.tid"
+	// keyRequestID holds the x-request-id header of the extracted request, if
+	// its extraction is enabled with PropagatorConfig.ExtractRequestID.
+	keyRequestID = "_dd.p.request_id"
 	// keySpanAttributeSchemaVersion holds the selected DD_TRACE_SPAN_ATTRIBUTE_SCHEMA version.
 	keySpanAttributeSchemaVersion = "_dd.trace_span_attribute_schema"
 	// keyPeerServiceSource indicates the precursor tag that was used as the value of peer.service.
 	keyPeerServiceSource = "_dd.peer.service.source"
 	// keyPeerServiceRemappedFrom indicates the previous value for peer.service, in case remapping happened.
 	keyPeerServiceRemappedFrom = "_dd.peer.service.remapped_from"
+	// keySpanLinks holds the JSON encoded span links of the span.
+	keySpanLinks = "_dd.span_links"
 )
 
 // The following set of tags is used for user monitoring and set through calls to span.SetUser().
@@ -230,6 +230,26 @@ func TestSpanFinishWithError(t *testing.T) {
 	assert.NotEmpty(span.Meta[ext.ErrorStack])
 }
 
+func TestErrorChecker(t *testing.T) {
+	errNotFound := errors.New("not found")
+	wrapped := fmt.Errorf("get: %w", errNotFound)
+	other := errors.New("timeout")
+
+	var nilChecker ErrorChecker
+	assert.False(t, nilChecker.Check(nil))
+	assert.True(t, nilChecker.Check(errNotFound))
+
+	check := IgnoreErrors(errNotFound)
+	assert.False(t, check.Check(nil))
+	assert.False(t, check.Check(errNotFound))
+	assert.False(t, check.Check(wrapped))
+	assert.True(t, check.Check(other))
+
+	check = func(err error) bool { return err != other }
+	assert.True(t, check.Check(errNotFound))
+	assert.False(t, check.Check(other))
+}
+
 func TestSpanFinishWithErrorNoDebugStack(t *testing.T) {
 	assert := assert.New(t)
 
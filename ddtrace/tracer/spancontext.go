@@ -10,6 +10,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -25,6 +26,23 @@ import (
 
 var _ ddtrace.SpanContext = (*spanContext)(nil)
 
+// SamplerName specifies the mechanism which was responsible for a sampling
+// decision, as returned by a span context's SamplingDecision method.
+type SamplerName = samplernames.SamplerName
+
+// The mechanisms which may be responsible for a sampling decision.
+const (
+	SamplerUnknown        = samplernames.Unknown
+	SamplerDefault        = samplernames.Default
+	SamplerAgentRate      = samplernames.AgentRate
+	SamplerRemoteRate     = samplernames.RemoteRate
+	SamplerRuleRate       = samplernames.RuleRate
+	SamplerManual         = samplernames.Manual
+	SamplerAppSec         = samplernames.AppSec
+	SamplerRemoteUserRate = samplernames.RemoteUserRate
+	SamplerSingleSpan     = samplernames.SingleSpan
+)
+
 type traceID [16]byte // traceID in big endian, i.e. <upper><lower>
 
 var emptyTraceID traceID
@@ -98,6 +116,8 @@ type spanContext struct {
 	baggage    map[string]string
 	hasBaggage uint32 // atomic int for quick checking presence of baggage. 0 indicates no baggage, otherwise baggage exists.
 	origin     string // e.g. "synthetics"
+
+	spanLinks []ddtrace.SpanLink // links to the contexts which were extracted but not chosen
 }
 
 // newSpanContext creates a new SpanContext to serve as context for the given
@@ -120,7 +140,8 @@ func newSpanContext(span *span, parent *spanContext) *spanContext {
 			context.setBaggageItem(k, v)
 			return true
 		})
-	} else if sharedinternal.BoolEnv("DD_TRACE_128_BIT_TRACEID_GENERATION_ENABLED", false) {
+	}
+	if (parent == nil || parent.traceID.Empty()) && sharedinternal.BoolEnv("DD_TRACE_128_BIT_TRACEID_GENERATION_ENABLED", false) {
 		// add 128 bit trace id, if enabled, formatted as big-endian:
 		// <32-bit unix seconds> <32 bits of zero> <64 random bits>
 		id128 := time.Duration(span.Start) / time.Second
@@ -146,6 +167,30 @@ func newSpanContext(span *span, parent *spanContext) *spanContext {
 	return context
 }
 
+// withNewTrace returns a copy of the extracted context c holding a new trace
+// with the propagating tags of c. It is used for the contexts extracted without
+// trace ID, such as the ones only holding a request ID, so that each span
+// started from them starts its own trace.
+func (c *spanContext) withNewTrace() *spanContext {
+	ctx := &spanContext{
+		trace:     newTrace(),
+		errors:    atomic.LoadInt32(&c.errors),
+		origin:    c.origin,
+		spanLinks: c.spanLinks,
+	}
+	c.ForeachBaggageItem(func(k, v string) bool {
+		ctx.setBaggageItem(k, v)
+		return true
+	})
+	if c.trace != nil {
+		c.trace.iteratePropagatingTags(func(k, v string) bool {
+			ctx.trace.setPropagatingTagLocked(k, v)
+			return true
+		})
+	}
+	return ctx
+}
+
 // SpanID implements ddtrace.SpanContext.
 func (c *spanContext) SpanID() uint64 { return c.spanID }
 
@@ -193,6 +238,72 @@ func (c *spanContext) samplingPriority() (p int, ok bool) {
 	return c.trace.samplingPriority()
 }
 
+// SpanLink is a reference from a span to another span which isn't its parent.
+// It follows the OpenTelemetry semantics of span links.
+type SpanLink = ddtrace.SpanLink
+
+// SpanLinks returns the links to the span contexts which were found alongside
+// this one when extracting it, but which were not used as parent, e.g. because
+// they conflict with it or with its sampling decision. Each link is attributed with the reason and the
+// propagation style it was extracted with.
+func (c *spanContext) SpanLinks() []ddtrace.SpanLink {
+	links := make([]ddtrace.SpanLink, len(c.spanLinks))
+	copy(links, c.spanLinks)
+	return links
+}
+
+// SamplingDecision returns the sampling priority of the trace this context
+// belongs to, along with the mechanism which was responsible for it. The
+// mechanism is SamplerUnknown when the trace was dropped or when it could not
+// be determined (e.g. an extracted context without a decision maker tag). ok
+// is false when no sampling decision was made yet.
+func (c *spanContext) SamplingDecision() (priority int, mechanism SamplerName, ok bool) {
+	if c.trace == nil {
+		return 0, samplernames.Unknown, false
+	}
+	c.trace.mu.RLock()
+	defer c.trace.mu.RUnlock()
+	priority, ok = c.trace.samplingPriorityLocked()
+	if !ok {
+		return 0, samplernames.Unknown, false
+	}
+	mechanism = samplernames.Unknown
+	if dm, has := c.trace.propagatingTags[keyDecisionMaker]; has && priority > 0 {
+		if n, err := strconv.ParseInt(strings.TrimPrefix(dm, "-"), 10, 8); err == nil {
+			mechanism = SamplerName(n)
+		}
+	}
+	return priority, mechanism, true
+}
+
+// SetSamplingPriority overrides the sampling priority of the trace of the span
+// context with p, recording mechanism as the sampling decision maker. It allows
+// forcing the sampling decision of an extracted span context regardless of the
+// upstream one, e.g. to keep the traces of the requests hitting a debug route,
+// and must be called before starting its child spans. The priority is then
+// used by the spans of the trace and propagated on injection. It has no effect
+// once the root span of the trace finished.
+func (c *spanContext) SetSamplingPriority(p int, mechanism SamplerName) {
+	if c.trace == nil {
+		c.trace = newTrace()
+	}
+	c.trace.mu.Lock()
+	if c.trace.locked {
+		c.trace.mu.Unlock()
+		return
+	}
+	// the decision maker of the upstream decision is replaced
+	delete(c.trace.propagatingTags, keyDecisionMaker)
+	c.trace.setSamplingPriorityLocked(p, mechanism)
+	c.trace.mu.Unlock()
+	c.updated = true
+	if state := c.trace.propagatingTag(tracestateHeader); strings.HasPrefix(state, "dd=") {
+		// the extracted tracestate is propagated as-is by the children spans,
+		// which aren't marked as updated.
+		c.trace.setPropagatingTag(tracestateHeader, composeTracestate(c, p, state))
+	}
+}
+
 func (c *spanContext) setBaggageItem(key, val string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -203,6 +314,17 @@ func (c *spanContext) setBaggageItem(key, val string) {
 	c.baggage[key] = val
 }
 
+// reserveBaggage allocates room for n baggage items, unless some were already
+// set. It must be followed by setting a baggage item.
+func (c *spanContext) reserveBaggage(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.baggage == nil {
+		atomic.StoreUint32(&c.hasBaggage, 1)
+		c.baggage = make(map[string]string, n)
+	}
+}
+
 func (c *spanContext) baggageItem(key string) string {
 	if atomic.LoadUint32(&c.hasBaggage) == 0 {
 		return ""
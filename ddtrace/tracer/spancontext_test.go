@@ -7,6 +7,7 @@ package tracer
 
 import (
 	"context"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -491,7 +492,7 @@ func TestNewSpanContext(t *testing.T) {
 		ctx, err := NewPropagator(nil).Extract(TextMapCarrier(map[string]string{
 			DefaultTraceIDHeader:  "1",
 			DefaultParentIDHeader: "2",
-			DefaultPriorityHeader: "3",
+			DefaultPriorityHeader: "2",
 		}))
 		assert.Nil(err)
 		sctx, ok := ctx.(*spanContext)
@@ -499,7 +500,7 @@ func TestNewSpanContext(t *testing.T) {
 		span := StartSpan("some-span", ChildOf(ctx))
 		assert.EqualValues(uint64(1), sctx.traceID.Lower())
 		assert.EqualValues(2, sctx.spanID)
-		assert.EqualValues(3, *sctx.trace.priority)
+		assert.EqualValues(2, *sctx.trace.priority)
 		assert.Equal(sctx.trace.root, span)
 	})
 }
@@ -664,6 +665,115 @@ func TestSetSamplingPriorityLocked(t *testing.T) {
 	})
 }
 
+func TestSpanContextSamplingDecision(t *testing.T) {
+	type samplingDecider interface {
+		SamplingDecision() (int, SamplerName, bool)
+	}
+	tracer := newTracer()
+	defer tracer.Stop()
+
+	t.Run("none", func(t *testing.T) {
+		_, _, ok := (&spanContext{}).SamplingDecision()
+		assert.False(t, ok)
+	})
+	t.Run("manual-keep", func(t *testing.T) {
+		s := tracer.StartSpan("op", Tag(ext.ManualKeep, true))
+		p, m, ok := s.Context().(samplingDecider).SamplingDecision()
+		assert.True(t, ok)
+		assert.Equal(t, ext.PriorityUserKeep, p)
+		assert.Equal(t, SamplerManual, m)
+	})
+	t.Run("manual-drop", func(t *testing.T) {
+		s := tracer.StartSpan("op", Tag(ext.ManualDrop, true))
+		p, m, ok := s.Context().(samplingDecider).SamplingDecision()
+		assert.True(t, ok)
+		assert.Equal(t, ext.PriorityUserReject, p)
+		assert.Equal(t, SamplerUnknown, m)
+	})
+	t.Run("extracted", func(t *testing.T) {
+		ctx, err := tracer.Extract(TextMapCarrier{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "2",
+			DefaultPriorityHeader: "1",
+			traceTagsHeader:       "_dd.p.dm=-3",
+		})
+		assert.NoError(t, err)
+		p, m, ok := ctx.(samplingDecider).SamplingDecision()
+		assert.True(t, ok)
+		assert.Equal(t, ext.PriorityAutoKeep, p)
+		assert.Equal(t, SamplerRuleRate, m)
+	})
+	t.Run("extracted-no-mechanism", func(t *testing.T) {
+		ctx, err := tracer.Extract(TextMapCarrier{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "2",
+			DefaultPriorityHeader: "1",
+		})
+		assert.NoError(t, err)
+		p, m, ok := ctx.(samplingDecider).SamplingDecision()
+		assert.True(t, ok)
+		assert.Equal(t, ext.PriorityAutoKeep, p)
+		assert.Equal(t, SamplerUnknown, m)
+	})
+}
+
+func TestSpanContextSetSamplingPriority(t *testing.T) {
+	t.Setenv(headerPropagationStyle, "datadog,tracecontext")
+	tracer := newTracer()
+	defer tracer.Stop()
+
+	t.Run("extracted", func(t *testing.T) {
+		ctx, err := tracer.Extract(TextMapCarrier{
+			traceparentHeader: "00-00000000000000000000000000000001-0000000000000002-00",
+			tracestateHeader:  "dd=s:0;o:rum,othervendor=t61rcWkgMzE",
+		})
+		require.NoError(t, err)
+		ctx.(*spanContext).SetSamplingPriority(ext.PriorityUserKeep, SamplerManual)
+
+		child := tracer.StartSpan("child", ChildOf(ctx)).(*span)
+		p, m, ok := child.context.SamplingDecision()
+		assert.True(t, ok)
+		assert.Equal(t, ext.PriorityUserKeep, p)
+		assert.Equal(t, SamplerManual, m)
+
+		carrier := TextMapCarrier{}
+		require.NoError(t, tracer.Inject(child.Context(), carrier))
+		assert.Equal(t, "2", carrier[DefaultPriorityHeader])
+		assert.Contains(t, carrier[traceTagsHeader], "_dd.p.dm=-4")
+		assert.True(t, strings.HasSuffix(carrier[traceparentHeader], "-01"), carrier[traceparentHeader])
+		assert.Equal(t, "dd=s:2;o:rum;t.dm:-4,othervendor=t61rcWkgMzE", carrier[tracestateHeader])
+
+		child.Finish()
+		assert.Equal(t, float64(ext.PriorityUserKeep), child.Metrics[keySamplingPriority])
+	})
+
+	t.Run("replaces-decision-maker", func(t *testing.T) {
+		ctx, err := tracer.Extract(TextMapCarrier{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "2",
+			DefaultPriorityHeader: "1",
+			traceTagsHeader:       "_dd.p.dm=-3",
+		})
+		require.NoError(t, err)
+		ctx.(*spanContext).SetSamplingPriority(ext.PriorityUserKeep, SamplerManual)
+		_, m, _ := ctx.(*spanContext).SamplingDecision()
+		assert.Equal(t, SamplerManual, m)
+
+		ctx.(*spanContext).SetSamplingPriority(ext.PriorityUserReject, SamplerManual)
+		p, m, _ := ctx.(*spanContext).SamplingDecision()
+		assert.Equal(t, ext.PriorityUserReject, p)
+		assert.Equal(t, SamplerUnknown, m)
+	})
+
+	t.Run("locked", func(t *testing.T) {
+		root := tracer.StartSpan("root", Tag(ext.ManualDrop, true)).(*span)
+		root.Finish()
+		root.context.SetSamplingPriority(ext.PriorityUserKeep, SamplerManual)
+		p, _, _ := root.context.SamplingDecision()
+		assert.Equal(t, ext.PriorityUserReject, p)
+	})
+}
+
 func TestTraceIDHexEncoded(t *testing.T) {
 	tid := traceID([16]byte{})
 	tid[15] = 5
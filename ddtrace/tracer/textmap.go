@@ -6,12 +6,16 @@
 package tracer
 
 import (
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
@@ -25,13 +29,20 @@ type HTTPHeadersCarrier http.Header
 
 var _ TextMapWriter = (*HTTPHeadersCarrier)(nil)
 var _ TextMapReader = (*HTTPHeadersCarrier)(nil)
+var _ TextMapSizer = (*HTTPHeadersCarrier)(nil)
 
 // Set implements TextMapWriter.
 func (c HTTPHeadersCarrier) Set(key, val string) {
 	http.Header(c).Set(key, val)
 }
 
-// ForeachKey implements TextMapReader.
+// Len implements TextMapSizer.
+func (c HTTPHeadersCarrier) Len() int {
+	return len(c)
+}
+
+// ForeachKey implements TextMapReader. All the values of the headers are
+// passed in order.
 func (c HTTPHeadersCarrier) ForeachKey(handler func(key, val string) error) error {
 	for k, vals := range c {
 		for _, v := range vals {
@@ -43,18 +54,84 @@ func (c HTTPHeadersCarrier) ForeachKey(handler func(key, val string) error) erro
 	return nil
 }
 
+// conflictingValues reports whether the HTTP headers carrier r holds several
+// different values for any of the given headers, which identify a span context
+// and must have a single value. Equal values are accepted. Other carriers
+// can't hold several values for a key.
+func conflictingValues(r TextMapReader, headers ...string) bool {
+	var h http.Header
+	switch c := r.(type) {
+	case HTTPHeadersCarrier:
+		h = http.Header(c)
+	case RawHTTPHeadersCarrier:
+		h = http.Header(c)
+	default:
+		return false
+	}
+	for k, vals := range h {
+		if len(vals) < 2 {
+			continue
+		}
+		for _, name := range headers {
+			if !strings.EqualFold(k, name) {
+				continue
+			}
+			for _, v := range vals[1:] {
+				if v != vals[0] {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// RawHTTPHeadersCarrier wraps an http.Header as a TextMapWriter and TextMapReader,
+// like HTTPHeadersCarrier, except that keys are written verbatim instead of being
+// canonicalized. It is meant for headers which are forwarded case-sensitively,
+// e.g. to gRPC-web or HTTP/2 backends expecting lowercase keys. Note that values
+// set this way can't be looked up with http.Header.Get unless they are in
+// canonical form.
+type RawHTTPHeadersCarrier http.Header
+
+var _ TextMapWriter = (*RawHTTPHeadersCarrier)(nil)
+var _ TextMapReader = (*RawHTTPHeadersCarrier)(nil)
+
+// Set implements TextMapWriter.
+func (c RawHTTPHeadersCarrier) Set(key, val string) {
+	c[key] = []string{val}
+}
+
+// ForeachKey implements TextMapReader.
+func (c RawHTTPHeadersCarrier) ForeachKey(handler func(key, val string) error) error {
+	return HTTPHeadersCarrier(c).ForeachKey(handler)
+}
+
 // TextMapCarrier allows the use of a regular map[string]string as both TextMapWriter
 // and TextMapReader, making it compatible with the provided Propagator.
 type TextMapCarrier map[string]string
 
 var _ TextMapWriter = (*TextMapCarrier)(nil)
 var _ TextMapReader = (*TextMapCarrier)(nil)
+var _ TextMapGetter = (*TextMapCarrier)(nil)
+var _ TextMapSizer = (*TextMapCarrier)(nil)
 
 // Set implements TextMapWriter.
 func (c TextMapCarrier) Set(key, val string) {
 	c[key] = val
 }
 
+// Get implements TextMapGetter.
+func (c TextMapCarrier) Get(key string) (string, bool) {
+	v, ok := c[key]
+	return v, ok
+}
+
+// Len implements TextMapSizer.
+func (c TextMapCarrier) Len() int {
+	return len(c)
+}
+
 // ForeachKey conforms to the TextMapReader interface.
 func (c TextMapCarrier) ForeachKey(handler func(key, val string) error) error {
 	for k, v := range c {
@@ -102,10 +179,23 @@ const traceTagsHeader = "x-datadog-tags"
 // propagationExtractMaxSize limits the total size of incoming propagated tags to parse
 const propagationExtractMaxSize = 512
 
+// propagationExtractMaxTags limits the number of incoming propagated tags to parse
+const propagationExtractMaxTags = 32
+
+// defaultBaggageWarnSize is the default total size in bytes of the injected
+// baggage above which a warning is logged.
+const defaultBaggageWarnSize = 8 * 1024
+
+// baggageSizeWarned is set once a warning about the size of the injected
+// baggage was logged, to only log it once.
+var baggageSizeWarned uint32
+
 // PropagatorConfig defines the configuration for initializing a propagator.
 type PropagatorConfig struct {
 	// BaggagePrefix specifies the prefix that will be used to store baggage
-	// items in a map. It defaults to DefaultBaggageHeaderPrefix.
+	// items in a map. It defaults to DefaultBaggageHeaderPrefix. A prefix of
+	// any of the Datadog headers, e.g. "x-datadog-", is refused in favor of
+	// the default, as baggage items could overwrite these headers.
 	BaggagePrefix string
 
 	// TraceHeader specifies the map key that will be used to store the trace ID.
@@ -122,11 +212,73 @@ type PropagatorConfig struct {
 
 	// MaxTagsHeaderLen specifies the maximum length of trace tags header value.
 	// It defaults to defaultMaxTagsHeaderLen, a value of 0 disables propagation of tags.
+	// When the tracecontext style is also injected, the upper 64 bits of 128-bit
+	// trace IDs are propagated regardless, to stay consistent with traceparent.
 	MaxTagsHeaderLen int
 
 	// B3 specifies if B3 headers should be added for trace propagation.
 	// See https://github.com/openzipkin/b3-propagation
 	B3 bool
+
+	// CaseSensitiveKeys specifies whether carrier keys should be matched
+	// exactly against the configured headers when extracting Datadog headers.
+	// By default keys are lowercased before comparison, which is correct for
+	// HTTP but not for carriers such as message queue headers where keys
+	// differing in case are distinct. It has no effect on other propagation
+	// styles.
+	CaseSensitiveKeys bool
+
+	// W3CDisableTracestate disables the injection of the W3C tracestate header,
+	// so that only traceparent is propagated when using the tracecontext style.
+	// This is useful for intermediaries which can't handle long tracestate values.
+	// Extraction of tracestate is not affected.
+	W3CDisableTracestate bool
+
+	// W3CBaggage enables the injection of the baggage items in the W3C baggage
+	// header when using the tracecontext style. It is disabled by default, as
+	// the baggage items are already injected by the Datadog style, which would
+	// double the size of the propagated baggage. The W3C baggage header is
+	// always extracted.
+	W3CBaggage bool
+
+	// BaggageWarnSize specifies the total size in bytes of the baggage
+	// injected by a propagator, keys and values included, above which a
+	// warning is logged once and the trace is tagged with the
+	// "baggage_large" propagation error. The baggage is still injected.
+	// It defaults to 8KB, a negative value disables the check.
+	BaggageWarnSize int
+
+	// HexTraceIDs makes the Datadog propagator inject and extract the trace
+	// and parent IDs as 16 lowercase hex digits rather than in decimal. This
+	// is non-standard and disabled by default: it only exists for the interop
+	// with consumers expecting hex IDs in the Datadog headers, and breaks the
+	// propagation with any other Datadog tracer.
+	HexTraceIDs bool
+
+	// InjectOnlyWhenSampled skips the injection entirely, for all the
+	// propagation styles, when the sampling priority of the trace is below
+	// ext.PriorityAutoKeep, i.e. when the trace is dropped. It saves the header
+	// space of high-fanout systems, at the cost of the downstream services
+	// starting new traces and making their own sampling decisions: they can't
+	// keep the dropped trace anymore, e.g. when an error occurs downstream.
+	// Traces without sampling priority are always injected.
+	InjectOnlyWhenSampled bool
+
+	// AllowedOrigins specifies the values of the x-datadog-origin header which
+	// are trusted when extracting Datadog headers. When it's non-empty, other
+	// origins are dropped, and the context is then required to have a parent
+	// ID like any context without a synthetics origin. By default, any origin
+	// is accepted.
+	AllowedOrigins []string
+
+	// ExtractRequestID enables the extraction of the x-request-id header, as
+	// set by Envoy, along with the span context. It is stored as the
+	// _dd.p.request_id propagating tag, which tags the spans of the trace and
+	// is propagated downstream, allowing to join them with the access logs of
+	// the proxy. When the header is found without any span context, Extract
+	// returns a context only holding the request ID, whose TraceID is 0: each
+	// span started with it as parent starts a new trace tagged with it.
+	ExtractRequestID bool
 }
 
 // NewPropagator returns a new propagator which uses TextMap to inject
@@ -155,11 +307,18 @@ func NewPropagator(cfg *PropagatorConfig, propagators ...Propagator) Propagator
 	if cfg.PriorityHeader == "" {
 		cfg.PriorityHeader = DefaultPriorityHeader
 	}
+	if cfg.BaggageWarnSize == 0 {
+		cfg.BaggageWarnSize = defaultBaggageWarnSize
+	}
+	if h := baggagePrefixCollision(cfg); h != "" && cfg.BaggagePrefix != DefaultBaggageHeaderPrefix {
+		log.Error("Ignoring baggage prefix %q: it collides with the %q header, which baggage items would overwrite. Using %q instead.", cfg.BaggagePrefix, h, DefaultBaggageHeaderPrefix)
+		cfg.BaggagePrefix = DefaultBaggageHeaderPrefix
+	}
 	if len(propagators) > 0 {
-		return &chainedPropagator{
-			injectors:  propagators,
-			extractors: propagators,
-		}
+		p := newChainedPropagator(propagators, propagators)
+		p.injectOnlySampled = cfg.InjectOnlyWhenSampled
+		p.extractRequestID = cfg.ExtractRequestID
+		return p
 	}
 	injectorsPs := os.Getenv(headerPropagationStyleInject)
 	if injectorsPs == "" {
@@ -173,9 +332,94 @@ func NewPropagator(cfg *PropagatorConfig, propagators ...Propagator) Propagator
 			log.Warn("%v is deprecated. Please use %v or %v instead.\n", headerPropagationStyleExtractDeprecated, headerPropagationStyleExtract, headerPropagationStyle)
 		}
 	}
-	return &chainedPropagator{
-		injectors:  getPropagators(cfg, injectorsPs),
-		extractors: getPropagators(cfg, extractorsPs),
+	injectors := getPropagators(cfg, injectorsPs)
+	linkTraceIDInjection(injectors)
+	p := newChainedPropagator(injectors, getPropagators(cfg, extractorsPs))
+	p.injectOnlySampled = cfg.InjectOnlyWhenSampled
+	p.extractRequestID = cfg.ExtractRequestID
+	return p
+}
+
+// linkTraceIDInjection makes the Datadog injectors always inject the full
+// 128-bit trace ID when the W3C tracecontext injector is also in use, so that
+// the trace IDs of both styles are consistent.
+func linkTraceIDInjection(injectors []Propagator) {
+	var w3c bool
+	for _, p := range injectors {
+		if _, ok := p.(*propagatorW3c); ok {
+			w3c = true
+		}
+	}
+	if !w3c {
+		return
+	}
+	for _, p := range injectors {
+		if dd, ok := p.(*propagator); ok {
+			dd.injectTID128 = true
+		}
+	}
+}
+
+// baggagePrefixCollision returns the first header identifying the span context
+// which starts with the baggage prefix of cfg, such that injecting baggage
+// items could overwrite it, or an empty string if there is none.
+func baggagePrefixCollision(cfg *PropagatorConfig) string {
+	prefix := cfg.BaggagePrefix
+	for _, h := range [...]string{cfg.TraceHeader, cfg.ParentHeader, cfg.PriorityHeader, originHeader, traceTagsHeader} {
+		if len(h) < len(prefix) {
+			continue
+		}
+		if cfg.CaseSensitiveKeys && strings.HasPrefix(h, prefix) {
+			return h
+		}
+		if !cfg.CaseSensitiveKeys && strings.EqualFold(h[:len(prefix)], prefix) {
+			return h
+		}
+	}
+	return ""
+}
+
+// StripPropagationHeaders removes from h all the headers which the propagators
+// configured with cfg read or write: the Datadog trace, parent, priority,
+// origin and tags headers, the baggage headers, and the headers of the other
+// propagation styles, such as B3 and W3C traceparent, tracestate and baggage.
+// It allows sanitizing the headers of a request before re-emitting them to
+// third-party services. A nil cfg uses the default header names.
+func StripPropagationHeaders(h http.Header, cfg *PropagatorConfig) {
+	if cfg == nil {
+		cfg = new(PropagatorConfig)
+	}
+	names := map[string]bool{
+		originHeader:      true,
+		traceTagsHeader:   true,
+		b3TraceIDHeader:   true,
+		b3SpanIDHeader:    true,
+		b3SampledHeader:   true,
+		b3SingleHeader:    true,
+		traceparentHeader: true,
+		tracestateHeader:  true,
+		baggageHeader:     true,
+		xrayHeader:        true,
+		gcpHeader:         true,
+	}
+	for _, v := range []struct{ name, def string }{
+		{cfg.TraceHeader, DefaultTraceIDHeader},
+		{cfg.ParentHeader, DefaultParentIDHeader},
+		{cfg.PriorityHeader, DefaultPriorityHeader},
+	} {
+		if v.name == "" {
+			v.name = v.def
+		}
+		names[strings.ToLower(v.name)] = true
+	}
+	baggagePrefix := strings.ToLower(cfg.BaggagePrefix)
+	for k := range h {
+		key := strings.ToLower(k)
+		if names[key] ||
+			strings.HasPrefix(key, DefaultBaggageHeaderPrefix) ||
+			(baggagePrefix != "" && strings.HasPrefix(key, baggagePrefix)) {
+			delete(h, k)
+		}
 	}
 }
 
@@ -185,6 +429,57 @@ func NewPropagator(cfg *PropagatorConfig, propagators ...Propagator) Propagator
 type chainedPropagator struct {
 	injectors  []Propagator
 	extractors []Propagator
+
+	// extracted counts the successful extractions of each extractor, by index.
+	// It is reported and reset with the health metrics.
+	extracted []uint32
+
+	// extractFailed counts the extractions for which no extractor succeeded.
+	extractFailed uint32
+
+	// injectOnlySampled skips the injection of dropped traces.
+	injectOnlySampled bool
+
+	// extractRequestID enables the extraction of the x-request-id header.
+	extractRequestID bool
+}
+
+// newChainedPropagator returns a chainedPropagator using the given injectors
+// and extractors.
+func newChainedPropagator(injectors, extractors []Propagator) *chainedPropagator {
+	return &chainedPropagator{
+		injectors:  injectors,
+		extractors: extractors,
+		extracted:  make([]uint32, len(extractors)),
+	}
+}
+
+// namedPropagator is implemented by the propagators of this package, which
+// are named after their propagation style.
+type namedPropagator interface {
+	// name returns the propagation style name of the propagator, as used in
+	// the DD_TRACE_PROPAGATION_STYLE environment variables.
+	name() string
+}
+
+// propagatorStyle returns the propagation style name of p, or "custom" for
+// propagators which are not part of this package.
+func propagatorStyle(p Propagator) string {
+	if np, ok := p.(namedPropagator); ok {
+		return np.name()
+	}
+	return "custom"
+}
+
+// reportExtractMetrics sends the number of extractions done by each extractor
+// since the last call, tagged with its style, as well as the number of failed
+// extractions, to the statsd client.
+func (p *chainedPropagator) reportExtractMetrics(statsd statsdClient) {
+	for i, v := range p.extractors {
+		n := atomic.SwapUint32(&p.extracted[i], 0)
+		statsd.Count("datadog.tracer.propagation.extracted", int64(n), []string{"style:" + propagatorStyle(v)}, 1)
+	}
+	statsd.Count("datadog.tracer.propagation.extract_failed", int64(atomic.SwapUint32(&p.extractFailed, 0)), nil, 1)
 }
 
 // getPropagators returns a list of propagators based on ps, which is a comma seperated
@@ -192,8 +487,9 @@ type chainedPropagator struct {
 // default propagator will be returned. Any invalid values in the list will log
 // a warning and be ignored.
 func getPropagators(cfg *PropagatorConfig, ps string) []Propagator {
-	dd := &propagator{cfg}
-	defaultPs := []Propagator{&propagatorW3c{}, dd}
+	dd := &propagator{cfg: cfg}
+	w3c := &propagatorW3c{cfg}
+	defaultPs := []Propagator{w3c, dd}
 	if cfg.B3 {
 		defaultPs = append(defaultPs, &propagatorB3{})
 	}
@@ -217,7 +513,7 @@ func getPropagators(cfg *PropagatorConfig, ps string) []Propagator {
 		case "datadog":
 			list = append(list, dd)
 		case "tracecontext":
-			list = append([]Propagator{&propagatorW3c{}}, list...)
+			list = append([]Propagator{w3c}, list...)
 		case "b3", "b3multi":
 			if !cfg.B3 {
 				// propagatorB3 hasn't already been added, add a new one.
@@ -225,6 +521,10 @@ func getPropagators(cfg *PropagatorConfig, ps string) []Propagator {
 			}
 		case "b3 single header":
 			list = append(list, &propagatorB3SingleHeader{})
+		case "xray":
+			list = append(list, &propagatorXRay{})
+		case "gcp":
+			list = append(list, &propagatorGCP{})
 		case "none":
 			log.Warn("Propagator \"none\" has no effect when combined with other propagators. " +
 				"To disable the propagator, set to `none`")
@@ -242,6 +542,13 @@ func getPropagators(cfg *PropagatorConfig, ps string) []Propagator {
 // out of the current process. The implementation propagates the
 // TraceID and the current active SpanID, as well as the Span baggage.
 func (p *chainedPropagator) Inject(spanCtx ddtrace.SpanContext, carrier interface{}) error {
+	if p.injectOnlySampled {
+		if ctx, ok := spanCtx.(*spanContext); ok {
+			if sp, ok := ctx.samplingPriority(); ok && sp < ext.PriorityAutoKeep {
+				return nil
+			}
+		}
+	}
 	for _, v := range p.injectors {
 		err := v.Inject(spanCtx, carrier)
 		if err != nil {
@@ -251,29 +558,200 @@ func (p *chainedPropagator) Inject(spanCtx ddtrace.SpanContext, carrier interfac
 	return nil
 }
 
-// Extract implements Propagator.
+// Extract implements Propagator. The context of the first successful extractor
+// is returned. The contexts found by the remaining extractors which differ from
+// it, or whose sampling decision conflicts with its own, are attached to it as
+// span links.
 func (p *chainedPropagator) Extract(carrier interface{}) (ddtrace.SpanContext, error) {
-	for _, v := range p.extractors {
-		ctx, err := v.Extract(carrier)
+	var (
+		ctx   ddtrace.SpanContext
+		style string
+		links []ddtrace.SpanLink
+	)
+	for i, v := range p.extractors {
+		extracted, err := v.Extract(carrier)
 		if ctx != nil {
-			// first extractor returns
-			log.Debug("Extracted span context: %#v", ctx)
-			return ctx, nil
+			if extracted != nil && (!sameSpanContext(ctx, extracted) || conflictingSamplingDecisions(ctx, extracted)) {
+				links = append(links, terminatedContextLink(extracted, propagatorStyle(v)))
+			}
+			continue
+		}
+		if extracted != nil {
+			// first extractor wins
+			ctx, style = extracted, propagatorStyle(v)
+			if i < len(p.extracted) {
+				atomic.AddUint32(&p.extracted[i], 1)
+			}
+			continue
 		}
 		if err == ErrSpanContextNotFound {
 			continue
 		}
+		atomic.AddUint32(&p.extractFailed, 1)
 		return nil, err
 	}
-	return nil, ErrSpanContextNotFound
+	if ctx == nil {
+		if p.extractRequestID {
+			if r, ok := carrier.(TextMapReader); ok {
+				sctx := &spanContext{}
+				if extractRequestID(sctx, r) {
+					log.Debug("Extracted request ID without span context")
+					return sctx, nil
+				}
+			}
+		}
+		atomic.AddUint32(&p.extractFailed, 1)
+		return nil, ErrSpanContextNotFound
+	}
+	if sctx, ok := ctx.(*spanContext); ok && len(links) > 0 {
+		sctx.spanLinks = links
+	}
+	if sctx, ok := ctx.(*spanContext); ok && p.extractRequestID {
+		if r, ok := carrier.(TextMapReader); ok {
+			extractRequestID(sctx, r)
+		}
+	}
+	log.Debug("Extracted span context via %s: %#v", style, ctx)
+	return ctx, nil
+}
+
+// requestIDHeader is the header holding the ID of the request set by Envoy.
+const requestIDHeader = "x-request-id"
+
+// extractRequestID stores the x-request-id header found in r, if any, as the
+// keyRequestID propagating tag of ctx. It reports whether it was stored.
+func extractRequestID(ctx *spanContext, r TextMapReader) bool {
+	id, ok := "", false
+	if g, isGetter := r.(TextMapGetter); isGetter {
+		id, ok = g.Get(requestIDHeader)
+	}
+	if !ok {
+		r.ForeachKey(func(k, v string) error {
+			if !ok && strings.EqualFold(k, requestIDHeader) {
+				id, ok = v, true
+			}
+			return nil
+		})
+	}
+	if !ok || id == "" {
+		return false
+	}
+	if err := isValidPropagatableTag(keyRequestID, id); err != nil {
+		log.Debug("Ignoring %s %q: %v", requestIDHeader, id, err)
+		return false
+	}
+	setPropagatingTag(ctx, keyRequestID, id)
+	return true
+}
+
+// sameSpanContext reports whether a and b identify the same span.
+func sameSpanContext(a, b ddtrace.SpanContext) bool {
+	if a.SpanID() != b.SpanID() || a.TraceID() != b.TraceID() {
+		return false
+	}
+	aw3c, ok := a.(ddtrace.SpanContextW3C)
+	if !ok {
+		return true
+	}
+	bw3c, ok := b.(ddtrace.SpanContextW3C)
+	if !ok {
+		return true
+	}
+	return aw3c.TraceID128Bytes() == bw3c.TraceID128Bytes()
+}
+
+// conflictingSamplingDecisions reports whether a and b both hold a sampling
+// decision, and only one of them keeps the trace.
+func conflictingSamplingDecisions(a, b ddtrace.SpanContext) bool {
+	actx, ok := a.(*spanContext)
+	if !ok {
+		return false
+	}
+	bctx, ok := b.(*spanContext)
+	if !ok {
+		return false
+	}
+	ap, ok := actx.samplingPriority()
+	if !ok {
+		return false
+	}
+	bp, ok := bctx.samplingPriority()
+	if !ok {
+		return false
+	}
+	return (ap > 0) != (bp > 0)
+}
+
+// terminatedContextLink returns a span link to the extracted context ctx,
+// which wasn't chosen as parent.
+func terminatedContextLink(ctx ddtrace.SpanContext, style string) ddtrace.SpanLink {
+	link := ddtrace.SpanLink{
+		TraceID: ctx.TraceID(),
+		SpanID:  ctx.SpanID(),
+		Attributes: map[string]string{
+			"reason":          "terminated_context",
+			"context_headers": style,
+		},
+	}
+	if w3c, ok := ctx.(ddtrace.SpanContextW3C); ok {
+		tid := w3c.TraceID128Bytes()
+		link.TraceIDHigh = binary.BigEndian.Uint64(tid[:8])
+	}
+	if sctx, ok := ctx.(*spanContext); ok {
+		if p, ok := sctx.samplingPriority(); ok && p > 0 {
+			link.Flags = 1
+		}
+		if sctx.trace != nil {
+			link.Tracestate = sctx.trace.propagatingTag(tracestateHeader)
+		}
+	}
+	return link
+}
+
+// encodeSpanLinks returns the JSON representation of links, in the format
+// expected by the agent in the keySpanLinks tag. Trace and span IDs are
+// hex-encoded.
+func encodeSpanLinks(links []ddtrace.SpanLink) string {
+	type spanLink struct {
+		TraceID    string            `json:"trace_id"`
+		SpanID     string            `json:"span_id"`
+		Attributes map[string]string `json:"attributes,omitempty"`
+		Tracestate string            `json:"tracestate,omitempty"`
+		Flags      uint32            `json:"flags,omitempty"`
+	}
+	out := make([]spanLink, len(links))
+	for i, l := range links {
+		out[i] = spanLink{
+			TraceID:    fmt.Sprintf("%016x%016x", l.TraceIDHigh, l.TraceID),
+			SpanID:     fmt.Sprintf("%016x", l.SpanID),
+			Attributes: l.Attributes,
+			Tracestate: l.Tracestate,
+			Flags:      l.Flags,
+		}
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		log.Debug("Failed to encode span links: %v", err)
+		return ""
+	}
+	return string(b)
 }
 
 // propagator implements Propagator and injects/extracts span contexts
 // using datadog headers. Only TextMap carriers are supported.
 type propagator struct {
 	cfg *PropagatorConfig
+
+	// injectTID128 is set when the propagator is chained with the W3C
+	// tracecontext injector, which always carries the full 128-bit trace ID:
+	// the upper 64 bits are then injected in the x-datadog-tags header even
+	// if the propagating tags are disabled or exceed MaxTagsHeaderLen, so
+	// that both styles encode the same trace ID.
+	injectTID128 bool
 }
 
+func (*propagator) name() string { return "datadog" }
+
 func (p *propagator) Inject(spanCtx ddtrace.SpanContext, carrier interface{}) error {
 	switch c := carrier.(type) {
 	case TextMapWriter:
@@ -294,8 +772,8 @@ func (p *propagator) injectTextMap(spanCtx ddtrace.SpanContext, writer TextMapWr
 	} else if ctx.trace != nil {
 		ctx.trace.unsetPropagatingTag(keyTraceID128)
 	}
-	writer.Set(p.cfg.TraceHeader, strconv.FormatUint(ctx.traceID.Lower(), 10))
-	writer.Set(p.cfg.ParentHeader, strconv.FormatUint(ctx.spanID, 10))
+	writer.Set(p.cfg.TraceHeader, p.formatID(ctx.traceID.Lower()))
+	writer.Set(p.cfg.ParentHeader, p.formatID(ctx.spanID))
 	if sp, ok := ctx.samplingPriority(); ok {
 		writer.Set(p.cfg.PriorityHeader, strconv.Itoa(sp))
 	}
@@ -303,14 +781,22 @@ func (p *propagator) injectTextMap(spanCtx ddtrace.SpanContext, writer TextMapWr
 		writer.Set(originHeader, ctx.origin)
 	}
 	// propagate OpenTracing baggage
+	var baggageSize int
 	for k, v := range ctx.baggage {
+		v = escapeHeaderValue(v)
 		writer.Set(p.cfg.BaggagePrefix+k, v)
+		baggageSize += len(p.cfg.BaggagePrefix) + len(k) + len(v)
 	}
-	if p.cfg.MaxTagsHeaderLen <= 0 {
-		return nil
+	checkBaggageSize(p.cfg, ctx, baggageSize)
+	var tags string
+	if p.cfg.MaxTagsHeaderLen > 0 {
+		tags = p.marshalPropagatingTags(ctx)
+	}
+	if tags == "" && p.injectTID128 && ctx.traceID.HasUpper() {
+		tags = keyTraceID128 + "=" + ctx.traceID.UpperHex()
 	}
-	if s := p.marshalPropagatingTags(ctx); len(s) > 0 {
-		writer.Set(traceTagsHeader, s)
+	if len(tags) > 0 {
+		writer.Set(traceTagsHeader, tags)
 	}
 	return nil
 }
@@ -359,43 +845,54 @@ func (p *propagator) Extract(carrier interface{}) (ddtrace.SpanContext, error) {
 }
 
 func (p *propagator) extractTextMap(reader TextMapReader) (ddtrace.SpanContext, error) {
-	var ctx spanContext
-	err := reader.ForeachKey(func(k, v string) error {
-		var err error
-		key := strings.ToLower(k)
-		switch key {
-		case p.cfg.TraceHeader:
-			var lowerTid uint64
-			lowerTid, err = parseUint64(v)
-			if err != nil {
-				return ErrSpanContextCorrupted
-			}
-			ctx.traceID.SetLower(lowerTid)
-		case p.cfg.ParentHeader:
-			ctx.spanID, err = parseUint64(v)
-			if err != nil {
-				return ErrSpanContextCorrupted
+	if conflictingValues(reader, p.cfg.TraceHeader, p.cfg.ParentHeader, p.cfg.PriorityHeader) {
+		return nil, ErrSpanContextCorrupted
+	}
+	var (
+		ctx   spanContext
+		found int
+		err   error
+	)
+	if g, ok := reader.(TextMapGetter); ok {
+		found, err = p.lookupTextMap(&ctx, g)
+	}
+	if s, ok := reader.(TextMapSizer); ok && err == nil {
+		n := s.Len()
+		if found > 0 && n == found {
+			// all the keys of the carrier were looked up, so there are
+			// no baggage items to search for
+			return p.extractedContext(&ctx)
+		}
+		if n-found > baggageMapBucketSize {
+			// the baggage items may not fit the default map, so they
+			// are counted to allocate room for all of them at once
+			if items := p.countBaggage(reader); items > 0 {
+				ctx.reserveBaggage(items)
 			}
-		case p.cfg.PriorityHeader:
-			priority, err := strconv.Atoi(v)
-			if err != nil {
-				return ErrSpanContextCorrupted
+		}
+	}
+	if err == nil {
+		err = reader.ForeachKey(func(k, v string) error {
+			if found == 0 {
+				return p.extractKey(&ctx, k, v)
 			}
-			ctx.setSamplingPriority(priority, samplernames.Unknown)
-		case originHeader:
-			ctx.origin = v
-		case traceTagsHeader:
-			unmarshalPropagatingTags(&ctx, v)
-		default:
-			if strings.HasPrefix(key, p.cfg.BaggagePrefix) {
-				ctx.setBaggageItem(strings.TrimPrefix(key, p.cfg.BaggagePrefix), v)
+			// only the baggage items are left to extract
+			if p.hasBaggagePrefix(k) {
+				return p.extractKey(&ctx, k, v)
 			}
-		}
-		return nil
-	})
+			return nil
+		})
+	}
 	if err != nil {
 		return nil, err
 	}
+	return p.extractedContext(&ctx)
+}
+
+// extractedContext returns ctx once its trace ID is completed with its
+// propagated upper bits, or ErrSpanContextNotFound when it doesn't identify a
+// span.
+func (p *propagator) extractedContext(ctx *spanContext) (ddtrace.SpanContext, error) {
 	if ctx.trace != nil {
 		tid := ctx.trace.propagatingTag(keyTraceID128)
 		if err := validateTID(tid); err != nil {
@@ -406,10 +903,137 @@ func (p *propagator) extractTextMap(reader TextMapReader) (ddtrace.SpanContext,
 			ctx.trace.unsetPropagatingTag(keyTraceID128)
 		}
 	}
-	if ctx.traceID.Empty() || (ctx.spanID == 0 && ctx.origin != "synthetics") {
+	if ctx.traceID.Empty() || (ctx.spanID == 0 && !strings.HasPrefix(ctx.origin, "synthetics")) {
 		return nil, ErrSpanContextNotFound
 	}
-	return &ctx, nil
+	return ctx, nil
+}
+
+// lookupTextMap extracts the headers identifying the span context into ctx
+// with direct lookups, and returns the number of headers found. It returns
+// zero without extracting anything when any of the trace ID, parent ID and
+// sampling priority headers isn't found, e.g. because the carrier holds it
+// with a different case, the carrier having to be searched with ForeachKey.
+func (p *propagator) lookupTextMap(ctx *spanContext, g TextMapGetter) (int, error) {
+	for _, k := range [...]string{p.cfg.TraceHeader, p.cfg.ParentHeader, p.cfg.PriorityHeader} {
+		if _, ok := g.Get(k); !ok {
+			return 0, nil
+		}
+	}
+	var n int
+	for _, k := range [...]string{p.cfg.TraceHeader, p.cfg.ParentHeader, p.cfg.PriorityHeader, originHeader, traceTagsHeader} {
+		if v, ok := g.Get(k); ok {
+			if err := p.extractKey(ctx, k, v); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// baggageMapBucketSize is the number of items held by a map without growing
+// it, below which the extracted baggage isn't pre-sized.
+const baggageMapBucketSize = 8
+
+// countBaggage returns the number of baggage items held by the carrier r.
+func (p *propagator) countBaggage(r TextMapReader) int {
+	var n int
+	r.ForeachKey(func(k, _ string) error {
+		if p.hasBaggagePrefix(k) {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+// hasBaggagePrefix reports whether the carrier key k holds a baggage item,
+// without lowercasing it.
+func (p *propagator) hasBaggagePrefix(k string) bool {
+	prefix := p.cfg.BaggagePrefix
+	if p.cfg.CaseSensitiveKeys {
+		return strings.HasPrefix(k, prefix)
+	}
+	return len(k) >= len(prefix) && strings.EqualFold(k[:len(prefix)], prefix)
+}
+
+// extractKey extracts the carrier key k with value v into ctx.
+func (p *propagator) extractKey(ctx *spanContext, k, v string) error {
+	var err error
+	key := k
+	if !p.cfg.CaseSensitiveKeys {
+		key = strings.ToLower(k)
+	}
+	switch key {
+	case p.cfg.TraceHeader:
+		var lowerTid uint64
+		lowerTid, err = p.parseID(v)
+		if err != nil {
+			return ErrSpanContextCorrupted
+		}
+		ctx.traceID.SetLower(lowerTid)
+	case p.cfg.ParentHeader:
+		ctx.spanID, err = p.parseID(v)
+		if err != nil {
+			return ErrSpanContextCorrupted
+		}
+	case p.cfg.PriorityHeader:
+		priority, err := strconv.Atoi(v)
+		if err != nil || !validPriority(priority) {
+			return ErrSpanContextCorrupted
+		}
+		ctx.setSamplingPriority(priority, samplernames.Unknown)
+	case originHeader:
+		if p.allowedOrigin(v) {
+			ctx.origin = v
+		}
+	case traceTagsHeader:
+		unmarshalPropagatingTags(ctx, v)
+	default:
+		if strings.HasPrefix(key, p.cfg.BaggagePrefix) {
+			ctx.setBaggageItem(strings.TrimPrefix(key, p.cfg.BaggagePrefix), v)
+		}
+	}
+	return nil
+}
+
+// allowedOrigin reports whether the extracted origin can be trusted, as
+// configured with PropagatorConfig.AllowedOrigins.
+func (p *propagator) allowedOrigin(origin string) bool {
+	if len(p.cfg.AllowedOrigins) == 0 {
+		return true
+	}
+	for _, o := range p.cfg.AllowedOrigins {
+		if o == origin {
+			return true
+		}
+	}
+	log.Debug("Dropping the extracted origin %q: it isn't allowed.", origin)
+	return false
+}
+
+// formatID formats the trace or span ID id, in hex when HexTraceIDs is set and
+// in decimal otherwise.
+func (p *propagator) formatID(id uint64) string {
+	if p.cfg.HexTraceIDs {
+		return fmt.Sprintf("%016x", id)
+	}
+	return strconv.FormatUint(id, 10)
+}
+
+// parseID parses a trace or span ID formatted by formatID.
+func (p *propagator) parseID(v string) (uint64, error) {
+	if p.cfg.HexTraceIDs {
+		return strconv.ParseUint(v, 16, 64)
+	}
+	return parseUint64(v)
+}
+
+// validPriority reports whether p is one of the known sampling priorities,
+// ranging from ext.PriorityUserReject to ext.PriorityUserKeep.
+func validPriority(p int) bool {
+	return p >= ext.PriorityUserReject && p <= ext.PriorityUserKeep
 }
 
 func validateTID(tid string) error {
@@ -432,6 +1056,11 @@ func unmarshalPropagatingTags(ctx *spanContext, v string) {
 		ctx.trace.setTag(keyPropagationError, "extract_max_size")
 		return
 	}
+	if i := nthIndexByte(v, ',', propagationExtractMaxTags); i >= 0 {
+		log.Warn("Truncated %s, tag count limit exceeded: %d. Only the first tags will be propagated further.", traceTagsHeader, propagationExtractMaxTags)
+		ctx.trace.setTag(keyPropagationError, "extract_max_tags")
+		v = v[:i]
+	}
 	tags, err := parsePropagatableTraceTags(v)
 	if err != nil {
 		log.Warn("Did not extract %s: %v. Incoming tags will not be propagated further.", traceTagsHeader, err.Error())
@@ -440,6 +1069,20 @@ func unmarshalPropagatingTags(ctx *spanContext, v string) {
 	ctx.trace.replacePropagatingTags(tags)
 }
 
+// nthIndexByte returns the index of the nth instance of c in s, or -1 if
+// s holds fewer than n instances of c.
+func nthIndexByte(s string, c byte, n int) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] != c {
+			continue
+		}
+		if n--; n == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
 // setPropagatingTag adds the key value pair to the map of propagating tags on the trace,
 // creating the map if one is not initialized.
 func setPropagatingTag(ctx *spanContext, k, v string) {
@@ -461,6 +1104,8 @@ const (
 // using B3 headers. Only TextMap carriers are supported.
 type propagatorB3 struct{}
 
+func (*propagatorB3) name() string { return "b3multi" }
+
 func (p *propagatorB3) Inject(spanCtx ddtrace.SpanContext, carrier interface{}) error {
 	switch c := carrier.(type) {
 	case TextMapWriter:
@@ -505,6 +1150,9 @@ func (p *propagatorB3) Extract(carrier interface{}) (ddtrace.SpanContext, error)
 }
 
 func (*propagatorB3) extractTextMap(reader TextMapReader) (ddtrace.SpanContext, error) {
+	if conflictingValues(reader, b3TraceIDHeader, b3SpanIDHeader, b3SampledHeader) {
+		return nil, ErrSpanContextCorrupted
+	}
 	var ctx spanContext
 	err := reader.ForeachKey(func(k, v string) error {
 		var err error
@@ -542,6 +1190,8 @@ func (*propagatorB3) extractTextMap(reader TextMapReader) (ddtrace.SpanContext,
 // using B3 headers. Only TextMap carriers are supported.
 type propagatorB3SingleHeader struct{}
 
+func (*propagatorB3SingleHeader) name() string { return "b3 single header" }
+
 func (p *propagatorB3SingleHeader) Inject(spanCtx ddtrace.SpanContext, carrier interface{}) error {
 	switch c := carrier.(type) {
 	case TextMapWriter:
@@ -589,6 +1239,9 @@ func (p *propagatorB3SingleHeader) Extract(carrier interface{}) (ddtrace.SpanCon
 }
 
 func (*propagatorB3SingleHeader) extractTextMap(reader TextMapReader) (ddtrace.SpanContext, error) {
+	if conflictingValues(reader, b3SingleHeader) {
+		return nil, ErrSpanContextCorrupted
+	}
 	var ctx spanContext
 	err := reader.ForeachKey(func(k, v string) error {
 		var err error
@@ -632,14 +1285,234 @@ func (*propagatorB3SingleHeader) extractTextMap(reader TextMapReader) (ddtrace.S
 	return &ctx, nil
 }
 
+// xrayHeader is the header holding the AWS X-Ray trace context, e.g.
+// "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1".
+const xrayHeader = "x-amzn-trace-id"
+
+// propagatorXRay implements Propagator and injects/extracts span contexts
+// using the AWS X-Ray trace header. Only TextMap carriers are supported.
+//
+// X-Ray trace IDs are made of a version, the 32-bit start time of the trace in
+// epoch seconds and 96 random bits, e.g. "1-5759e988-bd862e3fe1be46a994272793".
+// The time and the random bits are mapped as-is to a 128-bit trace ID, which
+// keeps the start time in the 32 leading bits, like the generated 128-bit trace
+// IDs.
+type propagatorXRay struct{}
+
+func (*propagatorXRay) name() string { return "xray" }
+
+func (p *propagatorXRay) Inject(spanCtx ddtrace.SpanContext, carrier interface{}) error {
+	switch c := carrier.(type) {
+	case TextMapWriter:
+		return p.injectTextMap(spanCtx, c)
+	default:
+		return ErrInvalidCarrier
+	}
+}
+
+func (*propagatorXRay) injectTextMap(spanCtx ddtrace.SpanContext, writer TextMapWriter) error {
+	ctx, ok := spanCtx.(*spanContext)
+	if !ok || ctx.traceID.Empty() || ctx.spanID == 0 {
+		return ErrInvalidSpanContext
+	}
+	traceID := fmt.Sprintf("%032x", ctx.traceID.Lower())
+	if ctx.traceID.HasUpper() {
+		var w3Cctx ddtrace.SpanContextW3C
+		if w3Cctx, ok = spanCtx.(ddtrace.SpanContextW3C); !ok {
+			return ErrInvalidSpanContext
+		}
+		traceID = w3Cctx.TraceID128()
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Root=1-%s-%s;Parent=%016x", traceID[:8], traceID[8:], ctx.spanID))
+	if p, ok := ctx.samplingPriority(); ok {
+		if p >= ext.PriorityAutoKeep {
+			sb.WriteString(";Sampled=1")
+		} else {
+			sb.WriteString(";Sampled=0")
+		}
+	}
+	writer.Set(xrayHeader, sb.String())
+	return nil
+}
+
+func (p *propagatorXRay) Extract(carrier interface{}) (ddtrace.SpanContext, error) {
+	switch c := carrier.(type) {
+	case TextMapReader:
+		return p.extractTextMap(c)
+	default:
+		return nil, ErrInvalidCarrier
+	}
+}
+
+func (*propagatorXRay) extractTextMap(reader TextMapReader) (ddtrace.SpanContext, error) {
+	if conflictingValues(reader, xrayHeader) {
+		return nil, ErrSpanContextCorrupted
+	}
+	var ctx spanContext
+	err := reader.ForeachKey(func(k, v string) error {
+		if strings.ToLower(k) != xrayHeader {
+			return nil
+		}
+		for _, part := range strings.Split(v, ";") {
+			key, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch key {
+			case "Root":
+				// 1-<8 hex digits>-<24 hex digits>
+				if len(val) != 35 || val[:2] != "1-" || val[10] != '-' {
+					return ErrSpanContextCorrupted
+				}
+				upper, err := strconv.ParseUint(val[2:10]+val[11:19], 16, 64)
+				if err != nil {
+					return ErrSpanContextCorrupted
+				}
+				lower, err := strconv.ParseUint(val[19:], 16, 64)
+				if err != nil {
+					return ErrSpanContextCorrupted
+				}
+				ctx.traceID.SetUpper(upper)
+				ctx.traceID.SetLower(lower)
+			case "Parent":
+				var err error
+				if ctx.spanID, err = strconv.ParseUint(val, 16, 64); err != nil {
+					return ErrSpanContextCorrupted
+				}
+			case "Sampled":
+				switch val {
+				case "1":
+					ctx.setSamplingPriority(ext.PriorityAutoKeep, samplernames.Unknown)
+				case "0":
+					ctx.setSamplingPriority(ext.PriorityAutoReject, samplernames.Unknown)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ctx.traceID.Empty() || ctx.spanID == 0 {
+		return nil, ErrSpanContextNotFound
+	}
+	return &ctx, nil
+}
+
+// gcpHeader is the header holding the Google Cloud trace context, e.g.
+// "105445aa7843bc8bf206b12000100000/1;o=1", made of a 32 hex digit trace ID,
+// a decimal span ID and an optional sampled flag.
+const gcpHeader = "x-cloud-trace-context"
+
+// propagatorGCP implements Propagator and injects/extracts span contexts
+// using the Google Cloud trace context header, as set by Google Cloud Load
+// Balancing. Only TextMap carriers are supported.
+type propagatorGCP struct{}
+
+func (*propagatorGCP) name() string { return "gcp" }
+
+func (p *propagatorGCP) Inject(spanCtx ddtrace.SpanContext, carrier interface{}) error {
+	switch c := carrier.(type) {
+	case TextMapWriter:
+		return p.injectTextMap(spanCtx, c)
+	default:
+		return ErrInvalidCarrier
+	}
+}
+
+func (*propagatorGCP) injectTextMap(spanCtx ddtrace.SpanContext, writer TextMapWriter) error {
+	ctx, ok := spanCtx.(*spanContext)
+	if !ok || ctx.traceID.Empty() || ctx.spanID == 0 {
+		return ErrInvalidSpanContext
+	}
+	traceID := fmt.Sprintf("%032x", ctx.traceID.Lower())
+	if ctx.traceID.HasUpper() {
+		var w3Cctx ddtrace.SpanContextW3C
+		if w3Cctx, ok = spanCtx.(ddtrace.SpanContextW3C); !ok {
+			return ErrInvalidSpanContext
+		}
+		traceID = w3Cctx.TraceID128()
+	}
+	var sb strings.Builder
+	sb.WriteString(traceID)
+	sb.WriteByte('/')
+	sb.WriteString(strconv.FormatUint(ctx.spanID, 10))
+	if p, ok := ctx.samplingPriority(); ok {
+		if p >= ext.PriorityAutoKeep {
+			sb.WriteString(";o=1")
+		} else {
+			sb.WriteString(";o=0")
+		}
+	}
+	writer.Set(gcpHeader, sb.String())
+	return nil
+}
+
+func (p *propagatorGCP) Extract(carrier interface{}) (ddtrace.SpanContext, error) {
+	switch c := carrier.(type) {
+	case TextMapReader:
+		return p.extractTextMap(c)
+	default:
+		return nil, ErrInvalidCarrier
+	}
+}
+
+func (*propagatorGCP) extractTextMap(reader TextMapReader) (ddtrace.SpanContext, error) {
+	if conflictingValues(reader, gcpHeader) {
+		return nil, ErrSpanContextCorrupted
+	}
+	var ctx spanContext
+	err := reader.ForeachKey(func(k, v string) error {
+		if strings.ToLower(k) != gcpHeader {
+			return nil
+		}
+		v, options, _ := strings.Cut(strings.TrimSpace(v), ";")
+		traceID, spanID, ok := strings.Cut(v, "/")
+		if !ok || len(traceID) != 32 {
+			return ErrSpanContextCorrupted
+		}
+		upper, err := strconv.ParseUint(traceID[:16], 16, 64)
+		if err != nil {
+			return ErrSpanContextCorrupted
+		}
+		lower, err := strconv.ParseUint(traceID[16:], 16, 64)
+		if err != nil {
+			return ErrSpanContextCorrupted
+		}
+		ctx.traceID.SetUpper(upper)
+		ctx.traceID.SetLower(lower)
+		if ctx.spanID, err = strconv.ParseUint(spanID, 10, 64); err != nil {
+			return ErrSpanContextCorrupted
+		}
+		switch options {
+		case "o=1":
+			ctx.setSamplingPriority(ext.PriorityAutoKeep, samplernames.Unknown)
+		case "o=0":
+			ctx.setSamplingPriority(ext.PriorityAutoReject, samplernames.Unknown)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ctx.traceID.Empty() || ctx.spanID == 0 {
+		return nil, ErrSpanContextNotFound
+	}
+	return &ctx, nil
+}
+
 const (
 	traceparentHeader = "traceparent"
 	tracestateHeader  = "tracestate"
+	baggageHeader     = "baggage"
 )
 
 // propagatorW3c implements Propagator and injects/extracts span contexts
-// using W3C tracecontext/traceparent headers. Only TextMap carriers are supported.
-type propagatorW3c struct{}
+// using W3C tracecontext/traceparent headers, along with baggage items using
+// the W3C baggage header. Only TextMap carriers are supported.
+type propagatorW3c struct {
+	cfg *PropagatorConfig
+}
+
+func (*propagatorW3c) name() string { return "tracecontext" }
 
 func (p *propagatorW3c) Inject(spanCtx ddtrace.SpanContext, carrier interface{}) error {
 	switch c := carrier.(type) {
@@ -658,14 +1531,14 @@ func (p *propagatorW3c) Inject(spanCtx ddtrace.SpanContext, carrier interface{})
 // which is equal to 00000001 when no other flag is present.
 // tracestateHeader is a comma-separated list of list-members with a <key>=<value> format,
 // where each list-member is managed by a vendor or instrumentation library.
-func (*propagatorW3c) injectTextMap(spanCtx ddtrace.SpanContext, writer TextMapWriter) error {
+func (p *propagatorW3c) injectTextMap(spanCtx ddtrace.SpanContext, writer TextMapWriter) error {
 	ctx, ok := spanCtx.(*spanContext)
 	if !ok || ctx.traceID.Empty() || ctx.spanID == 0 {
 		return ErrInvalidSpanContext
 	}
 	flags := ""
-	p, ok := ctx.samplingPriority()
-	if ok && p >= ext.PriorityAutoKeep {
+	priority, ok := ctx.samplingPriority()
+	if ok && priority >= ext.PriorityAutoKeep {
 		flags = "01"
 	} else {
 		flags = "00"
@@ -684,19 +1557,173 @@ func (*propagatorW3c) injectTextMap(spanCtx ddtrace.SpanContext, writer TextMapW
 		}
 	}
 	writer.Set(traceparentHeader, fmt.Sprintf("00-%s-%016x-%v", traceID, ctx.spanID, flags))
-	// if context priority / origin / tags were updated after extraction,
-	// or the tracestateHeader doesn't start with `dd=`
-	// we need to recreate tracestate
-	if ctx.updated ||
-		(ctx.trace != nil && !strings.HasPrefix(ctx.trace.propagatingTag(tracestateHeader), "dd=")) ||
-		ctx.trace.propagatingTagsLen() == 0 {
-		writer.Set(tracestateHeader, composeTracestate(ctx, p, ctx.trace.propagatingTag(tracestateHeader)))
-	} else {
-		writer.Set(tracestateHeader, ctx.trace.propagatingTag(tracestateHeader))
+	if p.cfg == nil || !p.cfg.W3CDisableTracestate {
+		p.injectTracestate(ctx, priority, writer)
+	}
+	if p.cfg != nil && p.cfg.W3CBaggage {
+		if b := composeBaggage(ctx); b != "" {
+			writer.Set(baggageHeader, b)
+			checkBaggageSize(p.cfg, ctx, len(baggageHeader)+len(b))
+		}
 	}
 	return nil
 }
 
+// injectTracestate sets the tracestateHeader on the writer. The extracted
+// tracestate is propagated as-is when it starts with the Datadog list-member
+// and neither the priority, the origin nor the propagating tags were updated
+// since the extraction. Otherwise, e.g. for a locally started root span without
+// tracestate, a new one is composed, always starting with "dd=s:<priority>".
+func (*propagatorW3c) injectTracestate(ctx *spanContext, priority int, writer TextMapWriter) {
+	var oldState string
+	if ctx.trace != nil {
+		oldState = ctx.trace.propagatingTag(tracestateHeader)
+	}
+	if !ctx.updated && strings.HasPrefix(oldState, "dd=") {
+		writer.Set(tracestateHeader, oldState)
+		return
+	}
+	writer.Set(tracestateHeader, composeTracestate(ctx, priority, oldState))
+}
+
+// checkBaggageSize tags the trace of ctx with a propagation error when the size
+// of the injected baggage exceeds the BaggageWarnSize of cfg, logging a warning
+// the first time it happens.
+func checkBaggageSize(cfg *PropagatorConfig, ctx *spanContext, size int) {
+	max := defaultBaggageWarnSize
+	if cfg != nil && cfg.BaggageWarnSize != 0 {
+		max = cfg.BaggageWarnSize
+	}
+	if max < 0 || size <= max {
+		return
+	}
+	if atomic.CompareAndSwapUint32(&baggageSizeWarned, 0, 1) {
+		log.Warn("Injected baggage of %d bytes exceeds %d bytes, which may exceed the header size limits of proxies and servers.", size, max)
+	}
+	if ctx.trace != nil {
+		ctx.trace.setTag(keyPropagationError, "baggage_large")
+	}
+}
+
+// composeBaggage creates a W3C baggage header from the baggage items of ctx.
+// Keys and values are percent-encoded, and members are separated by commas.
+// See https://www.w3.org/TR/baggage/#header-content
+func composeBaggage(ctx *spanContext) string {
+	var b strings.Builder
+	ctx.ForeachBaggageItem(func(k, v string) bool {
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(escapeBaggageKey(k))
+		b.WriteByte('=')
+		b.WriteString(escapeBaggageValue(v))
+		return true
+	})
+	return b.String()
+}
+
+// escapeBaggageKey percent-encodes the bytes of the baggage key k which aren't
+// allowed in the keys of the W3C baggage header, which are tokens, like the
+// equals sign, so that the header can be parsed back. Keys without such bytes
+// are unchanged.
+// See https://www.w3.org/TR/baggage/#key
+func escapeBaggageKey(k string) string {
+	return percentEncode(k, isTokenChar)
+}
+
+// escapeBaggageValue percent-encodes the bytes of the baggage value v which
+// aren't allowed in the values of the W3C baggage header, like non-ASCII bytes,
+// control characters, whitespace and the percent sign itself, so that it can
+// be set as a header value safely. Values without such bytes are unchanged.
+// See https://www.w3.org/TR/baggage/#value
+func escapeBaggageValue(v string) string {
+	return percentEncode(v, isBaggageOctet)
+}
+
+// percentEncode percent-encodes the bytes of s for which allowed returns false.
+func percentEncode(s string, allowed func(c byte) bool) string {
+	var n int
+	for i := 0; i < len(s); i++ {
+		if !allowed(s[i]) {
+			n++
+		}
+	}
+	if n == 0 {
+		return s
+	}
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	b.Grow(len(s) + 2*n)
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; allowed(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+	}
+	return b.String()
+}
+
+// escapeHeaderValue percent-encodes the bytes of v which are invalid in a
+// header value, i.e. control characters and non-ASCII bytes. Other bytes,
+// including the percent sign, are unchanged, as the values of the Datadog
+// baggage headers are sent and extracted verbatim by the Datadog tracers.
+func escapeHeaderValue(v string) string {
+	return percentEncode(v, isHeaderValueChar)
+}
+
+// isHeaderValueChar reports whether c is a printable ASCII character, which
+// can be set in a header value as is.
+func isHeaderValueChar(c byte) bool {
+	return c >= 0x20 && c < 0x7f
+}
+
+// isTokenChar reports whether c is allowed in the keys of the W3C baggage
+// header, as a character of an RFC 7230 token other than the percent sign,
+// which is used to encode the other ones.
+func isTokenChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&'*+-.^_`|~", c) >= 0
+}
+
+// isBaggageOctet reports whether c is allowed in the values of the W3C baggage
+// header without being percent-encoded.
+func isBaggageOctet(c byte) bool {
+	switch c {
+	case '"', ',', ';', '\\', '%':
+		return false
+	}
+	return c >= 0x21 && c <= 0x7e
+}
+
+// parseBaggage parses the W3C baggage header and stores its list-members as
+// baggage items of ctx. Metadata properties following a member's value are
+// discarded, as well as malformed members.
+func parseBaggage(ctx *spanContext, header string) {
+	for _, member := range strings.Split(header, ",") {
+		if i := strings.IndexByte(member, ';'); i >= 0 {
+			// discard properties
+			member = member[:i]
+		}
+		k, v, ok := strings.Cut(member, "=")
+		if !ok {
+			continue
+		}
+		k, errk := url.PathUnescape(strings.TrimSpace(k))
+		v, errv := url.PathUnescape(strings.TrimSpace(v))
+		if errk != nil || errv != nil || k == "" {
+			log.Debug("Ignoring malformed baggage member %q", member)
+			continue
+		}
+		ctx.setBaggageItem(k, v)
+	}
+}
+
 var (
 	// keyRgx is used to sanitize the keys of the datadog propagating tags.
 	// Disallowed characters are comma (reserved as a list-member separator),
@@ -737,7 +1764,6 @@ func composeTracestate(ctx *spanContext, priority int, oldState string) string {
 	var b strings.Builder
 	b.Grow(128)
 	b.WriteString(fmt.Sprintf("dd=s:%d", priority))
-	listLength := 1
 
 	if ctx.origin != "" {
 		oWithSub := originRgx.ReplaceAllString(ctx.origin, "_")
@@ -745,6 +1771,9 @@ func composeTracestate(ctx *spanContext, priority int, oldState string) string {
 			strings.ReplaceAll(oWithSub, "=", "~")))
 	}
 
+	if ctx.trace == nil {
+		return b.String()
+	}
 	ctx.trace.iteratePropagatingTags(func(k, v string) bool {
 		if !strings.HasPrefix(k, "_dd.p.") {
 			return true
@@ -762,22 +1791,64 @@ func composeTracestate(ctx *spanContext, priority int, oldState string) string {
 		return true
 	})
 	// the old state is split by vendors, must be concatenated with a `,`
-	if len(oldState) == 0 {
-		return b.String()
+	for _, m := range foreignTracestateMembers(oldState, tracestateMaxLen-b.Len()) {
+		b.WriteByte(',')
+		b.WriteString(m)
 	}
-	for _, s := range strings.Split(strings.Trim(oldState, " \t"), ",") {
-		if strings.HasPrefix(s, "dd=") {
+	return b.String()
+}
+
+const (
+	// tracestateMaxMembers is the maximum number of list-members of the
+	// tracestate header.
+	tracestateMaxMembers = 32
+	// tracestateMaxLen is the length of the tracestate header which vendors
+	// must be able to propagate, above which list-members are dropped.
+	tracestateMaxLen = 512
+	// tracestateLongMember is the length above which list-members are dropped
+	// first when the tracestate header is too long.
+	tracestateLongMember = 128
+)
+
+// foreignTracestateMembers returns the list-members of the tracestate header
+// state other than the dd one, fitting in space bytes once each of them is
+// preceded by a comma. As recommended by
+// https://www.w3.org/TR/trace-context/#tracestate-limits, only whole
+// list-members are dropped: the ones beyond the maximum number of list-members,
+// then, if the header is still too long, the ones longer than 128 characters,
+// and finally the other ones from the tail.
+func foreignTracestateMembers(state string, space int) []string {
+	var (
+		members []string
+		size    int // the size of the members, each preceded by a comma
+	)
+	for _, m := range strings.Split(state, ",") {
+		m = strings.Trim(m, " \t")
+		if m == "" || strings.HasPrefix(m, "dd=") {
 			continue
 		}
-		listLength++
-		// if the resulting tracestateHeader exceeds 32 list-members,
-		// remove the rightmost list-member(s)
-		if listLength > 32 {
+		if len(members) == tracestateMaxMembers-1 {
 			break
 		}
-		b.WriteString("," + strings.Trim(s, " \t"))
+		members = append(members, m)
+		size += 1 + len(m)
 	}
-	return b.String()
+	if size <= space {
+		return members
+	}
+	kept := members[:0]
+	for _, m := range members {
+		if len(m) > tracestateLongMember {
+			size -= 1 + len(m)
+			continue
+		}
+		kept = append(kept, m)
+	}
+	for len(kept) > 0 && size > space {
+		size -= 1 + len(kept[len(kept)-1])
+		kept = kept[:len(kept)-1]
+	}
+	return kept
 }
 
 func (p *propagatorW3c) Extract(carrier interface{}) (ddtrace.SpanContext, error) {
@@ -790,6 +1861,9 @@ func (p *propagatorW3c) Extract(carrier interface{}) (ddtrace.SpanContext, error
 }
 
 func (*propagatorW3c) extractTextMap(reader TextMapReader) (ddtrace.SpanContext, error) {
+	if conflictingValues(reader, traceparentHeader) {
+		return nil, ErrSpanContextCorrupted
+	}
 	var parentHeader string
 	var stateHeader string
 	var ctx spanContext
@@ -804,6 +1878,8 @@ func (*propagatorW3c) extractTextMap(reader TextMapReader) (ddtrace.SpanContext,
 			parentHeader = v
 		case tracestateHeader:
 			stateHeader = v
+		case baggageHeader:
+			parseBaggage(&ctx, v)
 		default:
 			if strings.HasPrefix(key, DefaultBaggageHeaderPrefix) {
 				ctx.setBaggageItem(strings.TrimPrefix(key, DefaultBaggageHeaderPrefix), v)
@@ -14,8 +14,10 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/httpmem"
@@ -77,6 +79,111 @@ func TestHTTPHeadersCarrierForeachKeyError(t *testing.T) {
 	assert.Equal(t, want, got)
 }
 
+func TestHTTPHeadersCarrierForeachKeyMultipleValues(t *testing.T) {
+	h := http.Header{}
+	h.Add(DefaultTraceIDHeader, "1")
+	h.Add(DefaultTraceIDHeader, "1")
+	h.Add(baggageHeader, "a=1")
+	h.Add(baggageHeader, "b=2")
+	var got []string
+	err := HTTPHeadersCarrier(h).ForeachKey(func(k, v string) error {
+		got = append(got, k+": "+v)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"X-Datadog-Trace-Id: 1", "X-Datadog-Trace-Id: 1", "Baggage: a=1", "Baggage: b=2"}, got)
+}
+
+func TestExtractConflictingValues(t *testing.T) {
+	headers := func() http.Header {
+		h := http.Header{}
+		h.Set(DefaultTraceIDHeader, "1")
+		h.Set(DefaultParentIDHeader, "2")
+		h.Set(traceparentHeader, "00-00000000000000000000000000000001-0000000000000002-01")
+		return h
+	}
+
+	t.Run("datadog", func(t *testing.T) {
+		t.Setenv(headerPropagationStyleExtract, "datadog")
+		prop := NewPropagator(nil)
+		for _, header := range []string{DefaultTraceIDHeader, DefaultParentIDHeader} {
+			h := headers()
+			h.Add(header, "3")
+			_, err := prop.Extract(HTTPHeadersCarrier(h))
+			assert.Equal(t, ErrSpanContextCorrupted, err, header)
+			_, err = prop.Extract(RawHTTPHeadersCarrier(h))
+			assert.Equal(t, ErrSpanContextCorrupted, err, header)
+
+			// equal values are accepted
+			h = headers()
+			h.Add(header, h.Get(header))
+			ctx, err := prop.Extract(HTTPHeadersCarrier(h))
+			assert.NoError(t, err, header)
+			assert.Equal(t, uint64(2), ctx.SpanID())
+		}
+
+		// the headers of the other styles are ignored
+		h := headers()
+		h.Add(traceparentHeader, "00-00000000000000000000000000000003-0000000000000004-01")
+		ctx, err := prop.Extract(HTTPHeadersCarrier(h))
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), ctx.SpanID())
+	})
+
+	t.Run("tracecontext", func(t *testing.T) {
+		t.Setenv(headerPropagationStyleExtract, "tracecontext")
+		prop := NewPropagator(nil)
+		h := headers()
+		h.Add(traceparentHeader, "00-00000000000000000000000000000003-0000000000000004-01")
+		_, err := prop.Extract(HTTPHeadersCarrier(h))
+		assert.Equal(t, ErrSpanContextCorrupted, err)
+
+		// the headers of the other styles are ignored
+		h = headers()
+		h.Add(DefaultTraceIDHeader, "3")
+		ctx, err := prop.Extract(HTTPHeadersCarrier(h))
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), ctx.SpanID())
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		t.Setenv(headerPropagationStyleExtract, "datadog")
+		prop := NewPropagator(&PropagatorConfig{TraceHeader: "my-trace-id", ParentHeader: "my-parent-id"})
+		h := http.Header{}
+		h.Set("my-trace-id", "1")
+		h.Set("my-parent-id", "2")
+		h.Add("my-trace-id", "3")
+		_, err := prop.Extract(HTTPHeadersCarrier(h))
+		assert.Equal(t, ErrSpanContextCorrupted, err)
+	})
+}
+
+func TestRawHTTPHeadersCarrierSet(t *testing.T) {
+	h := http.Header{}
+	c := RawHTTPHeadersCarrier(h)
+	c.Set("x-datadog-trace-id", "1")
+	c.Set("x-datadog-trace-id", "2")
+	assert.Equal(t, http.Header{"x-datadog-trace-id": {"2"}}, h)
+}
+
+func TestRawHTTPHeadersCarrierPropagation(t *testing.T) {
+	t.Setenv(headerPropagationStyle, "datadog")
+	tracer := newTracer()
+	defer tracer.Stop()
+	assert := assert.New(t)
+
+	root := tracer.StartSpan("web.request").(*span)
+	h := http.Header{}
+	assert.NoError(tracer.Inject(root.Context(), RawHTTPHeadersCarrier(h)))
+	assert.Equal([]string{strconv.FormatUint(root.TraceID, 10)}, h[DefaultTraceIDHeader])
+	assert.Equal([]string{strconv.FormatUint(root.SpanID, 10)}, h[DefaultParentIDHeader])
+
+	ctx, err := tracer.Extract(RawHTTPHeadersCarrier(h))
+	assert.NoError(err)
+	assert.Equal(root.TraceID, ctx.TraceID())
+	assert.Equal(root.SpanID, ctx.SpanID())
+}
+
 func TestTextMapCarrierSet(t *testing.T) {
 	m := map[string]string{}
 	c := TextMapCarrier(m)
@@ -134,6 +241,15 @@ func TestTextMapPropagatorErrors(t *testing.T) {
 	}))
 	assert.Equal(ErrSpanContextCorrupted, err)
 
+	for _, p := range []string{"-2", "3", "999999"} {
+		_, err = propagator.Extract(TextMapCarrier(map[string]string{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "2",
+			DefaultPriorityHeader: p,
+		}))
+		assert.Equal(ErrSpanContextCorrupted, err, p)
+	}
+
 	_, err = propagator.Extract(TextMapCarrier(map[string]string{
 		DefaultTraceIDHeader:  "0",
 		DefaultParentIDHeader: "0",
@@ -270,24 +386,286 @@ func TestTextMapPropagatorTraceTagsWithoutPriority(t *testing.T) {
 
 func TestExtractOriginSynthetics(t *testing.T) {
 	t.Setenv(headerPropagationStyleExtract, "datadog")
-	src := TextMapCarrier(map[string]string{
-		originHeader:          "synthetics",
-		DefaultTraceIDHeader:  "3",
-		DefaultParentIDHeader: "0",
-	})
 	tracer := newTracer()
 	defer tracer.Stop()
-	ctx, err := tracer.Extract(src)
-	if err != nil {
-		t.Fatal(err)
+	for _, origin := range []string{"synthetics", "synthetics-browser"} {
+		t.Run(origin, func(t *testing.T) {
+			src := TextMapCarrier(map[string]string{
+				originHeader:          origin,
+				DefaultTraceIDHeader:  "3",
+				DefaultParentIDHeader: "0",
+			})
+			ctx, err := tracer.Extract(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sctx, ok := ctx.(*spanContext)
+			if !ok {
+				t.Fatal("not a *spanContext")
+			}
+			assert.Equal(t, sctx.spanID, uint64(0))
+			assert.Equal(t, sctx.traceID.Lower(), uint64(3))
+			assert.Equal(t, sctx.origin, origin)
+		})
 	}
-	sctx, ok := ctx.(*spanContext)
-	if !ok {
-		t.Fatal("not a *spanContext")
+	t.Run("other", func(t *testing.T) {
+		src := TextMapCarrier(map[string]string{
+			originHeader:          "rum",
+			DefaultTraceIDHeader:  "3",
+			DefaultParentIDHeader: "0",
+		})
+		_, err := tracer.Extract(src)
+		assert.Equal(t, ErrSpanContextNotFound, err)
+	})
+}
+
+func TestTextMapPropagatorCaseSensitiveKeys(t *testing.T) {
+	t.Setenv(headerPropagationStyleExtract, "datadog")
+	t.Run("default", func(t *testing.T) {
+		prop := NewPropagator(nil)
+		ctx, err := prop.Extract(TextMapCarrier{
+			"X-Datadog-Trace-Id":  "1",
+			"X-Datadog-Parent-Id": "2",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1), ctx.TraceID())
+		assert.Equal(t, uint64(2), ctx.SpanID())
+	})
+	t.Run("exact", func(t *testing.T) {
+		prop := NewPropagator(&PropagatorConfig{
+			TraceHeader:       "X-Datadog-Trace-Id",
+			ParentHeader:      "X-Datadog-Parent-Id",
+			BaggagePrefix:     "Ot-Baggage-",
+			CaseSensitiveKeys: true,
+		})
+		ctx, err := prop.Extract(TextMapCarrier{
+			"X-Datadog-Trace-Id":  "1",
+			"X-Datadog-Parent-Id": "2",
+			"x-datadog-trace-id":  "3",
+			"x-datadog-parent-id": "4",
+			"Ot-Baggage-Item":     "val",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1), ctx.TraceID())
+		assert.Equal(t, uint64(2), ctx.SpanID())
+		assert.Equal(t, "val", ctx.(*spanContext).baggageItem("Item"))
+	})
+	t.Run("mismatch", func(t *testing.T) {
+		prop := NewPropagator(&PropagatorConfig{CaseSensitiveKeys: true})
+		_, err := prop.Extract(TextMapCarrier{
+			"X-Datadog-Trace-Id":  "1",
+			"X-Datadog-Parent-Id": "2",
+		})
+		assert.Equal(t, ErrSpanContextNotFound, err)
+	})
+}
+
+// foreachKeyCarrier is a TextMapReader which doesn't implement TextMapGetter.
+type foreachKeyCarrier map[string]string
+
+func (c foreachKeyCarrier) ForeachKey(handler func(key, val string) error) error {
+	return TextMapCarrier(c).ForeachKey(handler)
+}
+
+func TestNewPropagatorBaggagePrefixCollision(t *testing.T) {
+	for _, tc := range []struct {
+		cfg    PropagatorConfig
+		prefix string
+	}{
+		{PropagatorConfig{BaggagePrefix: "x-datadog-"}, DefaultBaggageHeaderPrefix},
+		{PropagatorConfig{BaggagePrefix: "X-Datadog-Trace-Id"}, DefaultBaggageHeaderPrefix},
+		{PropagatorConfig{BaggagePrefix: "x-datadog-origin"}, DefaultBaggageHeaderPrefix},
+		{PropagatorConfig{BaggagePrefix: "X-Datadog-", CaseSensitiveKeys: true}, "X-Datadog-"},
+		{PropagatorConfig{BaggagePrefix: "my-", TraceHeader: "my-trace-id"}, DefaultBaggageHeaderPrefix},
+		{PropagatorConfig{BaggagePrefix: "x-datadog-baggage-"}, "x-datadog-baggage-"},
+	} {
+		t.Run(tc.cfg.BaggagePrefix, func(t *testing.T) {
+			cfg := tc.cfg
+			NewPropagator(&cfg)
+			assert.Equal(t, tc.prefix, cfg.BaggagePrefix)
+		})
+	}
+}
+
+func TestTextMapPropagatorAllowedOrigins(t *testing.T) {
+	t.Setenv(headerPropagationStyleExtract, "datadog")
+	prop := NewPropagator(&PropagatorConfig{AllowedOrigins: []string{"synthetics-browser", "rum"}})
+
+	ctx, err := prop.Extract(TextMapCarrier{
+		DefaultTraceIDHeader:  "1",
+		DefaultParentIDHeader: "2",
+		originHeader:          "rum",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "rum", ctx.(*spanContext).origin)
+
+	ctx, err = prop.Extract(TextMapCarrier{
+		DefaultTraceIDHeader:  "1",
+		DefaultParentIDHeader: "2",
+		originHeader:          "synthetics",
+	})
+	require.NoError(t, err)
+	assert.Empty(t, ctx.(*spanContext).origin)
+
+	// contexts without parent ID are only accepted with an allowed synthetics origin
+	ctx, err = prop.Extract(TextMapCarrier{
+		DefaultTraceIDHeader: "1",
+		originHeader:         "synthetics-browser",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "synthetics-browser", ctx.(*spanContext).origin)
+	_, err = prop.Extract(TextMapCarrier{
+		DefaultTraceIDHeader: "1",
+		originHeader:         "synthetics",
+	})
+	assert.Equal(t, ErrSpanContextNotFound, err)
+
+	// any origin is accepted by default
+	ctx, err = NewPropagator(nil).Extract(TextMapCarrier{
+		DefaultTraceIDHeader: "1",
+		originHeader:         "synthetics",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "synthetics", ctx.(*spanContext).origin)
+}
+
+func TestExtractRequestID(t *testing.T) {
+	t.Setenv(headerPropagationStyleExtract, "datadog,tracecontext")
+	tracer := newTracer(WithPropagator(NewPropagator(&PropagatorConfig{ExtractRequestID: true, MaxTagsHeaderLen: 128})))
+	defer tracer.Stop()
+
+	headers := http.Header{}
+	headers.Set(traceparentHeader, "00-00000000000000000000000000000001-0000000000000002-01")
+	headers.Set("X-Request-Id", "8d6ab2c1-ea57-4ef8-9f4c-2b0a3a0de6b1")
+	ctx, err := tracer.Extract(HTTPHeadersCarrier(headers))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), ctx.TraceID())
+	root := tracer.StartSpan("web.request", ChildOf(ctx)).(*span)
+	root.Finish()
+	assert.Equal(t, "8d6ab2c1-ea57-4ef8-9f4c-2b0a3a0de6b1", root.Meta[keyRequestID])
+
+	carrier := TextMapCarrier{}
+	require.NoError(t, tracer.Inject(root.Context(), carrier))
+	assert.Contains(t, carrier[traceTagsHeader], keyRequestID+"=8d6ab2c1-ea57-4ef8-9f4c-2b0a3a0de6b1")
+
+	t.Run("no-context", func(t *testing.T) {
+		_, err := tracer.Extract(TextMapCarrier{"content-type": "text/plain"})
+		assert.Equal(t, ErrSpanContextNotFound, err)
+	})
+	t.Run("request-id-only", func(t *testing.T) {
+		ctx, err := tracer.Extract(TextMapCarrier{requestIDHeader: "abc"})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), ctx.TraceID())
+		root := tracer.StartSpan("web.request", ChildOf(ctx)).(*span)
+		root.Finish()
+		assert.NotZero(t, root.TraceID)
+		assert.Equal(t, root.SpanID, root.TraceID)
+		assert.Zero(t, root.ParentID)
+		assert.Equal(t, "abc", root.Meta[keyRequestID])
+		_, ok := root.context.samplingPriority()
+		assert.True(t, ok)
+
+		// every child of the extracted context starts its own trace
+		other := tracer.StartSpan("web.request", ChildOf(ctx)).(*span)
+		other.Finish()
+		assert.NotEqual(t, root.TraceID, other.TraceID)
+		assert.NotSame(t, root.context.trace, other.context.trace)
+		assert.Same(t, other, other.context.trace.root)
+		assert.Equal(t, "abc", other.Meta[keyRequestID])
+	})
+	t.Run("disabled", func(t *testing.T) {
+		ctx, err := NewPropagator(nil).Extract(TextMapCarrier{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "2",
+			requestIDHeader:       "abc",
+		})
+		require.NoError(t, err)
+		assert.Nil(t, ctx.(*spanContext).trace)
+	})
+}
+
+func TestTextMapPropagatorGetter(t *testing.T) {
+	t.Setenv(headerPropagationStyleExtract, "datadog")
+	prop := NewPropagator(nil)
+	for name, carrier := range map[string]map[string]string{
+		"lowercase": {
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "2",
+			DefaultPriorityHeader: "2",
+			originHeader:          "synthetics",
+			"Ot-Baggage-Item":     "val",
+			"content-type":        "text/plain",
+		},
+		"mixed-case": {
+			"X-Datadog-Trace-Id":          "1",
+			"X-Datadog-Parent-Id":         "2",
+			"X-Datadog-Sampling-Priority": "2",
+			"X-Datadog-Origin":            "synthetics",
+			"ot-baggage-item":             "val",
+		},
+		"partly-mixed-case": {
+			DefaultTraceIDHeader:          "1",
+			"X-Datadog-Parent-Id":         "2",
+			"X-Datadog-Sampling-Priority": "2",
+			originHeader:                  "synthetics",
+			"ot-baggage-item":             "val",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			for _, reader := range []TextMapReader{TextMapCarrier(carrier), foreachKeyCarrier(carrier)} {
+				ctx, err := prop.Extract(reader)
+				require.NoError(t, err)
+				sctx := ctx.(*spanContext)
+				assert.Equal(t, uint64(1), sctx.TraceID())
+				assert.Equal(t, uint64(2), sctx.SpanID())
+				p, ok := sctx.samplingPriority()
+				assert.True(t, ok)
+				assert.Equal(t, 2, p)
+				assert.Equal(t, "synthetics", sctx.origin)
+				assert.Equal(t, "val", sctx.baggageItem("item"))
+			}
+		})
 	}
-	assert.Equal(t, sctx.spanID, uint64(0))
-	assert.Equal(t, sctx.traceID.Lower(), uint64(3))
-	assert.Equal(t, sctx.origin, "synthetics")
+	t.Run("baggage", func(t *testing.T) {
+		carrier := sizedCarrier{foreachKeyCarrier{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "2",
+			"ot-baggage-a":        "1",
+			"Ot-Baggage-B":        "2",
+		}}
+		ctx, err := prop.Extract(carrier)
+		require.NoError(t, err)
+		var items []string
+		ctx.ForeachBaggageItem(func(k, v string) bool {
+			items = append(items, k+"="+v)
+			return true
+		})
+		assert.ElementsMatch(t, []string{"a=1", "b=2"}, items)
+	})
+	t.Run("identity-only", func(t *testing.T) {
+		// the carrier isn't searched as it holds no other keys
+		carrier := TextMapCarrier{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "2",
+			DefaultPriorityHeader: "1",
+			originHeader:          "synthetics",
+		}
+		ctx, err := prop.Extract(carrier)
+		require.NoError(t, err)
+		sctx := ctx.(*spanContext)
+		assert.Equal(t, uint64(1), sctx.TraceID())
+		assert.Equal(t, uint64(2), sctx.SpanID())
+		assert.Equal(t, "synthetics", sctx.origin)
+		assert.Nil(t, sctx.baggage)
+	})
+	t.Run("corrupted", func(t *testing.T) {
+		_, err := prop.Extract(TextMapCarrier{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "x",
+			DefaultPriorityHeader: "1",
+		})
+		assert.Equal(t, ErrSpanContextCorrupted, err)
+	})
 }
 
 func TestTextMapPropagator(t *testing.T) {
@@ -328,6 +706,31 @@ func TestTextMapPropagator(t *testing.T) {
 		assert.Equal(t, "extract_max_size", sctx.trace.tags["_dd.propagation_error"])
 	})
 
+	t.Run("ExtractTraceTagsTooMany", func(t *testing.T) {
+		t.Setenv(headerPropagationStyleExtract, "datadog")
+		tags := make([]string, 0)
+		for i := 0; i < propagationExtractMaxTags+10; i++ {
+			tags = append(tags, fmt.Sprintf("_dd.p.%d=%d", i, i))
+		}
+		traceTags := strings.Join(tags, ",")
+		assert.LessOrEqual(t, len(traceTags), propagationExtractMaxSize)
+		src := TextMapCarrier(map[string]string{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "1",
+			traceTagsHeader:       traceTags,
+		})
+		tracer := newTracer()
+		defer tracer.Stop()
+		ctx, err := tracer.Extract(src)
+		assert.Nil(t, err)
+		sctx, ok := ctx.(*spanContext)
+		assert.True(t, ok)
+		assert.Equal(t, "extract_max_tags", sctx.trace.tags["_dd.propagation_error"])
+		assert.Equal(t, propagationExtractMaxTags, sctx.trace.propagatingTagsLen())
+		assert.Equal(t, "0", sctx.trace.propagatingTag("_dd.p.0"))
+		assert.False(t, sctx.trace.hasPropagatingTag(fmt.Sprintf("_dd.p.%d", propagationExtractMaxTags)))
+	})
+
 	t.Run("InjectTraceTagsTooLong", func(t *testing.T) {
 		t.Setenv(headerPropagationStyleInject, "datadog")
 		tracer := newTracer()
@@ -1432,24 +1835,24 @@ func TestEnvVars(t *testing.T) {
 			{
 				outHeaders: TextMapCarrier{
 					traceparentHeader: "00-000000000000000000000000075bcd15-000000003ade68b1-00",
-					tracestateHeader:  "dd=s:-2;o:test.origin",
+					tracestateHeader:  "dd=s:-1;o:test.origin",
 				},
 				inHeaders: TextMapCarrier{
 					DefaultTraceIDHeader:  "123456789",
 					DefaultParentIDHeader: "987654321",
-					DefaultPriorityHeader: "-2",
+					DefaultPriorityHeader: "-1",
 					originHeader:          "test.origin",
 				},
 			},
 			{
 				outHeaders: TextMapCarrier{
 					traceparentHeader: "00-000000000000000000000000075bcd15-000000003ade68b1-00",
-					tracestateHeader:  "dd=s:-2;o:synthetics___web",
+					tracestateHeader:  "dd=s:-1;o:synthetics___web",
 				},
 				inHeaders: TextMapCarrier{
 					DefaultTraceIDHeader:  "123456789",
 					DefaultParentIDHeader: "987654321",
-					DefaultPriorityHeader: "-2",
+					DefaultPriorityHeader: "-1",
 					originHeader:          "synthetics;,~web",
 				},
 			},
@@ -1644,6 +2047,735 @@ func TestW3CExtractsBaggage(t *testing.T) {
 	assert.True(t, found)
 }
 
+func TestDatadogBaggageEncoding(t *testing.T) {
+	t.Setenv(headerPropagationStyle, "datadog")
+	tracer := newTracer()
+	defer tracer.Stop()
+
+	values := map[string]string{
+		"ascii":     "value",
+		"space":     "a value, with; separators",
+		"percent":   "50%25",
+		"backslash": `a\"b"`,
+		"unicode":   "café ☕",
+		"invalid":   "\xff\xfe",
+		"control":   "line\r\nbreak",
+	}
+	root := tracer.StartSpan("web.request")
+	for k, v := range values {
+		root.SetBaggageItem(k, v)
+	}
+	headers := http.Header{}
+	require.NoError(t, tracer.Inject(root.Context(), HTTPHeadersCarrier(headers)))
+	// printable ASCII values are sent verbatim
+	for _, k := range []string{"ascii", "space", "percent", "backslash"} {
+		assert.Equal(t, values[k], headers.Get("ot-baggage-"+k))
+	}
+	// the bytes invalid in header values are percent-encoded
+	assert.Equal(t, "caf%C3%A9 %E2%98%95", headers.Get("ot-baggage-unicode"))
+	assert.Equal(t, "%FF%FE", headers.Get("ot-baggage-invalid"))
+	assert.Equal(t, "line%0D%0Abreak", headers.Get("ot-baggage-control"))
+
+	// the values are extracted verbatim
+	ctx, err := tracer.Extract(HTTPHeadersCarrier(headers))
+	require.NoError(t, err)
+	sctx := ctx.(*spanContext)
+	assert.Equal(t, "50%25", sctx.baggageItem("percent"))
+	assert.Equal(t, "a value, with; separators", sctx.baggageItem("space"))
+	assert.Equal(t, "caf%C3%A9 %E2%98%95", sctx.baggageItem("unicode"))
+}
+
+func TestComposeTracestateLimits(t *testing.T) {
+	vendors := func(n int, value string) []string {
+		members := make([]string, n)
+		for i := range members {
+			members[i] = fmt.Sprintf("v%02d=%s", i, value)
+		}
+		return members
+	}
+	ctx := &spanContext{trace: newTrace()}
+	dd := composeTracestate(ctx, 1, "")
+
+	t.Run("members", func(t *testing.T) {
+		members := vendors(32, "x")
+		out := composeTracestate(ctx, 1, " "+strings.Join(members, " , ")+",,dd=s:0")
+		assert.Equal(t, dd+","+strings.Join(members[:31], ","), out)
+	})
+
+	t.Run("length", func(t *testing.T) {
+		// 10 members of 49 characters fit in 512 characters after the dd
+		// list-member, an 11th one doesn't.
+		members := vendors(11, strings.Repeat("x", 45))
+		out := composeTracestate(ctx, 1, strings.Join(members, ","))
+		assert.Equal(t, dd+","+strings.Join(members[:10], ","), out)
+		assert.LessOrEqual(t, len(out), 512)
+	})
+
+	t.Run("long", func(t *testing.T) {
+		members := vendors(10, strings.Repeat("x", 45))
+		long := "long=" + strings.Repeat("x", 128)
+		in := append([]string{long}, members...)
+		out := composeTracestate(ctx, 1, strings.Join(in, ","))
+		assert.Equal(t, dd+","+strings.Join(members, ","), out)
+	})
+
+	t.Run("boundary", func(t *testing.T) {
+		// the members take exactly the 512 characters left by dd=s:1
+		members := vendors(31, "x")
+		members[30] += strings.Repeat("x", 512-len(dd)-31*6)
+		out := composeTracestate(ctx, 1, strings.Join(members, ","))
+		assert.Equal(t, dd+","+strings.Join(members, ","), out)
+		assert.Len(t, out, 512)
+
+		members[30] += "x"
+		out = composeTracestate(ctx, 1, strings.Join(members, ","))
+		assert.Equal(t, dd+","+strings.Join(members[:30], ","), out)
+	})
+}
+
+func TestW3CBaggageHeader(t *testing.T) {
+	t.Setenv(headerPropagationStyle, "tracecontext")
+	tracer := newTracer(WithPropagator(NewPropagator(&PropagatorConfig{W3CBaggage: true})))
+	defer tracer.Stop()
+
+	t.Run("extract", func(t *testing.T) {
+		ctx, err := tracer.Extract(TextMapCarrier{
+			traceparentHeader: "00-12345678901234567890123456789012-1234567890123456-01",
+			baggageHeader:     "userId=alice, serverNode = DF%2028 ,isProduction=false;prop=1,invalid,=novalue",
+		})
+		assert.NoError(t, err)
+		got := map[string]string{}
+		ctx.ForeachBaggageItem(func(k, v string) bool {
+			got[k] = v
+			return true
+		})
+		assert.Equal(t, map[string]string{
+			"userId":       "alice",
+			"serverNode":   "DF 28",
+			"isProduction": "false",
+		}, got)
+	})
+
+	t.Run("inject", func(t *testing.T) {
+		root := tracer.StartSpan("web.request").(*span)
+		root.SetBaggageItem("key", "a value,with;separators")
+		carrier := TextMapCarrier{}
+		assert.NoError(t, tracer.Inject(root.Context(), carrier))
+		assert.Equal(t, "key=a%20value%2Cwith%3Bseparators", carrier[baggageHeader])
+
+		ctx, err := tracer.Extract(carrier)
+		assert.NoError(t, err)
+		assert.Equal(t, "a value,with;separators", ctx.(*spanContext).baggageItem("key"))
+	})
+
+	t.Run("inject-key", func(t *testing.T) {
+		root := tracer.StartSpan("web.request").(*span)
+		root.SetBaggageItem("a=b c", "d=e")
+		carrier := TextMapCarrier{}
+		assert.NoError(t, tracer.Inject(root.Context(), carrier))
+		assert.Equal(t, "a%3Db%20c=d=e", carrier[baggageHeader])
+
+		ctx, err := tracer.Extract(carrier)
+		assert.NoError(t, err)
+		assert.Equal(t, "d=e", ctx.(*spanContext).baggageItem("a=b c"))
+	})
+
+	t.Run("default", func(t *testing.T) {
+		t.Setenv(headerPropagationStyle, "tracecontext,datadog")
+		tracer := newTracer()
+		defer tracer.Stop()
+		root := tracer.StartSpan("web.request").(*span)
+		root.SetBaggageItem("key", "value")
+		carrier := TextMapCarrier{}
+		assert.NoError(t, tracer.Inject(root.Context(), carrier))
+		assert.NotContains(t, carrier, baggageHeader)
+		assert.Equal(t, "value", carrier[DefaultBaggageHeaderPrefix+"key"])
+	})
+
+	t.Run("inject-empty", func(t *testing.T) {
+		root := tracer.StartSpan("web.request").(*span)
+		carrier := TextMapCarrier{}
+		assert.NoError(t, tracer.Inject(root.Context(), carrier))
+		assert.NotContains(t, carrier, baggageHeader)
+	})
+}
+
+func TestBaggageSizeWarning(t *testing.T) {
+	for _, style := range []string{"datadog", "tracecontext"} {
+		t.Run(style, func(t *testing.T) {
+			t.Setenv(headerPropagationStyle, style)
+			atomic.StoreUint32(&baggageSizeWarned, 0)
+			defer atomic.StoreUint32(&baggageSizeWarned, 0)
+			tp := new(log.RecordLogger)
+			tp.Ignore("appsec: ", telemetry.LogPrefix)
+			tracer := newTracer(WithLogger(tp), WithPropagator(NewPropagator(&PropagatorConfig{BaggageWarnSize: 64, W3CBaggage: true})))
+			defer tracer.Stop()
+
+			small := tracer.StartSpan("web.request").(*span)
+			small.SetBaggageItem("key", "value")
+			assert.NoError(t, tracer.Inject(small.Context(), TextMapCarrier{}))
+			assert.NotContains(t, small.context.trace.tags, keyPropagationError)
+
+			for i := 0; i < 2; i++ {
+				large := tracer.StartSpan("web.request").(*span)
+				large.SetBaggageItem("key", strings.Repeat("x", 64))
+				carrier := TextMapCarrier{}
+				assert.NoError(t, tracer.Inject(large.Context(), carrier))
+				assert.Contains(t, fmt.Sprint(carrier), strings.Repeat("x", 64), "the baggage is still injected")
+				assert.Equal(t, "baggage_large", large.context.trace.tags[keyPropagationError])
+			}
+			var warnings int
+			for _, l := range tp.Logs() {
+				if strings.Contains(l, "Injected baggage of") {
+					warnings++
+				}
+			}
+			assert.Equal(t, 1, warnings)
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		tracer := newTracer(WithPropagator(NewPropagator(&PropagatorConfig{BaggageWarnSize: -1})))
+		defer tracer.Stop()
+		root := tracer.StartSpan("web.request").(*span)
+		root.SetBaggageItem("key", strings.Repeat("x", 2*defaultBaggageWarnSize))
+		assert.NoError(t, tracer.Inject(root.Context(), TextMapCarrier{}))
+		assert.NotContains(t, root.context.trace.tags, keyPropagationError)
+	})
+}
+
+func TestW3CInjectRootSpan(t *testing.T) {
+	t.Setenv(headerPropagationStyle, "tracecontext")
+	tracer := newTracer()
+	defer tracer.Stop()
+
+	t.Run("started", func(t *testing.T) {
+		root := tracer.StartSpan("web.request").(*span)
+		carrier := TextMapCarrier{}
+		assert.NoError(t, tracer.Inject(root.Context(), carrier))
+		assert.Regexp(t, `^dd=s:1;t\.dm:-\d+$`, carrier[tracestateHeader])
+	})
+
+	t.Run("started-not-updated", func(t *testing.T) {
+		root := tracer.StartSpan("web.request").(*span)
+		root.context.updated = false
+		carrier := TextMapCarrier{}
+		assert.NoError(t, tracer.Inject(root.Context(), carrier))
+		assert.True(t, strings.HasPrefix(carrier[tracestateHeader], "dd=s:1"), carrier[tracestateHeader])
+	})
+
+	t.Run("no-trace", func(t *testing.T) {
+		ctx := &spanContext{traceID: traceIDFrom64Bits(1), spanID: 2, origin: "synthetics"}
+		carrier := TextMapCarrier{}
+		assert.NoError(t, tracer.Inject(ctx, carrier))
+		assert.Equal(t, "00-00000000000000000000000000000001-0000000000000002-00", carrier[traceparentHeader])
+		assert.Equal(t, "dd=s:0;o:synthetics", carrier[tracestateHeader])
+	})
+}
+
+func TestXRayPropagator(t *testing.T) {
+	t.Setenv(headerPropagationStyle, "xray")
+	tracer := newTracer()
+	defer tracer.Stop()
+
+	t.Run("extract", func(t *testing.T) {
+		for header, priority := range map[string]interface{}{
+			"Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1":     float64(ext.PriorityAutoKeep),
+			"Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=0":     float64(ext.PriorityAutoReject),
+			"Root=1-5759e988-bd862e3fe1be46a994272793; Parent=53995c3f42cd8ad8; Sampled=?":   nil,
+			"Self=1-abc;Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8":    nil,
+			"Parent=53995c3f42cd8ad8;Root=1-5759e988-bd862e3fe1be46a994272793;Lineage=a:1|2": nil,
+		} {
+			ctx, err := tracer.Extract(TextMapCarrier{"X-Amzn-Trace-Id": header})
+			require.NoError(t, err, header)
+			sctx := ctx.(*spanContext)
+			assert.Equal(t, "5759e988bd862e3fe1be46a994272793", sctx.TraceID128(), header)
+			assert.Equal(t, uint64(0x53995c3f42cd8ad8), sctx.spanID, header)
+			if priority == nil {
+				_, ok := sctx.samplingPriority()
+				assert.False(t, ok, header)
+			} else {
+				require.NotNil(t, sctx.trace, header)
+				assert.Equal(t, priority, *sctx.trace.priority, header)
+			}
+		}
+	})
+
+	t.Run("extract-invalid", func(t *testing.T) {
+		for header, want := range map[string]error{
+			"Root=1-5759e988-bd862e3fe1be46a994272793":                                ErrSpanContextNotFound,
+			"Parent=53995c3f42cd8ad8":                                                 ErrSpanContextNotFound,
+			"Root=2-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8":        ErrSpanContextCorrupted,
+			"Root=1-5759e988-bd862e3fe1be46a99427279;Parent=53995c3f42cd8ad8":         ErrSpanContextCorrupted,
+			"Root=1-5759e98g-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8":        ErrSpanContextCorrupted,
+			"Root=1-5759e988-bd862e3fe1be46a99427279z;Parent=53995c3f42cd8ad8":        ErrSpanContextCorrupted,
+			"Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8zz":      ErrSpanContextCorrupted,
+			"Root=1-5759e988-bd862e3fe1be46a994272793-00;Parent=53995c3f42cd8ad8;a=b": ErrSpanContextCorrupted,
+		} {
+			_, err := tracer.Extract(TextMapCarrier{xrayHeader: header})
+			assert.Equal(t, want, err, header)
+		}
+	})
+
+	t.Run("inject", func(t *testing.T) {
+		root := tracer.StartSpan("web.request").(*span)
+		ctx := root.context
+		ctx.traceID.SetUpper(0x5759e98800000000)
+		ctx.traceID.SetLower(0x1234)
+		ctx.spanID = 0x53995c3f42cd8ad8
+		carrier := TextMapCarrier{}
+		require.NoError(t, tracer.Inject(ctx, carrier))
+		assert.Equal(t, "Root=1-5759e988-000000000000000000001234;Parent=53995c3f42cd8ad8;Sampled=1", carrier[xrayHeader])
+
+		ctx.setSamplingPriority(ext.PriorityUserReject, samplernames.Manual)
+		require.NoError(t, tracer.Inject(ctx, carrier))
+		assert.Equal(t, "Root=1-5759e988-000000000000000000001234;Parent=53995c3f42cd8ad8;Sampled=0", carrier[xrayHeader])
+
+		carrier = TextMapCarrier{}
+		require.NoError(t, tracer.Inject(&spanContext{traceID: traceIDFrom64Bits(1), spanID: 2}, carrier))
+		assert.Equal(t, "Root=1-00000000-000000000000000000000001;Parent=0000000000000002", carrier[xrayHeader])
+	})
+
+	t.Run("round-trip", func(t *testing.T) {
+		const header = "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"
+		ctx, err := tracer.Extract(TextMapCarrier{xrayHeader: header})
+		require.NoError(t, err)
+		carrier := TextMapCarrier{}
+		require.NoError(t, tracer.Inject(ctx, carrier))
+		assert.Equal(t, header, carrier[xrayHeader])
+
+		child := tracer.StartSpan("child", ChildOf(ctx)).(*span)
+		assert.Equal(t, "5759e988bd862e3fe1be46a994272793", child.context.TraceID128())
+		assert.Equal(t, uint64(0x53995c3f42cd8ad8), child.ParentID)
+	})
+
+	assert.Equal(t, "xray", propagatorStyle(&propagatorXRay{}))
+}
+
+func TestGCPPropagator(t *testing.T) {
+	t.Setenv(headerPropagationStyle, "gcp")
+	tracer := newTracer()
+	defer tracer.Stop()
+
+	t.Run("extract", func(t *testing.T) {
+		for header, priority := range map[string]interface{}{
+			"105445aa7843bc8bf206b12000100000/1;o=1":  float64(ext.PriorityAutoKeep),
+			"105445aa7843bc8bf206b12000100000/1;o=0":  float64(ext.PriorityAutoReject),
+			"105445aa7843bc8bf206b12000100000/1":      nil,
+			" 105445aa7843bc8bf206b12000100000/1;o=1": float64(ext.PriorityAutoKeep),
+		} {
+			ctx, err := tracer.Extract(TextMapCarrier{"X-Cloud-Trace-Context": header})
+			require.NoError(t, err, header)
+			sctx := ctx.(*spanContext)
+			assert.Equal(t, "105445aa7843bc8bf206b12000100000", sctx.TraceID128(), header)
+			assert.Equal(t, uint64(1), sctx.spanID, header)
+			if priority == nil {
+				_, ok := sctx.samplingPriority()
+				assert.False(t, ok, header)
+			} else {
+				require.NotNil(t, sctx.trace, header)
+				assert.Equal(t, priority, *sctx.trace.priority, header)
+			}
+		}
+	})
+
+	t.Run("extract-invalid", func(t *testing.T) {
+		for header, want := range map[string]error{
+			"105445aa7843bc8bf206b12000100000/0;o=1":     ErrSpanContextNotFound,
+			"00000000000000000000000000000000/1;o=1":     ErrSpanContextNotFound,
+			"105445aa7843bc8bf206b12000100000;o=1":       ErrSpanContextCorrupted,
+			"105445aa7843bc8bf206b1200010000/1;o=1":      ErrSpanContextCorrupted,
+			"105445aa7843bc8bf206b1200010000z/1;o=1":     ErrSpanContextCorrupted,
+			"105445aa7843bc8bf206b12000100000/abc;o=1":   ErrSpanContextCorrupted,
+			"105445aa7843bc8bf206b12000100000/-1;o=1":    ErrSpanContextCorrupted,
+			"105445aa7843bc8bf206b12000100000/1a2b3;o=1": ErrSpanContextCorrupted,
+		} {
+			_, err := tracer.Extract(TextMapCarrier{gcpHeader: header})
+			assert.Equal(t, want, err, header)
+		}
+	})
+
+	t.Run("inject", func(t *testing.T) {
+		root := tracer.StartSpan("web.request").(*span)
+		ctx := root.context
+		ctx.traceID.SetUpper(0x105445aa7843bc8b)
+		ctx.traceID.SetLower(0xf206b12000100000)
+		ctx.spanID = 1234
+		carrier := TextMapCarrier{}
+		require.NoError(t, tracer.Inject(ctx, carrier))
+		assert.Equal(t, "105445aa7843bc8bf206b12000100000/1234;o=1", carrier[gcpHeader])
+
+		ctx.setSamplingPriority(ext.PriorityUserReject, samplernames.Manual)
+		require.NoError(t, tracer.Inject(ctx, carrier))
+		assert.Equal(t, "105445aa7843bc8bf206b12000100000/1234;o=0", carrier[gcpHeader])
+
+		carrier = TextMapCarrier{}
+		require.NoError(t, tracer.Inject(&spanContext{traceID: traceIDFrom64Bits(1), spanID: 2}, carrier))
+		assert.Equal(t, "00000000000000000000000000000001/2", carrier[gcpHeader])
+	})
+
+	t.Run("round-trip", func(t *testing.T) {
+		const header = "105445aa7843bc8bf206b12000100000/18446744073709551615;o=1"
+		ctx, err := tracer.Extract(TextMapCarrier{gcpHeader: header})
+		require.NoError(t, err)
+		carrier := TextMapCarrier{}
+		require.NoError(t, tracer.Inject(ctx, carrier))
+		assert.Equal(t, header, carrier[gcpHeader])
+
+		child := tracer.StartSpan("child", ChildOf(ctx)).(*span)
+		assert.Equal(t, "105445aa7843bc8bf206b12000100000", child.context.TraceID128())
+		assert.Equal(t, uint64(18446744073709551615), child.ParentID)
+	})
+
+	assert.Equal(t, "gcp", propagatorStyle(&propagatorGCP{}))
+}
+
+func TestHexTraceIDs(t *testing.T) {
+	t.Setenv(headerPropagationStyle, "datadog")
+	tracer := newTracer(WithPropagator(NewPropagator(&PropagatorConfig{HexTraceIDs: true, MaxTagsHeaderLen: 512})))
+	defer tracer.Stop()
+
+	root := tracer.StartSpan("web.request").(*span)
+	ctx := root.context
+	ctx.traceID.SetUpper(0x6e96719ded9c1864)
+	ctx.traceID.SetLower(0xa21ba1551789e3f5)
+	ctx.spanID = 0xbf
+	carrier := TextMapCarrier{}
+	require.NoError(t, tracer.Inject(ctx, carrier))
+	assert.Equal(t, "a21ba1551789e3f5", carrier[DefaultTraceIDHeader])
+	assert.Equal(t, "00000000000000bf", carrier[DefaultParentIDHeader])
+
+	got, err := tracer.Extract(carrier)
+	require.NoError(t, err)
+	assert.Equal(t, "6e96719ded9c1864a21ba1551789e3f5", got.(*spanContext).TraceID128())
+	assert.Equal(t, uint64(0xbf), got.(*spanContext).spanID)
+
+	_, err = tracer.Extract(TextMapCarrier{DefaultTraceIDHeader: "-1", DefaultParentIDHeader: "2"})
+	assert.Equal(t, ErrSpanContextCorrupted, err)
+
+	// the IDs are decimal by default
+	dec := newTracer()
+	defer dec.Stop()
+	carrier = TextMapCarrier{}
+	require.NoError(t, dec.Inject(ctx, carrier))
+	assert.Equal(t, "11681107445354718197", carrier[DefaultTraceIDHeader])
+	assert.Equal(t, "191", carrier[DefaultParentIDHeader])
+}
+
+func TestStripPropagationHeaders(t *testing.T) {
+	tracer := newTracer(WithPropagator(NewPropagator(nil, &propagator{cfg: &PropagatorConfig{
+		TraceHeader:      "x-trace",
+		ParentHeader:     DefaultParentIDHeader,
+		PriorityHeader:   DefaultPriorityHeader,
+		BaggagePrefix:    "x-bag-",
+		MaxTagsHeaderLen: 512,
+	}}, &propagatorW3c{}, &propagatorB3{}, &propagatorB3SingleHeader{})))
+	defer tracer.Stop()
+	root := tracer.StartSpan("web.request", Tag(ext.ManualKeep, true)).(*span)
+	root.SetBaggageItem("user", "alice")
+	root.context.origin = "synthetics"
+
+	h := http.Header{}
+	require.NoError(t, tracer.Inject(root.Context(), HTTPHeadersCarrier(h)))
+	h.Set("Ot-Baggage-Other", "value")
+	h.Set("Authorization", "Bearer token")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Trace-Id", "not the configured trace header")
+	injected := len(h)
+
+	StripPropagationHeaders(h, &PropagatorConfig{TraceHeader: "X-Trace", BaggagePrefix: "x-bag-"})
+	assert.Equal(t, http.Header{
+		"Authorization": {"Bearer token"},
+		"Content-Type":  {"application/json"},
+		"X-Trace-Id":    {"not the configured trace header"},
+	}, h)
+	assert.Greater(t, injected, 10)
+
+	h = http.Header{}
+	h.Set(DefaultTraceIDHeader, "1")
+	h.Set(DefaultParentIDHeader, "2")
+	h.Set(xrayHeader, "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8")
+	h.Set("Accept", "*/*")
+	StripPropagationHeaders(h, nil)
+	assert.Equal(t, http.Header{"Accept": {"*/*"}}, h)
+}
+
+func TestExtractLogsStyle(t *testing.T) {
+	t.Setenv(headerPropagationStyleExtract, "datadog,b3multi")
+	tp := new(log.RecordLogger)
+	tracer, _, _, stop := startTestTracer(t, WithLogger(tp), WithDebugMode(true))
+	defer stop()
+
+	_, err := tracer.Extract(TextMapCarrier{
+		b3TraceIDHeader: "1",
+		b3SpanIDHeader:  "2",
+	})
+	require.NoError(t, err)
+	var found bool
+	for _, l := range tp.Logs() {
+		if strings.Contains(l, "DEBUG: Extracted span context via b3multi: ") {
+			found = true
+		}
+	}
+	assert.True(t, found, tp.Logs())
+
+	// the propagators are named after the style selecting them
+	for _, style := range []string{"datadog", "tracecontext", "b3multi", "b3 single header", "xray", "gcp"} {
+		ps := getPropagators(&PropagatorConfig{}, style)
+		require.Len(t, ps, 1)
+		assert.Equal(t, style, propagatorStyle(ps[0]))
+	}
+	assert.Equal(t, "custom", propagatorStyle(NewPropagator(nil)))
+}
+
+func TestW3CDisableTracestate(t *testing.T) {
+	t.Setenv(headerPropagationStyle, "tracecontext")
+	for _, disable := range []bool{false, true} {
+		t.Run(strconv.FormatBool(disable), func(t *testing.T) {
+			tracer := newTracer(WithPropagator(NewPropagator(&PropagatorConfig{W3CDisableTracestate: disable})))
+			defer tracer.Stop()
+			ctx, err := tracer.Extract(TextMapCarrier{
+				traceparentHeader: "00-12345678901234567890123456789012-1234567890123456-01",
+				tracestateHeader:  "dd=s:2;o:rum,othervendor=t61rcWkgMzE",
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, "rum", ctx.(*spanContext).origin)
+
+			carrier := TextMapCarrier{}
+			assert.NoError(t, tracer.Inject(ctx, carrier))
+			assert.Equal(t, "00-12345678901234567890123456789012-1234567890123456-01", carrier[traceparentHeader])
+			if disable {
+				assert.NotContains(t, carrier, tracestateHeader)
+			} else {
+				assert.True(t, strings.HasPrefix(carrier[tracestateHeader], "dd=s:2;o:rum"))
+				assert.True(t, strings.HasSuffix(carrier[tracestateHeader], ",othervendor=t61rcWkgMzE"))
+			}
+		})
+	}
+}
+
+func TestInjectOnlyWhenSampled(t *testing.T) {
+	tracer := newTracer(WithPropagator(NewPropagator(&PropagatorConfig{InjectOnlyWhenSampled: true})))
+	defer tracer.Stop()
+	for _, tc := range []struct {
+		priority int
+		injected bool
+	}{
+		{priority: ext.PriorityUserReject, injected: false},
+		{priority: ext.PriorityAutoReject, injected: false},
+		{priority: ext.PriorityAutoKeep, injected: true},
+		{priority: ext.PriorityUserKeep, injected: true},
+	} {
+		t.Run(strconv.Itoa(tc.priority), func(t *testing.T) {
+			ctx, err := tracer.Extract(TextMapCarrier{
+				DefaultTraceIDHeader:  "1",
+				DefaultParentIDHeader: "2",
+				DefaultPriorityHeader: strconv.Itoa(tc.priority),
+			})
+			assert.NoError(t, err)
+			carrier := TextMapCarrier{}
+			assert.NoError(t, tracer.Inject(ctx, carrier))
+			if tc.injected {
+				assert.Equal(t, "1", carrier[DefaultTraceIDHeader])
+				assert.Contains(t, carrier, traceparentHeader)
+			} else {
+				assert.Empty(t, carrier)
+			}
+		})
+	}
+}
+
+func TestInjectConsistentTraceIDs(t *testing.T) {
+	t.Setenv(headerPropagationStyleInject, "datadog,tracecontext")
+	for name, cfg := range map[string]*PropagatorConfig{
+		"default":       {MaxTagsHeaderLen: 128},
+		"tags-disabled": {MaxTagsHeaderLen: 0},
+		"tags-too-long": {MaxTagsHeaderLen: 24},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tracer := newTracer(WithPropagator(NewPropagator(cfg)))
+			defer tracer.Stop()
+
+			root := tracer.StartSpan("web.request").(*span)
+			root.SetTag("_dd.p.usr", "a-propagating-tag-longer-than-the-limit")
+			ctx := root.context
+			ctx.traceID.SetUpper(0x6e96719ded9c1864)
+			ctx.traceID.SetLower(0xa21ba1551789e3f5)
+			carrier := TextMapCarrier{}
+			require.NoError(t, tracer.Inject(ctx, carrier))
+
+			traceparent := strings.Split(carrier[traceparentHeader], "-")
+			require.Len(t, traceparent, 4)
+			lower, err := strconv.ParseUint(carrier[DefaultTraceIDHeader], 10, 64)
+			require.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("%016x", lower), traceparent[1][16:])
+			assert.Contains(t, carrier[traceTagsHeader], keyTraceID128+"="+traceparent[1][:16])
+
+			got, err := NewPropagator(&PropagatorConfig{MaxTagsHeaderLen: 128}).Extract(TextMapCarrier{
+				DefaultTraceIDHeader:  carrier[DefaultTraceIDHeader],
+				DefaultParentIDHeader: carrier[DefaultParentIDHeader],
+				traceTagsHeader:       carrier[traceTagsHeader],
+			})
+			require.NoError(t, err)
+			assert.Equal(t, traceparent[1], got.(*spanContext).TraceID128())
+		})
+	}
+}
+
+func TestChainedPropagatorExtractMetrics(t *testing.T) {
+	t.Setenv(headerPropagationStyleExtract, "datadog,tracecontext,b3")
+	p := NewPropagator(nil).(*chainedPropagator)
+
+	_, err := p.Extract(TextMapCarrier{
+		DefaultTraceIDHeader:  "1",
+		DefaultParentIDHeader: "2",
+	})
+	assert.NoError(t, err)
+	_, err = p.Extract(TextMapCarrier{
+		traceparentHeader: "00-12345678901234567890123456789012-1234567890123456-01",
+	})
+	assert.NoError(t, err)
+	_, err = p.Extract(TextMapCarrier{
+		b3TraceIDHeader: "1",
+		b3SpanIDHeader:  "2",
+	})
+	assert.NoError(t, err)
+	_, err = p.Extract(TextMapCarrier{
+		b3TraceIDHeader: "1",
+		b3SpanIDHeader:  "3",
+	})
+	assert.NoError(t, err)
+	_, err = p.Extract(TextMapCarrier{})
+	assert.Equal(t, ErrSpanContextNotFound, err)
+	_, err = p.Extract(TextMapCarrier{
+		DefaultTraceIDHeader:  "A",
+		DefaultParentIDHeader: "2",
+	})
+	assert.Equal(t, ErrSpanContextCorrupted, err)
+
+	var tg testStatsdClient
+	p.reportExtractMetrics(&tg)
+	extracted := map[string]int64{}
+	for _, c := range tg.CountCalls() {
+		switch c.name {
+		case "datadog.tracer.propagation.extracted":
+			extracted[c.tags[0]] = c.intVal
+		case "datadog.tracer.propagation.extract_failed":
+			assert.Equal(t, int64(2), c.intVal)
+		}
+	}
+	assert.Equal(t, map[string]int64{
+		"style:tracecontext": 1,
+		"style:datadog":      1,
+		"style:b3multi":      2,
+	}, extracted)
+
+	// counters are reset once reported
+	tg.Reset()
+	p.reportExtractMetrics(&tg)
+	for _, c := range tg.CountCalls() {
+		assert.Zero(t, c.intVal, c.name)
+	}
+}
+
+func TestExtractConflictingContextsSpanLinks(t *testing.T) {
+	t.Setenv(headerPropagationStyleExtract, "datadog,tracecontext,b3")
+	tracer := newTracer()
+	defer tracer.Stop()
+
+	t.Run("conflict", func(t *testing.T) {
+		assert := assert.New(t)
+		ctx, err := tracer.Extract(TextMapCarrier{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "2",
+			DefaultPriorityHeader: "1",
+			traceparentHeader:     "00-000000000000000a000000000000000b-000000000000000c-01",
+			tracestateHeader:      "dd=s:1,foo=bar",
+			b3TraceIDHeader:       "000000000000000a000000000000000b",
+			b3SpanIDHeader:        "000000000000000c",
+		})
+		assert.NoError(err)
+		// tracecontext takes precedence
+		sctx := ctx.(*spanContext)
+		assert.Equal(uint64(0xb), sctx.TraceID())
+		assert.Equal(uint64(0xc), sctx.SpanID())
+		// b3 matches the chosen context, so only datadog is linked
+		assert.Equal([]ddtrace.SpanLink{{
+			TraceID: 1,
+			SpanID:  2,
+			Attributes: map[string]string{
+				"reason":          "terminated_context",
+				"context_headers": "datadog",
+			},
+			Flags: 1,
+		}}, sctx.SpanLinks())
+
+		root := tracer.StartSpan("web.request", ChildOf(ctx)).(*span)
+		assert.Equal(`[{"trace_id":"00000000000000000000000000000001","span_id":"0000000000000002",`+
+			`"attributes":{"context_headers":"datadog","reason":"terminated_context"},"flags":1}]`, root.Meta[keySpanLinks])
+		child := tracer.StartSpan("db.query", ChildOf(root.Context())).(*span)
+		assert.NotContains(child.Meta, keySpanLinks)
+	})
+
+	t.Run("tracestate", func(t *testing.T) {
+		p := NewPropagator(nil, &propagator{cfg: &PropagatorConfig{
+			TraceHeader:    DefaultTraceIDHeader,
+			ParentHeader:   DefaultParentIDHeader,
+			PriorityHeader: DefaultPriorityHeader,
+			BaggagePrefix:  DefaultBaggageHeaderPrefix,
+		}}, &propagatorW3c{})
+		ctx, err := p.Extract(TextMapCarrier{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "2",
+			traceparentHeader:     "00-000000000000000a000000000000000b-000000000000000c-00",
+			tracestateHeader:      "dd=s:0,foo=bar",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []ddtrace.SpanLink{{
+			TraceID:     0xb,
+			TraceIDHigh: 0xa,
+			SpanID:      0xc,
+			Attributes: map[string]string{
+				"reason":          "terminated_context",
+				"context_headers": "tracecontext",
+			},
+			Tracestate: "dd=s:0,foo=bar",
+		}}, ctx.(*spanContext).SpanLinks())
+	})
+
+	t.Run("sampling", func(t *testing.T) {
+		ctx, err := tracer.Extract(TextMapCarrier{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "2",
+			DefaultPriorityHeader: "0",
+			traceparentHeader:     "00-00000000000000000000000000000001-0000000000000002-01",
+		})
+		assert.NoError(t, err)
+		// the sampling decision of tracecontext wins over the datadog one
+		assert.Equal(t, []SpanLink{{
+			TraceID: 1,
+			SpanID:  2,
+			Attributes: map[string]string{
+				"reason":          "terminated_context",
+				"context_headers": "datadog",
+			},
+		}}, ctx.(*spanContext).SpanLinks())
+	})
+
+	t.Run("consistent", func(t *testing.T) {
+		assert := assert.New(t)
+		ctx, err := tracer.Extract(TextMapCarrier{
+			DefaultTraceIDHeader:  "1",
+			DefaultParentIDHeader: "2",
+			traceparentHeader:     "00-00000000000000000000000000000001-0000000000000002-01",
+		})
+		assert.NoError(err)
+		assert.Empty(ctx.(*spanContext).SpanLinks())
+		root := tracer.StartSpan("web.request", ChildOf(ctx)).(*span)
+		assert.NotContains(root.Meta, keySpanLinks)
+	})
+}
+
 func TestNonePropagator(t *testing.T) {
 	t.Run("inject/none", func(t *testing.T) {
 		t.Setenv(headerPropagationStyleInject, "none")
@@ -1817,6 +2949,88 @@ func BenchmarkExtractDatadog(b *testing.B) {
 	}
 }
 
+// BenchmarkExtractDatadogGetter compares the extraction from carriers
+// implementing TextMapGetter and TextMapSizer with the baseline extraction
+// searching the carrier with ForeachKey.
+func BenchmarkExtractDatadogGetter(b *testing.B) {
+	b.Setenv(headerPropagationStyleExtract, "datadog")
+	propagator := NewPropagator(nil)
+	identity := map[string]string{
+		DefaultTraceIDHeader:  "1123123132131312313",
+		DefaultParentIDHeader: "1212321131231312312",
+		DefaultPriorityHeader: "1",
+	}
+	headers := map[string]string{}
+	for k, v := range identity {
+		headers[k] = v
+	}
+	for i := 0; i < 20; i++ {
+		headers[fmt.Sprintf("X-Request-Header-%d", i)] = "value"
+	}
+	for name, carrier := range map[string]map[string]string{
+		"identity-only": identity,
+		"with-headers":  headers,
+	} {
+		for reader, r := range map[string]TextMapReader{
+			"baseline": foreachKeyCarrier(carrier),
+			"Get":      TextMapCarrier(carrier),
+		} {
+			r := r
+			b.Run(name+"/"+reader, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					propagator.Extract(r)
+				}
+			})
+		}
+	}
+}
+
+// sizedCarrier is a TextMapReader implementing TextMapSizer but not
+// TextMapGetter.
+type sizedCarrier struct{ foreachKeyCarrier }
+
+func (c sizedCarrier) Len() int { return len(c.foreachKeyCarrier) }
+
+// BenchmarkExtractDatadogBaggage compares the extraction of the baggage items
+// of carriers implementing TextMapSizer with carriers which don't, for
+// baggage-heavy requests and for requests with many other headers.
+func BenchmarkExtractDatadogBaggage(b *testing.B) {
+	b.Setenv(headerPropagationStyleExtract, "datadog")
+	propagator := NewPropagator(nil)
+	newCarrier := func(items, headers int) map[string]string {
+		carrier := map[string]string{
+			DefaultTraceIDHeader:  "1123123132131312313",
+			DefaultParentIDHeader: "1212321131231312312",
+			DefaultPriorityHeader: "1",
+		}
+		for i := 0; i < items; i++ {
+			carrier[fmt.Sprintf("%sitem-%d", DefaultBaggageHeaderPrefix, i)] = "value"
+		}
+		for i := 0; i < headers; i++ {
+			carrier[fmt.Sprintf("X-Request-Header-%d", i)] = "value"
+		}
+		return carrier
+	}
+	for name, carrier := range map[string]map[string]string{
+		"baggage": newCarrier(32, 0),
+		"headers": newCarrier(2, 30),
+	} {
+		for size, reader := range map[string]TextMapReader{
+			"NoLen": foreachKeyCarrier(carrier),
+			"Len":   sizedCarrier{foreachKeyCarrier(carrier)},
+		} {
+			reader := reader
+			b.Run(name+"/"+size, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					propagator.Extract(reader)
+				}
+			})
+		}
+	}
+}
+
 func BenchmarkExtractW3C(b *testing.B) {
 	b.Setenv(headerPropagationStyleExtract, "tracecontext")
 	propagator := NewPropagator(nil)
@@ -1841,7 +3055,7 @@ func FuzzMarshalPropagatingTags(f *testing.F) {
 		recvCtx.trace = newTrace()
 
 		pConfig := PropagatorConfig{MaxTagsHeaderLen: 128}
-		propagator := propagator{&pConfig}
+		propagator := propagator{cfg: &pConfig}
 		tags := map[string]string{key1: val1, key2: val2, key3: val3}
 		for key, val := range tags {
 			sendCtx.trace.setPropagatingTag(key, val)
@@ -1868,7 +3082,7 @@ func FuzzComposeTracestate(f *testing.F) {
 			k1: "keyOne", v1: "json",
 			k2: "KeyTwo", v2: "123123",
 			k3: "table", v3: "chair",
-			oldState: "dd=s:-2;o:synthetics___web"},
+			oldState: "dd=s:-1;o:synthetics___web"},
 	}
 	for _, tc := range testCases {
 		f.Add(tc.priority, tc.k1, tc.v1, tc.k2, tc.v2, tc.k3, tc.v3, tc.oldState)
@@ -105,10 +105,6 @@ const (
 	// maximum size of the package that the agent can receive.
 	payloadMaxLimit = 9.5 * 1024 * 1024 // 9.5 MB
 
-	// payloadSizeLimit specifies the maximum allowed size of the payload before
-	// it will trigger a flush to the transport.
-	payloadSizeLimit = payloadMaxLimit / 2
-
 	// concurrentConnectionLimit specifies the maximum number of concurrent outgoing
 	// connections allowed.
 	concurrentConnectionLimit = 100
@@ -176,6 +172,33 @@ func Extract(carrier interface{}) (ddtrace.SpanContext, error) {
 	return internal.GetGlobalTracer().Extract(carrier)
 }
 
+// ExtractFirst extracts a SpanContext from the first of the carriers, tried in
+// order, from which the propagator extracts one successfully, e.g. from the
+// headers of a message and then from the envelope which holds it. A nil
+// propagator uses the one of the started tracer, like Extract. If no carrier
+// holds a span context, the error of the first carrier holding an invalid one
+// is returned, or ErrSpanContextNotFound.
+func ExtractFirst(propagator Propagator, carriers ...interface{}) (ddtrace.SpanContext, error) {
+	extract := Extract
+	if propagator != nil {
+		extract = propagator.Extract
+	}
+	var firstErr error
+	for _, carrier := range carriers {
+		ctx, err := extract(carrier)
+		if err == nil {
+			return ctx, nil
+		}
+		if firstErr == nil && err != ErrSpanContextNotFound {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return nil, ErrSpanContextNotFound
+}
+
 // Inject injects the given SpanContext into the carrier. The carrier is
 // expected to implement TextMapWriter, otherwise an error is returned.
 // If the tracer is not started, calling this function is a no-op.
@@ -299,6 +322,21 @@ func Flush() {
 	}
 }
 
+// AgentInfo returns the capabilities reported by the trace-agent when the
+// running tracer started. It reports false when the tracer is not started or
+// when the information could not be loaded, such as when the agent is
+// unreachable, older than 7.28.0, or not used in Lambda mode.
+func AgentInfo() (AgentCapabilities, bool) {
+	t, ok := internal.GetGlobalTracer().(*tracer)
+	if !ok || t.config.agent.info == nil {
+		return AgentCapabilities{}, false
+	}
+	info := *t.config.agent.info
+	info.Endpoints = append([]string(nil), info.Endpoints...)
+	info.FeatureFlags = append([]string(nil), info.FeatureFlags...)
+	return info, true
+}
+
 // flushSync triggers a flush and waits for it to complete.
 func (t *tracer) flushSync() {
 	done := make(chan struct{})
@@ -418,6 +456,11 @@ func (t *tracer) StartSpan(operationName string, options ...ddtrace.StartSpanOpt
 	if opts.Parent != nil {
 		if ctx, ok := opts.Parent.(*spanContext); ok {
 			context = ctx
+			if ctx.span == nil && ctx.traceID.Empty() {
+				// the extracted context only holds propagating tags, such
+				// as the request ID, and must not share its trace
+				context = ctx.withNewTrace()
+			}
 			if pprofContext == nil && ctx.span != nil {
 				// Inherit the context.Context from parent span if it was propagated
 				// using ChildOf() rather than StartSpanFromContext(), see
@@ -445,20 +488,26 @@ func (t *tracer) StartSpan(operationName string, options ...ddtrace.StartSpanOpt
 	if id == 0 {
 		id = generateSpanID(startTime)
 	}
+	traceID := opts.TraceID
+	if traceID == 0 {
+		traceID = id
+	}
 	// span defaults
 	span := &span{
 		Name:         operationName,
 		Service:      t.config.serviceName,
 		Resource:     operationName,
 		SpanID:       id,
-		TraceID:      id,
+		TraceID:      traceID,
 		Start:        startTime,
 		noDebugStack: t.config.noDebugStack,
 	}
 	if t.config.hostname != "" {
 		span.setMeta(keyHostname, t.config.hostname)
 	}
-	if context != nil {
+	// an extracted context without trace ID only holds propagating tags, such
+	// as the request ID, and the span starts a new trace carrying them
+	if context != nil && !context.traceID.Empty() {
 		// this is a child span
 		span.TraceID = context.traceID.Lower()
 		span.ParentID = context.spanID
@@ -476,6 +525,9 @@ func (t *tracer) StartSpan(operationName string, options ...ddtrace.StartSpanOpt
 				// mark origin
 				span.setMeta(keyOrigin, context.origin)
 			}
+			if len(context.spanLinks) > 0 {
+				span.setMeta(keySpanLinks, encodeSpanLinks(context.spanLinks))
+			}
 		}
 	}
 	span.context = newSpanContext(span, context)
@@ -704,6 +704,30 @@ func TestTracerStartSpanOptions(t *testing.T) {
 	assert.Equal(1.0, span.Metrics[keyTopLevel])
 }
 
+func TestTracerStartSpanWithTraceID(t *testing.T) {
+	tracer := newTracer()
+	defer tracer.Stop()
+	t.Run("root", func(t *testing.T) {
+		assert := assert.New(t)
+		s := tracer.StartSpan("web.request", WithTraceID(1234), WithSpanID(5678)).(*span)
+		assert.Equal(uint64(5678), s.SpanID)
+		assert.Equal(uint64(1234), s.TraceID)
+		assert.Equal(uint64(1234), s.Context().TraceID())
+
+		carrier := TextMapCarrier{}
+		assert.NoError(tracer.Inject(s.Context(), carrier))
+		assert.Equal("1234", carrier[DefaultTraceIDHeader])
+		assert.Equal("5678", carrier[DefaultParentIDHeader])
+	})
+	t.Run("child", func(t *testing.T) {
+		assert := assert.New(t)
+		root := tracer.StartSpan("web.request", WithTraceID(1234)).(*span)
+		child := tracer.StartSpan("db.query", ChildOf(root.Context()), WithTraceID(4321)).(*span)
+		assert.Equal(uint64(1234), child.TraceID)
+		assert.Equal(root.SpanID, child.ParentID)
+	})
+}
+
 func TestTracerStartSpanOptions128(t *testing.T) {
 	tracer := newTracer()
 	defer tracer.Stop()
@@ -1521,7 +1545,8 @@ func TestPushPayload(t *testing.T) {
 	defer stop()
 
 	s := newBasicSpan("3MB")
-	s.Meta["key"] = strings.Repeat("X", payloadSizeLimit/2+10)
+	// a flush is triggered once the payload exceeds half of its maximum size
+	s.Meta["key"] = strings.Repeat("X", payloadMaxLimit/4+10)
 
 	// half payload size reached
 	tracer.pushTrace(&finishedTrace{[]*span{s}, true})
@@ -2111,6 +2136,38 @@ func (w *testTraceWriter) Flushed() []*span {
 	return w.flushed
 }
 
+func TestExtractFirst(t *testing.T) {
+	prop := NewPropagator(&PropagatorConfig{}, &propagator{cfg: &PropagatorConfig{
+		TraceHeader:    DefaultTraceIDHeader,
+		ParentHeader:   DefaultParentIDHeader,
+		PriorityHeader: DefaultPriorityHeader,
+	}})
+	empty := TextMapCarrier{}
+	corrupted := TextMapCarrier{DefaultTraceIDHeader: "x", DefaultParentIDHeader: "2"}
+	envelope := TextMapCarrier{DefaultTraceIDHeader: "1", DefaultParentIDHeader: "2"}
+	message := TextMapCarrier{DefaultTraceIDHeader: "3", DefaultParentIDHeader: "4"}
+
+	ctx, err := ExtractFirst(prop, empty, corrupted, message, envelope)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), ctx.TraceID())
+	assert.Equal(t, uint64(4), ctx.SpanID())
+
+	_, err = ExtractFirst(prop, empty, empty)
+	assert.Equal(t, ErrSpanContextNotFound, err)
+	_, err = ExtractFirst(prop, empty, corrupted, 42)
+	assert.Equal(t, ErrSpanContextCorrupted, err)
+	_, err = ExtractFirst(prop)
+	assert.Equal(t, ErrSpanContextNotFound, err)
+
+	t.Run("global", func(t *testing.T) {
+		Start(withTransport(newDummyTransport()))
+		defer Stop()
+		ctx, err := ExtractFirst(nil, empty, envelope)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1), ctx.TraceID())
+	})
+}
+
 func TestFlush(t *testing.T) {
 	tr, _, _, stop := startTestTracer(t)
 	defer stop()
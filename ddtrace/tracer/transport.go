@@ -7,6 +7,7 @@ package tracer
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -16,11 +17,13 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	traceinternal "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/version"
 
 	"github.com/tinylib/msgp/msgp"
@@ -43,8 +46,11 @@ var defaultClient = &http.Client{
 	// augmented with tracing and we don't want these calls to be recorded.
 	// See https://golang.org/pkg/net/http/#DefaultTransport .
 	Transport: &http.Transport{
-		Proxy:                 http.ProxyFromEnvironment,
-		DialContext:           defaultDialer.DialContext,
+		Proxy:       http.ProxyFromEnvironment,
+		DialContext: defaultDialer.DialContext,
+		// Setting a custom dialer disables HTTP/2, which is worth negotiating
+		// with agents reached over TLS, such as behind a load balancer.
+		ForceAttemptHTTP2:     true,
 		MaxIdleConns:          100,
 		IdleConnTimeout:       90 * time.Second,
 		TLSHandshakeTimeout:   10 * time.Second,
@@ -60,6 +66,7 @@ const (
 	defaultURL         = "http://" + defaultAddress
 	defaultHTTPTimeout = 2 * time.Second         // defines the current timeout before giving up with the send process
 	traceCountHeader   = "X-Datadog-Trace-Count" // header containing the number of traces in the payload
+	flushIDHeader      = "X-Datadog-Flush-Id"    // header containing the ID of the flush of the payload
 )
 
 // transport is an interface for communicating data to the agent.
@@ -120,17 +127,8 @@ func (t *httpTransport) sendStats(p *statsPayload) error {
 	if err != nil {
 		return err
 	}
-	if code := resp.StatusCode; code >= 400 {
-		// error, check the body for context information and
-		// return a nice error.
-		msg := make([]byte, 1000)
-		n, _ := resp.Body.Read(msg)
-		resp.Body.Close()
-		txt := http.StatusText(code)
-		if n > 0 {
-			return fmt.Errorf("%s (Status: %s)", msg[:n], txt)
-		}
-		return fmt.Errorf("%s", txt)
+	if resp.StatusCode >= 400 {
+		return newAgentError(resp)
 	}
 	return nil
 }
@@ -144,6 +142,9 @@ func (t *httpTransport) send(p *payload) (body io.ReadCloser, err error) {
 		req.Header.Set(header, value)
 	}
 	req.Header.Set(traceCountHeader, strconv.Itoa(p.itemCount()))
+	if p.flushID != "" {
+		req.Header.Set(flushIDHeader, p.flushID)
+	}
 	req.Header.Set("Content-Length", strconv.Itoa(p.size()))
 	req.Header.Set(headerComputedTopLevel, "yes")
 	if t, ok := traceinternal.GetGlobalTracer().(*tracer); ok {
@@ -165,29 +166,170 @@ func (t *httpTransport) send(p *payload) (body io.ReadCloser, err error) {
 	if err != nil {
 		return nil, err
 	}
-	if code := response.StatusCode; code >= 400 {
-		// error, check the body for context information and
-		// return a nice error.
-		msg := make([]byte, 1000)
-		n, _ := response.Body.Read(msg)
-		response.Body.Close()
-		txt := http.StatusText(code)
-		if n > 0 {
-			return nil, fmt.Errorf("%s (Status: %s)", msg[:n], txt)
-		}
-		return nil, fmt.Errorf("%s", txt)
+	if response.StatusCode >= 400 {
+		return nil, newAgentError(response)
 	}
 	return response.Body, nil
 }
 
+// mirroringTransport is a transport sending the payloads to a primary
+// transport, and mirroring them to a secondary one on a best-effort basis. It
+// is installed by WithSecondaryAgent.
+type mirroringTransport struct {
+	primary, secondary transport
+
+	// climit limits the number of concurrent sends to the secondary transport
+	climit chan struct{}
+
+	// wg waits for the sends to the secondary transport to finish
+	wg sync.WaitGroup
+}
+
+var _ transport = (*mirroringTransport)(nil)
+
+func newMirroringTransport(primary, secondary transport) *mirroringTransport {
+	return &mirroringTransport{
+		primary:   primary,
+		secondary: secondary,
+		climit:    make(chan struct{}, concurrentConnectionLimit),
+	}
+}
+
+// send sends the payload p to the primary transport, and a copy of it to the
+// secondary one in the background. The payload is mirrored once, even when
+// its sending to the primary transport is retried. Only the response and error
+// of the primary transport are returned, the secondary transport errors being
+// logged.
+func (t *mirroringTransport) send(p *payload) (io.ReadCloser, error) {
+	if !p.mirrored {
+		p.mirrored = true
+		t.mirror(p.clone())
+	}
+	return t.primary.send(p)
+}
+
+// mirror sends p to the secondary transport in the background. The payload
+// is dropped when too many of them are being sent.
+func (t *mirroringTransport) mirror(p *payload) {
+	select {
+	case t.climit <- struct{}{}:
+	default:
+		log.Warn("dropping %d traces mirrored to the secondary agent at %s: too many concurrent sends", p.itemCount(), t.secondary.endpoint())
+		return
+	}
+	t.wg.Add(1)
+	go func() {
+		defer func() {
+			<-t.climit
+			t.wg.Done()
+		}()
+		rc, err := t.secondary.send(p)
+		if err != nil {
+			log.Warn("failure sending traces to the secondary agent at %s: %v", t.secondary.endpoint(), err)
+			return
+		}
+		io.Copy(io.Discard, rc)
+		rc.Close()
+	}()
+}
+
+// sendStats sends the stats payload p to the primary transport, and then to the
+// secondary one. Only the error of the primary transport is returned.
+func (t *mirroringTransport) sendStats(p *statsPayload) error {
+	err := t.primary.sendStats(p)
+	if err := t.secondary.sendStats(p); err != nil {
+		log.Warn("failure sending stats to the secondary agent at %s: %v", t.secondary.endpoint(), err)
+	}
+	return err
+}
+
+// endpoint returns the endpoint of the primary transport.
+func (t *mirroringTransport) endpoint() string {
+	return t.primary.endpoint()
+}
+
+// dryRunTransport is a transport which validates the payloads it is given
+// and discards them, never reaching the agent. It is installed by
+// WithDryRunTransport.
+type dryRunTransport struct{}
+
+var _ transport = (*dryRunTransport)(nil)
+
+// dryRunResponse is the body returned by the dry-run transport in place of the
+// agent response. It carries no sampling rates.
+const dryRunResponse = `{"rate_by_service":{}}`
+
+// send decodes the payload p and discards it. An error is returned if the
+// payload is malformed.
+func (t *dryRunTransport) send(p *payload) (io.ReadCloser, error) {
+	var traces spanLists
+	r := msgp.NewReader(p)
+	if err := traces.DecodeMsg(r); err != nil {
+		return nil, fmt.Errorf("dry-run: cannot decode payload: %v", err)
+	}
+	if _, err := r.NextType(); err != io.EOF {
+		return nil, errors.New("dry-run: unexpected data after the payload traces")
+	}
+	return io.NopCloser(strings.NewReader(dryRunResponse)), nil
+}
+
+// sendStats encodes the stats payload p and discards it.
+func (t *dryRunTransport) sendStats(p *statsPayload) error {
+	if err := msgp.Encode(io.Discard, p); err != nil {
+		return fmt.Errorf("dry-run: cannot encode stats payload: %v", err)
+	}
+	return nil
+}
+
+func (t *dryRunTransport) endpoint() string {
+	return "dry-run"
+}
+
+// agentError is returned by the transport when the agent replies with an
+// error status code.
+type agentError struct {
+	status int    // HTTP status code of the response
+	msg    string // error message
+}
+
+// newAgentError reads the body of the error response resp for context
+// information and returns a nice error. The body is closed.
+func newAgentError(resp *http.Response) *agentError {
+	msg := make([]byte, 1000)
+	n, _ := resp.Body.Read(msg)
+	resp.Body.Close()
+	txt := http.StatusText(resp.StatusCode)
+	if n > 0 {
+		txt = fmt.Sprintf("%s (Status: %s)", msg[:n], txt)
+	}
+	return &agentError{status: resp.StatusCode, msg: txt}
+}
+
+func (e *agentError) Error() string { return e.msg }
+
+// errorStatusClass returns the HTTP status class (e.g. "5xx") of the agent
+// response which caused err, or "unknown" if err was not caused by an error
+// response, such as when the agent could not be reached.
+func errorStatusClass(err error) string {
+	var aerr *agentError
+	if errors.As(err, &aerr) {
+		return fmt.Sprintf("%dxx", aerr.status/100)
+	}
+	return "unknown"
+}
+
 func (t *httpTransport) endpoint() string {
 	return t.traceURL
 }
 
 // resolveAgentAddr resolves the given agent address and fills in any missing host
 // and port using the defaults. Some environment variable settings will
-// take precedence over configuration.
+// take precedence over configuration. A valid DD_TRACE_AGENT_URL (http, https
+// or unix scheme) takes precedence over DD_AGENT_HOST and DD_TRACE_AGENT_PORT.
 func resolveAgentAddr() *url.URL {
+	if u := internal.AgentURLFromEnv(); u != nil {
+		return u
+	}
 	var host, port string
 	if v := os.Getenv("DD_AGENT_HOST"); v != "" {
 		host = v
@@ -196,10 +338,16 @@ func resolveAgentAddr() *url.URL {
 		port = v
 	}
 	if _, err := os.Stat(defaultSocketAPM); host == "" && port == "" && err == nil {
-		return &url.URL{
-			Scheme: "unix",
-			Path:   defaultSocketAPM,
+		// The socket file may be left over by an agent which is no longer
+		// running, in which case the TCP default is used instead.
+		err := probeSocket(defaultSocketAPM)
+		if err == nil {
+			return &url.URL{
+				Scheme: "unix",
+				Path:   defaultSocketAPM,
+			}
 		}
+		log.Warn("Unable to connect to the agent socket %s (%v), falling back to %s", defaultSocketAPM, err, defaultURL)
 	}
 	if host == "" {
 		host = defaultHostname
@@ -212,3 +360,17 @@ func resolveAgentAddr() *url.URL {
 		Host:   fmt.Sprintf("%s:%s", host, port),
 	}
 }
+
+// socketProbeTimeout is the maximum duration of the connection attempt made to
+// check whether the default agent socket is accepting connections.
+const socketProbeTimeout = 500 * time.Millisecond
+
+// probeSocket returns an error if no connection can be established to the unix
+// domain socket at path.
+func probeSocket(path string) error {
+	conn, err := net.DialTimeout("unix", path, socketProbeTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
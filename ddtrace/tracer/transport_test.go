@@ -6,6 +6,8 @@
 package tracer
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"net"
@@ -14,12 +16,17 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tinylib/msgp/msgp"
 )
 
 // getTestSpan returns a Span with different fields set
@@ -111,14 +118,58 @@ func TestResolveAgentAddr(t *testing.T) {
 		})
 	}
 
+	t.Run("DD_TRACE_AGENT_URL", func(t *testing.T) {
+		for _, tt := range []struct {
+			inOpt            StartOption
+			envURL           string
+			envHost, envPort string
+			out              *url.URL
+		}{
+			{nil, "http://agent.local:1234", "", "", &url.URL{Scheme: "http", Host: "agent.local:1234"}},
+			{nil, "https://agent.local:1234", "", "", &url.URL{Scheme: "https", Host: "agent.local:1234"}},
+			{nil, "unix:///path/to/apm.socket", "", "", &url.URL{Scheme: "unix", Path: "/path/to/apm.socket"}},
+			{nil, "http://agent.local:1234", "ip.local", "9876", &url.URL{Scheme: "http", Host: "agent.local:1234"}},
+			{nil, "unix:///path/to/apm.socket", "ip.local", "9876", &url.URL{Scheme: "unix", Path: "/path/to/apm.socket"}},
+			{nil, "ftp://agent.local:1234", "ip.local", "9876", &url.URL{Scheme: "http", Host: "ip.local:9876"}},
+			{nil, "ftp://agent.local:1234", "", "", &url.URL{Scheme: "http", Host: defaultAddress}},
+			{WithAgentAddr("ip.other:8888"), "https://agent.local:1234", "", "", &url.URL{Scheme: "http", Host: "ip.other:8888"}},
+		} {
+			t.Run("", func(t *testing.T) {
+				t.Setenv("DD_TRACE_AGENT_URL", tt.envURL)
+				if tt.envHost != "" {
+					t.Setenv("DD_AGENT_HOST", tt.envHost)
+				}
+				if tt.envPort != "" {
+					t.Setenv("DD_TRACE_AGENT_PORT", tt.envPort)
+				}
+				c.agentURL = resolveAgentAddr()
+				if tt.inOpt != nil {
+					tt.inOpt(c)
+				}
+				assert.Equal(t, tt.out, c.agentURL)
+			})
+		}
+	})
+
 	t.Run("UDS", func(t *testing.T) {
-		old := defaultSocketAPM
-		d, err := os.Getwd()
+		dir, err := os.MkdirTemp("", "socket")
 		require.NoError(t, err)
-		defaultSocketAPM = d // Choose a file we know will exist
-		defer func() { defaultSocketAPM = old }()
+		defer os.RemoveAll(dir)
+		defer func(old string) { defaultSocketAPM = old }(defaultSocketAPM)
+		defaultSocketAPM = filepath.Join(dir, "apm.socket")
+		ln, err := net.Listen("unix", defaultSocketAPM)
+		require.NoError(t, err)
+		ln.(*net.UnixListener).SetUnlinkOnClose(false)
+
 		c.agentURL = resolveAgentAddr()
-		assert.Equal(t, &url.URL{Scheme: "unix", Path: d}, c.agentURL)
+		assert.Equal(t, &url.URL{Scheme: "unix", Path: defaultSocketAPM}, c.agentURL)
+
+		// the socket file remains, but doesn't accept connections anymore
+		ln.Close()
+		_, err = os.Stat(defaultSocketAPM)
+		require.NoError(t, err)
+		c.agentURL = resolveAgentAddr()
+		assert.Equal(t, &url.URL{Scheme: "http", Host: defaultAddress}, c.agentURL)
 	})
 }
 
@@ -241,6 +292,40 @@ func TestCustomTransport(t *testing.T) {
 	assert.Equal(hits, 1)
 }
 
+func TestDryRunTransport(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		assert := assert.New(t)
+		c := newConfig(WithDryRunTransport())
+		assert.IsType(&dryRunTransport{}, c.transport)
+		assert.True(c.dryRun())
+
+		p, err := encode(getTestTrace(3, 2))
+		assert.NoError(err)
+		rc, err := c.transport.send(p)
+		assert.NoError(err)
+		ps := newPrioritySampler()
+		assert.NoError(ps.readRatesJSON(rc))
+		assert.NoError(c.transport.sendStats(&statsPayload{}))
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		p, err := encode(getTestTrace(1, 1))
+		assert.NoError(t, err)
+		p.buf.WriteString("garbage")
+		_, err = (&dryRunTransport{}).send(p)
+		assert.Error(t, err)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		p, err := encode(getTestTrace(2, 1))
+		assert.NoError(t, err)
+		atomic.AddUint32(&p.count, 1)
+		p.updateHeader()
+		_, err = (&dryRunTransport{}).send(p)
+		assert.Error(t, err)
+	})
+}
+
 func TestWithHTTPClient(t *testing.T) {
 	// disable instrumentation telemetry to prevent flaky number of requests
 	t.Setenv("DD_INSTRUMENTATION_TELEMETRY_ENABLED", "false")
@@ -269,6 +354,281 @@ func TestWithHTTPClient(t *testing.T) {
 	assert.Equal(hits, 2)
 }
 
+func TestWithRequestInterceptor(t *testing.T) {
+	// disable instrumentation telemetry to prevent flaky number of requests
+	t.Setenv("DD_INSTRUMENTATION_TELEMETRY_ENABLED", "false")
+	t.Setenv("DD_TRACE_STARTUP_LOGS", "0")
+	assert := assert.New(t)
+	var auths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		auths = append(auths, r.Header.Get("Proxy-Authorization"))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	assert.NoError(err)
+	c := &http.Client{}
+	rt := wrapRecordingRoundTripper(c)
+	var order []int
+	trc := newTracer(WithAgentAddr(u.Host), WithHTTPClient(c),
+		WithRequestInterceptor(func(r *http.Request) {
+			order = append(order, 1)
+			r.Header.Set("Proxy-Authorization", "Basic dGVzdA==")
+		}),
+		WithRequestInterceptor(func(r *http.Request) {
+			order = append(order, 2)
+		}),
+	)
+	defer trc.Stop()
+
+	p, err := encode(getTestTrace(1, 1))
+	assert.NoError(err)
+	_, err = trc.config.transport.send(p)
+	assert.NoError(err)
+	assert.Equal([]string{"Basic dGVzdA==", "Basic dGVzdA=="}, auths)
+	assert.Equal([]int{1, 2, 1, 2}, order)
+	// the custom client is still used
+	assert.Len(rt.reqs, 2)
+	assert.Contains(rt.reqs[1].URL.Path, "/traces")
+}
+
+func TestWithSecondaryAgent(t *testing.T) {
+	// disable instrumentation telemetry to prevent flaky number of requests
+	t.Setenv("DD_INSTRUMENTATION_TELEMETRY_ENABLED", "false")
+	t.Setenv("DD_TRACE_STARTUP_LOGS", "0")
+	newAgent := func(status int) (*httptest.Server, *int32) {
+		var traces int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasSuffix(r.URL.Path, "/traces") {
+				return
+			}
+			var tl spanLists
+			if err := msgp.Decode(r.Body, &tl); err == nil {
+				atomic.AddInt32(&traces, int32(len(tl)))
+			}
+			w.WriteHeader(status)
+			w.Write([]byte(`{"rate_by_service":{}}`))
+		}))
+		return srv, &traces
+	}
+
+	t.Run("both", func(t *testing.T) {
+		assert := assert.New(t)
+		primary, primaryTraces := newAgent(http.StatusOK)
+		defer primary.Close()
+		secondary, secondaryTraces := newAgent(http.StatusOK)
+		defer secondary.Close()
+		pu, err := url.Parse(primary.URL)
+		assert.NoError(err)
+		su, err := url.Parse(secondary.URL)
+		assert.NoError(err)
+		trc := newTracer(WithAgentAddr(pu.Host), WithSecondaryAgent(su.Host))
+		defer trc.Stop()
+
+		p, err := encode(getTestTrace(1, 1))
+		assert.NoError(err)
+		rc, err := trc.config.transport.send(p)
+		assert.NoError(err)
+		rc.Close()
+		// a retry isn't mirrored again
+		p.reset()
+		rc, err = trc.config.transport.send(p)
+		assert.NoError(err)
+		rc.Close()
+		trc.config.transport.(*mirroringTransport).wg.Wait()
+		assert.Equal(int32(2), atomic.LoadInt32(primaryTraces))
+		assert.Equal(int32(1), atomic.LoadInt32(secondaryTraces))
+	})
+
+	t.Run("secondary-failure", func(t *testing.T) {
+		assert := assert.New(t)
+		primary, primaryTraces := newAgent(http.StatusOK)
+		defer primary.Close()
+		secondary, secondaryTraces := newAgent(http.StatusInternalServerError)
+		defer secondary.Close()
+		pu, err := url.Parse(primary.URL)
+		assert.NoError(err)
+		su, err := url.Parse(secondary.URL)
+		assert.NoError(err)
+		trc := newTracer(WithAgentAddr(pu.Host), WithSecondaryAgent(su.Host))
+		defer trc.Stop()
+
+		p, err := encode(getTestTrace(1, 1))
+		assert.NoError(err)
+		rc, err := trc.config.transport.send(p)
+		assert.NoError(err)
+		rc.Close()
+		trc.config.transport.(*mirroringTransport).wg.Wait()
+		assert.Equal(int32(1), atomic.LoadInt32(primaryTraces))
+		assert.Equal(int32(1), atomic.LoadInt32(secondaryTraces))
+	})
+
+	t.Run("async", func(t *testing.T) {
+		assert := assert.New(t)
+		primary, primaryTraces := newAgent(http.StatusOK)
+		defer primary.Close()
+		unblock := make(chan struct{})
+		secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-unblock
+		}))
+		defer secondary.Close()
+		pu, err := url.Parse(primary.URL)
+		assert.NoError(err)
+		su, err := url.Parse(secondary.URL)
+		assert.NoError(err)
+		trc := newTracer(WithAgentAddr(pu.Host), WithSecondaryAgent(su.Host))
+		defer trc.Stop()
+
+		// the sending to the primary agent doesn't wait for the secondary one
+		p, err := encode(getTestTrace(1, 1))
+		assert.NoError(err)
+		rc, err := trc.config.transport.send(p)
+		assert.NoError(err)
+		rc.Close()
+		assert.Equal(int32(1), atomic.LoadInt32(primaryTraces))
+		close(unblock)
+	})
+}
+
+func TestWithAgentTLSConfig(t *testing.T) {
+	// disable instrumentation telemetry to prevent flaky number of requests
+	t.Setenv("DD_INSTRUMENTATION_TELEMETRY_ENABLED", "false")
+	t.Setenv("DD_TRACE_STARTUP_LOGS", "0")
+	var hits int
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer srv.Close()
+	t.Setenv("DD_TRACE_AGENT_URL", srv.URL)
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	tlsCfg := &tls.Config{RootCAs: pool}
+
+	t.Run("ok", func(t *testing.T) {
+		assert := assert.New(t)
+		hits = 0
+		trc := newTracer(WithAgentTLSConfig(tlsCfg))
+		defer trc.Stop()
+		assert.Equal("https", trc.config.agentURL.Scheme)
+
+		p, err := encode(getTestTrace(1, 1))
+		assert.NoError(err)
+		_, err = trc.config.transport.send(p)
+		assert.NoError(err)
+		assert.Equal(2, hits)
+	})
+
+	t.Run("untrusted", func(t *testing.T) {
+		assert := assert.New(t)
+		hits = 0
+		trc := newTracer()
+		defer trc.Stop()
+
+		p, err := encode(getTestTrace(1, 1))
+		assert.NoError(err)
+		_, err = trc.config.transport.send(p)
+		assert.Error(err)
+		assert.Equal(0, hits)
+	})
+
+	t.Run("last-wins", func(t *testing.T) {
+		c := &http.Client{}
+		cfg := newConfig(WithAgentTLSConfig(tlsCfg), WithHTTPClient(c))
+		assert.Equal(t, c, cfg.httpClient)
+		cfg = newConfig(WithHTTPClient(c), WithAgentTLSConfig(tlsCfg))
+		assert.NotEqual(t, c, cfg.httpClient)
+	})
+}
+
+func TestAgentHTTP2(t *testing.T) {
+	// disable instrumentation telemetry to prevent flaky number of requests
+	t.Setenv("DD_INSTRUMENTATION_TELEMETRY_ENABLED", "false")
+	var (
+		mu    sync.Mutex
+		proto string
+	)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		proto = r.Proto
+		mu.Unlock()
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	t.Setenv("DD_TRACE_AGENT_URL", srv.URL)
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	tlsCfg := &tls.Config{RootCAs: pool}
+
+	send := func(t *testing.T, c *config) string {
+		p, err := encode(getTestTrace(1, 1))
+		require.NoError(t, err)
+		_, err = c.transport.send(p)
+		require.NoError(t, err)
+		mu.Lock()
+		defer mu.Unlock()
+		return proto
+	}
+
+	t.Run("default", func(t *testing.T) {
+		tr := defaultClient.Transport.(*http.Transport).Clone()
+		tr.TLSClientConfig = tlsCfg
+		c := newConfig(WithHTTPClient(&http.Client{Transport: tr}))
+		assert.Equal(t, "HTTP/2.0", send(t, c))
+	})
+
+	t.Run("tls-config", func(t *testing.T) {
+		c := newConfig(WithAgentTLSConfig(tlsCfg))
+		assert.Equal(t, "HTTP/2.0", send(t, c))
+	})
+
+	t.Run("force-http1", func(t *testing.T) {
+		c := newConfig(WithAgentTLSConfig(tlsCfg), WithForceHTTP1())
+		assert.Equal(t, "HTTP/1.1", send(t, c))
+	})
+}
+
+func TestWithAgentPathPrefix(t *testing.T) {
+	// disable instrumentation telemetry to prevent flaky number of requests
+	t.Setenv("DD_INSTRUMENTATION_TELEMETRY_ENABLED", "false")
+	t.Setenv("DD_TRACE_STARTUP_LOGS", "0")
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	for _, prefix := range []string{"/datadog", "/datadog/"} {
+		t.Run(prefix, func(t *testing.T) {
+			assert := assert.New(t)
+			paths = nil
+			trc := newTracer(WithAgentAddr(u.Host), WithAgentPathPrefix(prefix))
+			defer trc.Stop()
+
+			p, err := encode(getTestTrace(1, 1))
+			assert.NoError(err)
+			_, err = trc.config.transport.send(p)
+			assert.NoError(err)
+			assert.NoError(trc.config.transport.sendStats(&statsPayload{}))
+			assert.Equal([]string{"/datadog/info", "/datadog/v0.4/traces", "/datadog/v0.6/stats"}, paths)
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		c := newConfig(WithAgentAddr(u.Host), WithAgentPathPrefix("datadog"))
+		assert.Equal(t, "", c.agentPathPrefix)
+		assert.Equal(t, &url.URL{Scheme: "http", Host: u.Host}, c.agentURL)
+	})
+
+	t.Run("UDS", func(t *testing.T) {
+		c := newConfig(WithUDS("/tmp/apm.socket"), WithAgentPathPrefix("/datadog"))
+		assert.Equal(t, "/datadog", c.agentURL.Path)
+		assert.Equal(t, "http", c.agentURL.Scheme)
+	})
+}
+
 func TestWithUDS(t *testing.T) {
 	// disable instrumentation telemetry to prevent flaky number of requests
 	t.Setenv("DD_INSTRUMENTATION_TELEMETRY_ENABLED", "false")
@@ -305,3 +665,67 @@ func TestWithUDS(t *testing.T) {
 	assert.Len(rt.reqs, 1)
 	assert.Equal(hits, 2)
 }
+
+func TestWithUDSConnectionPool(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		c := newConfig(WithUDS("/tmp/apm.socket"))
+		tr := c.httpClient.Transport.(*http.Transport)
+		assert.Equal(t, defaultUDSMaxIdleConns, tr.MaxIdleConns)
+		assert.Equal(t, defaultUDSMaxIdleConns, tr.MaxIdleConnsPerHost)
+		assert.Equal(t, defaultUDSIdleConnTimeout, tr.IdleConnTimeout)
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		c := newConfig(WithUDS("/tmp/apm.socket"), WithUDSConnectionPool(10, time.Minute))
+		tr := c.httpClient.Transport.(*http.Transport)
+		assert.Equal(t, 10, tr.MaxIdleConns)
+		assert.Equal(t, 10, tr.MaxIdleConnsPerHost)
+		assert.Equal(t, time.Minute, tr.IdleConnTimeout)
+	})
+}
+
+// BenchmarkUDSTransport compares the throughput of concurrent payload uploads
+// over a unix domain socket with the standard per-host limit of idle
+// connections, which causes connections to be re-dialed, and with the UDS
+// transport defaults.
+func BenchmarkUDSTransport(b *testing.B) {
+	udsPath := filepath.Join(b.TempDir(), "apm.socket")
+	ln, err := net.Listen("unix", udsPath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	srv := http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte(`{"rate_by_service":{}}`))
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	for name, perHost := range map[string]int{
+		"per-host-default": http.DefaultMaxIdleConnsPerHost,
+		"uds-defaults":     defaultUDSMaxIdleConns,
+	} {
+		b.Run(name, func(b *testing.B) {
+			client := udsClient(udsPath, 0, 0)
+			client.Transport.(*http.Transport).MaxIdleConnsPerHost = perHost
+			defer client.CloseIdleConnections()
+			trans := newHTTPTransport("http://UDS_apm.socket", client)
+			b.SetParallelism(concurrentConnectionLimit / runtime.GOMAXPROCS(0))
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					p, err := encode(getTestTrace(1, 10))
+					if err != nil {
+						b.Fatal(err)
+					}
+					rc, err := trans.send(p)
+					if err != nil {
+						b.Fatal(err)
+					}
+					rc.Close()
+				}
+			})
+		})
+	}
+}
@@ -17,6 +17,9 @@ import (
 	"time"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+
+	"github.com/google/uuid"
+	"github.com/tinylib/msgp/msgp"
 )
 
 type traceWriter interface {
@@ -49,6 +52,10 @@ type agentTraceWriter struct {
 
 	// statsd is used to send metrics
 	statsd statsdClient
+
+	// breaker stops sending payloads while the agent is unreachable. It is
+	// nil when circuit breaking is disabled.
+	breaker *circuitBreaker
 }
 
 func newAgentTraceWriter(c *config, s *prioritySampler, statsdClient statsdClient) *agentTraceWriter {
@@ -58,24 +65,101 @@ func newAgentTraceWriter(c *config, s *prioritySampler, statsdClient statsdClien
 		climit:           make(chan struct{}, concurrentConnectionLimit),
 		prioritySampling: s,
 		statsd:           statsdClient,
+		breaker:          newCircuitBreaker(c.breakerThreshold, c.breakerCooldown, c.clock),
 	}
 }
 
 func (h *agentTraceWriter) add(trace []*span) {
-	if err := h.payload.push(trace); err != nil {
-		h.statsd.Incr("datadog.tracer.traces_dropped", []string{"reason:encoding_error"}, 1)
-		log.Error("Error encoding msgpack: %v", err)
+	if h.breaker.open() {
+		// don't spend any time encoding traces which would be dropped
+		h.statsd.Incr("datadog.tracer.traces_dropped", []string{"reason:circuit_open"}, 1)
+		return
+	}
+	max := h.maxPayloadSize()
+	for _, chunk := range splitTrace(trace, max) {
+		if h.payload.itemCount() > 0 && h.payload.size()+spanList(chunk).Msgsize() > max {
+			// the chunk would not fit in the current payload
+			h.statsd.Incr("datadog.tracer.flush_triggered", []string{"reason:size"}, 1)
+			h.flush()
+		}
+		if err := h.payload.push(chunk); err != nil {
+			h.statsd.Incr("datadog.tracer.traces_dropped", []string{"reason:encoding_error"}, 1)
+			log.Error("Error encoding msgpack: %v", err)
+		}
 	}
-	if h.payload.size() > payloadSizeLimit {
+	if h.payload.size() > max/2 {
 		h.statsd.Incr("datadog.tracer.flush_triggered", []string{"reason:size"}, 1)
 		h.flush()
 	}
 }
 
+// maxPayloadSize returns the maximum size of the payloads sent to the agent.
+func (h *agentTraceWriter) maxPayloadSize() int {
+	if h.config.maxPayloadSize > 0 {
+		return h.config.maxPayloadSize
+	}
+	return payloadMaxLimit
+}
+
+// splitTrace splits the given trace into chunks whose encoded size does not
+// exceed max bytes, each of them being sent as a separate trace that the agent
+// reassembles. The sampling priority of the trace is set on the first span of
+// every chunk, so that the chunks are sampled consistently. A span larger than
+// max is sent in a chunk of its own.
+func splitTrace(trace []*span, max int) [][]*span {
+	if spanList(trace).Msgsize() <= max {
+		return [][]*span{trace}
+	}
+	var (
+		chunks [][]*span
+		chunk  []*span
+		size   = msgp.ArrayHeaderSize
+	)
+	for _, s := range trace {
+		n := s.Msgsize()
+		if len(chunk) > 0 && size+n > max {
+			chunks = append(chunks, chunk)
+			chunk, size = nil, msgp.ArrayHeaderSize
+		}
+		chunk = append(chunk, s)
+		size += n
+	}
+	chunks = append(chunks, chunk)
+	if p, ok := samplingPriorityOf(trace); ok {
+		for _, c := range chunks {
+			c[0].Lock()
+			if _, ok := c[0].Metrics[keySamplingPriority]; !ok {
+				c[0].setMetric(keySamplingPriority, p)
+			}
+			c[0].Unlock()
+		}
+	}
+	log.Debug("Split trace of %d spans into %d chunks", len(trace), len(chunks))
+	return chunks
+}
+
+// samplingPriorityOf returns the sampling priority set on the spans of the
+// given trace, if any.
+func samplingPriorityOf(trace []*span) (float64, bool) {
+	for _, s := range trace {
+		s.RLock()
+		p, ok := s.Metrics[keySamplingPriority]
+		s.RUnlock()
+		if ok {
+			return p, true
+		}
+	}
+	return 0, false
+}
+
 func (h *agentTraceWriter) stop() {
 	h.statsd.Incr("datadog.tracer.flush_triggered", []string{"reason:shutdown"}, 1)
 	h.flush()
 	h.wg.Wait()
+	if t, ok := h.config.transport.(*mirroringTransport); ok {
+		// let the payloads being mirrored reach the secondary agent
+		t.wg.Wait()
+	}
 }
 
 // flush will push any currently buffered traces to the server.
@@ -86,6 +170,7 @@ func (h *agentTraceWriter) flush() {
 	h.wg.Add(1)
 	h.climit <- struct{}{}
 	oldp := h.payload
+	oldp.flushID = uuid.New().String()
 	h.payload = newPayload()
 	go func(p *payload) {
 		defer func(start time.Time) {
@@ -97,17 +182,26 @@ func (h *agentTraceWriter) flush() {
 
 			<-h.climit
 			h.wg.Done()
-			h.statsd.Timing("datadog.tracer.flush_duration", time.Since(start), nil, 1)
-		}(time.Now())
+			h.statsd.Timing("datadog.tracer.flush_duration", h.config.clock.now().Sub(start), nil, 1)
+		}(h.config.clock.now())
 
+		if !h.breaker.allow() {
+			h.statsd.Count("datadog.tracer.traces_dropped", int64(p.itemCount()), []string{"reason:circuit_open"}, 1)
+			return
+		}
 		var count, size int
 		var err error
+		// The distribution of the payload characteristics allows correlating the
+		// agent load with them and spotting oversized traces.
+		h.statsd.Distribution("datadog.tracer.payload_bytes", float64(p.size()), nil, 1)
+		h.statsd.Distribution("datadog.tracer.payload_traces", float64(p.itemCount()), nil, 1)
 		for attempt := 0; attempt <= h.config.sendRetries; attempt++ {
 			size, count = p.size(), p.itemCount()
-			log.Debug("Sending payload: size: %d traces: %d\n", size, count)
+			log.Debug("Sending payload: size: %d traces: %d flush_id: %s\n", size, count, p.flushID)
 			rc, err := h.config.transport.send(p)
 			if err == nil {
-				log.Debug("sent traces after %d attempts", attempt+1)
+				log.Debug("sent traces after %d attempts (flush_id: %s)", attempt+1, p.flushID)
+				h.breaker.success()
 				h.statsd.Count("datadog.tracer.flush_bytes", int64(size), nil, 1)
 				h.statsd.Count("datadog.tracer.flush_traces", int64(count), nil, 1)
 				if err := h.prioritySampling.readRatesJSON(rc); err != nil {
@@ -115,12 +209,14 @@ func (h *agentTraceWriter) flush() {
 				}
 				return
 			}
-			log.Error("failure sending traces (attempt %d), will retry: %v", attempt+1, err)
+			h.statsd.Incr("datadog.tracer.api.errors", []string{"status_class:" + errorStatusClass(err)}, 1)
+			log.Error("failure sending traces (attempt %d, flush_id: %s), will retry: %v", attempt+1, p.flushID, err)
 			p.reset()
-			time.Sleep(time.Millisecond)
+			h.config.clock.sleep(time.Millisecond)
 		}
+		h.breaker.failure()
 		h.statsd.Count("datadog.tracer.traces_dropped", int64(count), []string{"reason:send_failed"}, 1)
-		log.Error("lost %d traces: %v", count, err)
+		log.Error("lost %d traces (flush_id: %s): %v", count, p.flushID, err)
 	}(oldp)
 }
 
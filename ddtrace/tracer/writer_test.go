@@ -12,8 +12,13 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 
@@ -406,16 +411,334 @@ func TestTraceWriterFlushRetries(t *testing.T) {
 
 			statsd.mu.Lock()
 			assert.Equal(1, len(statsd.timingCalls))
+			var want map[string]int64
 			if test.tracesSent {
-				assert.Equal(sentCounts, statsd.counts)
+				want = copyCounts(sentCounts)
 			} else {
-				assert.Equal(droppedCounts, statsd.counts)
+				want = copyCounts(droppedCounts)
 			}
+			failed := test.expAttempts
+			if test.tracesSent {
+				failed--
+			}
+			if failed > 0 {
+				want["datadog.tracer.api.errors"] = int64(failed)
+			}
+			assert.Equal(want, statsd.counts)
 			statsd.mu.Unlock()
 		})
 	}
 }
 
+func TestTraceWriterCircuitBreaker(t *testing.T) {
+	assert := assert.New(t)
+	p := &failingTransport{failCount: 3, assert: assert}
+	clock := newFakeClock()
+	c := newConfig(func(c *config) {
+		c.transport = p
+		c.clock = clock
+	}, WithCircuitBreaker(2, time.Minute))
+	var statsd testStatsdClient
+	h := newAgentTraceWriter(c, nil, &statsd)
+	// the failing transport expects the same traces on every attempt
+	ss := []*span{makeSpan(0)}
+	send := func() {
+		h.add(ss)
+		h.flush()
+		h.wg.Wait()
+	}
+
+	send()
+	send()
+	assert.Equal(2, p.sendAttempts)
+	assert.Equal(breakerOpen, h.breaker.state())
+
+	// the traces are dropped while the breaker is open
+	send()
+	assert.Equal(2, p.sendAttempts)
+	assert.Equal(0, h.payload.itemCount())
+	assert.Contains(statsd.IncrCalls(), testStatsdCall{
+		name: "datadog.tracer.traces_dropped",
+		tags: []string{"reason:circuit_open"},
+		rate: 1,
+	})
+
+	// the failed probe opens the breaker again
+	clock.advance(time.Minute)
+	send()
+	assert.Equal(3, p.sendAttempts)
+	assert.Equal(breakerOpen, h.breaker.state())
+
+	clock.advance(time.Minute)
+	send()
+	assert.Equal(4, p.sendAttempts)
+	assert.True(p.tracesSent)
+	assert.Equal(breakerClosed, h.breaker.state())
+}
+
+func TestTraceWriterRetryClock(t *testing.T) {
+	assert := assert.New(t)
+	p := &failingTransport{failCount: 2, assert: assert}
+	clock := newFakeClock()
+	c := newConfig(func(c *config) {
+		c.transport = p
+		c.sendRetries = 2
+		c.clock = clock
+	})
+	var statsd testStatsdClient
+	h := newAgentTraceWriter(c, nil, &statsd)
+	h.add([]*span{makeSpan(0)})
+	h.flush()
+	h.wg.Wait()
+
+	assert.Equal(3, p.sendAttempts)
+	assert.True(p.tracesSent)
+	// each failed attempt waits before the next one, without sleeping
+	assert.Equal([]time.Duration{time.Millisecond, time.Millisecond}, clock.sleeps())
+	statsd.mu.Lock()
+	defer statsd.mu.Unlock()
+	if assert.Len(statsd.timingCalls, 1) {
+		assert.Equal("datadog.tracer.flush_duration", statsd.timingCalls[0].name)
+		assert.Equal(2*time.Millisecond, statsd.timingCalls[0].timeVal)
+	}
+}
+
+func TestTraceWriterPayloadDistribution(t *testing.T) {
+	for _, failCount := range []int{0, 2} {
+		t.Run(fmt.Sprintf("fail-%d", failCount), func(t *testing.T) {
+			assert := assert.New(t)
+			c := newConfig(func(c *config) {
+				c.transport = &failingTransport{failCount: failCount, assert: assert}
+				c.sendRetries = 1
+			})
+			var statsd testStatsdClient
+			h := newAgentTraceWriter(c, nil, &statsd)
+			h.add([]*span{makeSpan(0)})
+			h.add([]*span{makeSpan(0)})
+			h.flush()
+			h.wg.Wait()
+
+			// the payload is recorded once, regardless of the send attempts
+			calls := statsd.DistributionCalls()
+			assert.Len(calls, 2)
+			got := make(map[string]float64)
+			for _, c := range calls {
+				got[c.name] = c.floatVal
+			}
+			assert.Equal(map[string]float64{
+				"datadog.tracer.payload_bytes":  343,
+				"datadog.tracer.payload_traces": 2,
+			}, got)
+		})
+	}
+}
+
+// chunkRecordingTransport records the traces and the size of each payload it
+// is given.
+type chunkRecordingTransport struct {
+	dummyTransport
+	mu       sync.Mutex
+	payloads []spanLists
+	sizes    []int
+}
+
+func (t *chunkRecordingTransport) send(p *payload) (io.ReadCloser, error) {
+	size, count := p.size(), p.itemCount()
+	traces, err := decode(p)
+	if err != nil {
+		return nil, err
+	}
+	if len(traces) != count {
+		return nil, fmt.Errorf("payload has %d traces, expected %d", len(traces), count)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.payloads = append(t.payloads, traces)
+	t.sizes = append(t.sizes, size)
+	return io.NopCloser(strings.NewReader("OK")), nil
+}
+
+func TestTraceWriterSplitsLargeTraces(t *testing.T) {
+	assert := assert.New(t)
+	const max = 4096
+	tr := &chunkRecordingTransport{}
+	c := newConfig(func(c *config) {
+		c.transport = tr
+	}, WithMaxPayloadSize(max))
+	h := newAgentTraceWriter(c, nil, &testStatsdClient{})
+
+	trace := make([]*span, 40)
+	for i := range trace {
+		trace[i] = makeSpan(10)
+	}
+	trace[0].setMetric(keySamplingPriority, 2)
+	h.add(trace)
+	h.flush()
+	h.wg.Wait()
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	assert.Greater(len(tr.payloads), 1)
+	var n int
+	for i, traces := range tr.payloads {
+		assert.LessOrEqual(tr.sizes[i], max)
+		for _, chunk := range traces {
+			assert.Equal(2., chunk[0].Metrics[keySamplingPriority])
+			n += len(chunk)
+		}
+	}
+	assert.Equal(len(trace), n)
+}
+
+func TestSplitTrace(t *testing.T) {
+	t.Run("small", func(t *testing.T) {
+		trace := []*span{makeSpan(0), makeSpan(0)}
+		assert.Equal(t, [][]*span{trace}, splitTrace(trace, payloadMaxLimit))
+	})
+
+	t.Run("oversized-span", func(t *testing.T) {
+		trace := []*span{makeSpan(0), makeSpan(100), makeSpan(0)}
+		chunks := splitTrace(trace, trace[1].Msgsize()-1)
+		assert.Len(t, chunks, 3)
+		for i, chunk := range chunks {
+			assert.Equal(t, []*span{trace[i]}, chunk)
+		}
+	})
+}
+
+func copyCounts(m map[string]int64) map[string]int64 {
+	c := make(map[string]int64, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func TestTraceWriterAPIErrors(t *testing.T) {
+	for status, class := range map[int]string{
+		http.StatusBadRequest:            "4xx",
+		http.StatusRequestEntityTooLarge: "4xx",
+		http.StatusInternalServerError:   "5xx",
+		http.StatusServiceUnavailable:    "5xx",
+	} {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			assert := assert.New(t)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+			}))
+			defer srv.Close()
+			c := newConfig(func(c *config) {
+				c.transport = newHTTPTransport(srv.URL, defaultClient)
+				c.sendRetries = 1
+			})
+			var statsd testStatsdClient
+			h := newAgentTraceWriter(c, newPrioritySampler(), &statsd)
+			h.add([]*span{makeSpan(0)})
+			h.flush()
+			h.wg.Wait()
+
+			assert.Equal(int64(2), statsd.Counts()["datadog.tracer.api.errors"])
+			for _, call := range statsd.IncrCalls() {
+				if call.name == "datadog.tracer.api.errors" {
+					assert.Equal([]string{"status_class:" + class}, call.tags)
+				}
+			}
+		})
+	}
+
+	t.Run("unreachable", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		srv.Close()
+		c := newConfig(func(c *config) {
+			c.transport = newHTTPTransport(srv.URL, defaultClient)
+		})
+		var statsd testStatsdClient
+		h := newAgentTraceWriter(c, newPrioritySampler(), &statsd)
+		h.add([]*span{makeSpan(0)})
+		h.flush()
+		h.wg.Wait()
+
+		calls := statsd.IncrCalls()
+		require.Len(t, calls, 1)
+		assert.Equal(t, "datadog.tracer.api.errors", calls[0].name)
+		assert.Equal(t, []string{"status_class:unknown"}, calls[0].tags)
+	})
+}
+
+func TestTraceWriterFlushID(t *testing.T) {
+	assert := assert.New(t)
+	var (
+		mu  sync.Mutex
+		ids []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		ids = append(ids, r.Header.Get(flushIDHeader))
+		if len(ids) == 1 {
+			// fail the first attempt to check the retries send the same ID
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"rate_by_service":{}}`))
+	}))
+	defer srv.Close()
+	c := newConfig(func(c *config) {
+		c.transport = newHTTPTransport(srv.URL, defaultClient)
+		c.sendRetries = 1
+	})
+	h := newAgentTraceWriter(c, newPrioritySampler(), &testStatsdClient{})
+	for i := 0; i < 2; i++ {
+		h.add([]*span{makeSpan(0)})
+		h.flush()
+		h.wg.Wait()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, ids, 3)
+	assert.NotEmpty(ids[0])
+	assert.Equal(ids[0], ids[1])
+	assert.NotEmpty(ids[2])
+	assert.NotEqual(ids[0], ids[2])
+}
+
+func TestTraceWriterReadsAgentRates(t *testing.T) {
+	assert := assert.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{
+			"rate_by_service":{
+				"service:,env:":0.1,
+				"service:my-service,env:":0.2,
+				"service:my-service,env:other":0.3
+			}
+		}`))
+	}))
+	defer srv.Close()
+
+	c := newConfig(func(c *config) {
+		c.transport = newHTTPTransport(srv.URL, defaultClient)
+	})
+	ps := newPrioritySampler()
+	var statsd testStatsdClient
+	h := newAgentTraceWriter(c, ps, &statsd)
+	h.add([]*span{makeSpan(0)})
+	h.flush()
+	h.wg.Wait()
+
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	assert.Equal(0.1, ps.defaultRate)
+	assert.Equal(map[string]float64{
+		"service:my-service,env:":      0.2,
+		"service:my-service,env:other": 0.3,
+	}, ps.rates)
+	statsd.mu.Lock()
+	defer statsd.mu.Unlock()
+	assert.NotContains(statsd.counts, "datadog.tracer.decode_error")
+}
+
 func BenchmarkJsonEncodeSpan(b *testing.B) {
 	s := makeSpan(10)
 	s.Metrics["nan"] = math.NaN()
@@ -12,6 +12,8 @@ import (
 	"sync"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/httpsec"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/remoteconfig"
 
@@ -39,6 +41,13 @@ func Start(opts ...StartOption) {
 		log.Debug("appsec: disabled by the configuration: set the environment variable DD_APPSEC_ENABLED to true to enable it")
 		return
 	}
+	// AppSec explicitly enabled without its required blocked templates stays disabled
+	if set {
+		if err := httpsec.BlockedTemplatesError(); err != nil {
+			log.Error("appsec: could not start, AppSec must not run without its required blocked templates: %v", err)
+			return
+		}
+	}
 	// From this point we know that AppSec is either enabled or can be enabled through remote config
 	cfg, err := newConfig()
 	if err != nil {
@@ -120,6 +129,7 @@ func newAppSec(cfg *Config) *appsec {
 func (a *appsec) start() error {
 	a.limiter = NewTokenTicker(int64(a.cfg.traceRateLimit), int64(a.cfg.traceRateLimit))
 	a.limiter.Start()
+	instrumentation.SetMinimalTags(a.cfg.minimalTags)
 	// Register the WAF operation event listener
 	if err := a.swapWAF(a.cfg.rulesManager.latest); err != nil {
 		return err
@@ -146,4 +156,5 @@ func (a *appsec) stop() {
 	// TODO: block until no more requests are using dyngo operations
 
 	a.limiter.Stop()
+	instrumentation.SetMinimalTags(false)
 }
@@ -14,6 +14,7 @@ import (
 	"unicode"
 	"unicode/utf8"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/internal"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/remoteconfig"
 )
@@ -25,6 +26,7 @@ const (
 	traceRateLimitEnvVar  = "DD_APPSEC_TRACE_RATE_LIMIT"
 	obfuscatorKeyEnvVar   = "DD_APPSEC_OBFUSCATION_PARAMETER_KEY_REGEXP"
 	obfuscatorValueEnvVar = "DD_APPSEC_OBFUSCATION_PARAMETER_VALUE_REGEXP"
+	minimalTagsEnvVar     = "DD_APPSEC_MINIMAL_TAGS"
 )
 
 const (
@@ -42,12 +44,16 @@ type Config struct {
 	// rules loaded via the env var DD_APPSEC_RULES. When not set, the builtin rules will be used
 	// and live-updated with remote configuration.
 	rulesManager *rulesManager
-	// Maximum WAF execution time
+	// Maximum WAF execution time of each WAF run. The gRPC requests fail open
+	// when it is exceeded.
 	wafTimeout time.Duration
 	// AppSec trace rate limit (traces per second).
 	traceRateLimit uint
 	// Obfuscator configuration parameters
 	obfuscator ObfuscatorConfig
+	// minimalTags enables the minimal tagging mode, where the informational
+	// AppSec tags are only set on the spans of requests with security events.
+	minimalTags bool
 	// rc is the remote configuration client used to receive product configuration updates. Nil if rc is disabled (default)
 	rc *remoteconfig.ClientConfig
 }
@@ -95,6 +101,7 @@ func newConfig() (*Config, error) {
 		wafTimeout:     readWAFTimeoutConfig(),
 		traceRateLimit: readRateLimitConfig(),
 		obfuscator:     readObfuscatorConfig(),
+		minimalTags:    internal.BoolEnv(minimalTagsEnvVar, false),
 	}, nil
 }
 
@@ -10,6 +10,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/samplernames"
@@ -40,6 +41,26 @@ type (
 	ContextKey struct{}
 )
 
+// minimalTags is non-zero when the minimal tagging mode is enabled.
+var minimalTags int32
+
+// SetMinimalTags enables or disables the minimal tagging mode. When enabled,
+// AppSec keeps monitoring and blocking requests but only tags the spans of the
+// requests having security events, so that the informational tags added to
+// every monitored request are avoided.
+func SetMinimalTags(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&minimalTags, v)
+}
+
+// MinimalTags returns true when the minimal tagging mode is enabled.
+func MinimalTags() bool {
+	return atomic.LoadInt32(&minimalTags) != 0
+}
+
 // NewTagsHolder returns a new instance of a TagsHolder struct.
 func NewTagsHolder() TagsHolder {
 	return TagsHolder{tags: map[string]interface{}{}}
@@ -96,7 +117,16 @@ func SetStringTags(span TagSetter, tags map[string]string) {
 
 // SetAppSecEnabledTags sets the AppSec-specific span tags that are expected to be in
 // the web service entry span (span of type `web`) when AppSec is enabled.
+// It is a no-op in minimal tagging mode, where these tags are only set along
+// with the security event tags.
 func SetAppSecEnabledTags(span TagSetter) {
+	if MinimalTags() {
+		return
+	}
+	setAppSecEnabledTags(span)
+}
+
+func setAppSecEnabledTags(span TagSetter) {
 	span.SetTag("_dd.appsec.enabled", 1)
 	span.SetTag("_dd.runtime_family", "go")
 }
@@ -109,6 +139,10 @@ func SetEventSpanTags(span TagSetter, events []json.RawMessage) error {
 		return err
 	}
 	span.SetTag("_dd.appsec.json", string(val))
+	if MinimalTags() {
+		// The AppSec-enabled tags weren't set when the request started
+		setAppSecEnabledTags(span)
+	}
 	// Keep this span due to the security event
 	//
 	// This is a workaround to tell the tracer that the trace was kept by AppSec.
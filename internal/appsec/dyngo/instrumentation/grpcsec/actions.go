@@ -12,6 +12,7 @@ import (
 	"sync"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/sharedsec"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -32,7 +33,8 @@ type ActionsHandler struct {
 // Currently, only the default "block" action is supported
 func NewActionsHandler() ActionsHandler {
 	// Register the default "block" action as specified in the blocking RFC
-	actions := map[string]Action{"block": &BlockRequestAction{Status: codes.Aborted}}
+	// Its status code is left unset so that the default one is used.
+	actions := map[string]Action{"block": &BlockRequestAction{}}
 
 	return ActionsHandler{
 		actions: actions,
@@ -47,27 +49,57 @@ func (h *ActionsHandler) RegisterAction(id string, a Action) {
 	h.actions[id] = a
 }
 
-// Apply executes the action identified by `id`
-func (h *ActionsHandler) Apply(id string, op *HandlerOperation) bool {
+// Apply executes the action identified by `id`. The given metadata, describing
+// what triggered the action (e.g. the ids and tags of the security rules), is
+// made available to the instrumentation through op.ActionMetadata().
+func (h *ActionsHandler) Apply(id string, op *HandlerOperation, metadata map[string]string) bool {
+	err := h.apply(id, op, metadata)
+	if err == nil {
+		return false
+	}
+	op.Error = err
+	return true
+}
+
+// ApplyToClientCall executes the action identified by `id` on an outgoing call
+// sent by the handler of op, and returns the error blocking the call, if any.
+// Unlike Apply, it doesn't set op.Error as outgoing calls can be sent
+// concurrently by the handler.
+func (h *ActionsHandler) ApplyToClientCall(id string, op *HandlerOperation, metadata map[string]string) error {
+	return h.apply(id, op, metadata)
+}
+
+// apply executes the action identified by `id` and returns the error blocking
+// the request, or nil when the action doesn't block it.
+func (h *ActionsHandler) apply(id string, op *HandlerOperation, metadata map[string]string) error {
 	h.mu.RLock()
 	a, ok := h.actions[id]
 	h.mu.RUnlock()
 	if !ok {
-		return false
+		return nil
 	}
 	// Currently, only the "block_request" type is supported, so we only need to check for blockRequestParams
 	if p, ok := a.(*BlockRequestAction); ok {
-		op.Error = status.Error(p.Status, "Request blocked")
+		code := p.Status
+		if code == codes.OK {
+			code = codes.Code(sharedsec.DefaultGRPCBlockStatus())
+		}
 		op.AddTag(instrumentation.BlockedRequestTag, true)
-		return true
+		op.addActionMetadata(p.Metadata)
+		op.addActionMetadata(metadata)
+		return status.Error(code, "Request blocked")
 	}
-	return false
+	return nil
 }
 
 // BlockRequestAction is the struct used to perform the request blocking action
 type BlockRequestAction struct {
-	// Status is the return code to use when blocking the request
+	// Status is the return code to use when blocking the request. When OK,
+	// the default status code is used (cf. sharedsec.DefaultGRPCBlockStatus).
 	Status codes.Code
+	// Metadata holds static data describing the action, added to the
+	// metadata of the operations it is applied to.
+	Metadata map[string]string
 }
 
 func (*BlockRequestAction) isAction() {}
@@ -0,0 +1,46 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:build appsec
+// +build appsec
+
+package grpcsec
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestApplyToClientCall(t *testing.T) {
+	h := NewActionsHandler()
+	h.RegisterAction("block-call", &BlockRequestAction{Status: codes.PermissionDenied})
+	_, op := StartHandlerOperation(context.Background(), HandlerOperationArgs{}, nil)
+	defer op.Finish(HandlerOperationRes{})
+
+	// outgoing calls can be sent concurrently by the handler
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = h.ApplyToClientCall("block-call", op, map[string]string{"rule.id": "rule"})
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+	}
+	// the handler itself isn't blocked
+	require.NoError(t, op.Error)
+	require.Equal(t, "rule", op.ActionMetadata()["rule.id"])
+	require.NoError(t, h.ApplyToClientCall("unknown", op, nil))
+}
@@ -0,0 +1,105 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023 Datadog, Inc.
+
+package grpcsec
+
+import (
+	"context"
+	"reflect"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation"
+)
+
+// Abstract gRPC client call operation definition, allowing to monitor the
+// outgoing RPCs sent by a gRPC handler, e.g. to protect it against server-side
+// request forgery (SSRF).
+type (
+	// ClientCallOperationArgs is the client call operation arguments.
+	ClientCallOperationArgs struct {
+		// URL of the outgoing RPC, made of the target of the client
+		// connection and of the full method name, e.g.
+		// grpc://localhost:50051/package.Service/Method.
+		// Corresponds to the address `server.io.net.url`.
+		URL string
+		// Message sent by the client, nil when the call is started, before
+		// the messages of a stream are sent.
+		// Corresponds to the address `grpc.client.request.message`.
+		Message interface{}
+	}
+
+	// ClientCallOperationRes is the client call operation results. Empty as
+	// of today.
+	ClientCallOperationRes struct{}
+
+	// ClientCallOperation type representing an outgoing RPC or a message sent
+	// by an outgoing stream. It must be created with
+	// StartClientCallOperation() and finished with its Finish() method.
+	ClientCallOperation struct {
+		dyngo.Operation
+		// Error is set by the operation listeners when the call must be
+		// blocked.
+		Error error
+	}
+
+	// OnClientCallOperationStart function type, called when a client call
+	// operation starts.
+	OnClientCallOperationStart func(*ClientCallOperation, ClientCallOperationArgs)
+	// OnClientCallOperationFinish function type, called when a client call
+	// operation finishes.
+	OnClientCallOperationFinish func(*ClientCallOperation, ClientCallOperationRes)
+)
+
+// ProtectClientCall starts and finishes the client call operation described by
+// args. An error is returned if the call must be blocked, in which case it must
+// not be sent. It is a no-op when the context isn't the one of a gRPC handler
+// monitored by AppSec.
+func ProtectClientCall(ctx context.Context, args ClientCallOperationArgs) error {
+	parent, _ := ctx.Value(instrumentation.ContextKey{}).(*HandlerOperation)
+	if parent == nil {
+		return nil
+	}
+	op := StartClientCallOperation(parent, args)
+	op.Finish()
+	return op.Error
+}
+
+// StartClientCallOperation starts the client call operation and emits a start
+// event.
+func StartClientCallOperation(parent *HandlerOperation, args ClientCallOperationArgs) *ClientCallOperation {
+	op := &ClientCallOperation{Operation: dyngo.NewOperation(parent)}
+	dyngo.StartOperation(op, args)
+	return op
+}
+
+// Finish finishes the client call operation and emits a finish event.
+func (op *ClientCallOperation) Finish() {
+	dyngo.FinishOperation(op, ClientCallOperationRes{})
+}
+
+var (
+	clientCallOperationArgsType = reflect.TypeOf((*ClientCallOperationArgs)(nil)).Elem()
+	clientCallOperationResType  = reflect.TypeOf((*ClientCallOperationRes)(nil)).Elem()
+)
+
+// ListenedType returns the type a OnClientCallOperationStart event listener
+// listens to, which is the ClientCallOperationArgs type.
+func (OnClientCallOperationStart) ListenedType() reflect.Type { return clientCallOperationArgsType }
+
+// Call calls the underlying event listener function by performing the
+// type-assertion on v whose type is the one returned by ListenedType().
+func (f OnClientCallOperationStart) Call(op dyngo.Operation, v interface{}) {
+	f(op.(*ClientCallOperation), v.(ClientCallOperationArgs))
+}
+
+// ListenedType returns the type a OnClientCallOperationFinish event listener
+// listens to, which is the ClientCallOperationRes type.
+func (OnClientCallOperationFinish) ListenedType() reflect.Type { return clientCallOperationResType }
+
+// Call calls the underlying event listener function by performing the
+// type-assertion on v whose type is the one returned by ListenedType().
+func (f OnClientCallOperationFinish) Call(op dyngo.Operation, v interface{}) {
+	f(op.(*ClientCallOperation), v.(ClientCallOperationRes))
+}
@@ -13,6 +13,7 @@ import (
 	"context"
 	"encoding/json"
 	"reflect"
+	"sync"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation"
@@ -43,6 +44,10 @@ type (
 		instrumentation.TagsHolder
 		instrumentation.SecurityEventsHolder
 		Error error
+		// actionMetadata describes the security actions applied to the
+		// operation, which can be applied concurrently.
+		actionMetadata map[string]string
+		mu             sync.Mutex // guards actionMetadata
 	}
 	// HandlerOperationArgs is the grpc handler arguments.
 	HandlerOperationArgs struct {
@@ -51,8 +56,16 @@ type (
 		Metadata map[string][]string
 		ClientIP netip.Addr
 	}
-	// HandlerOperationRes is the grpc handler results. Empty as of today.
-	HandlerOperationRes struct{}
+	// HandlerOperationRes is the grpc handler results.
+	HandlerOperationRes struct {
+		// Header is the metadata the gRPC handler set as the response headers.
+		// Corresponds to the address `grpc.server.response.metadata.headers`.
+		Header map[string][]string
+		// Trailer is the metadata the gRPC handler set as the response
+		// trailers.
+		// Corresponds to the address `grpc.server.response.metadata.trailers`.
+		Trailer map[string][]string
+	}
 
 	// ReceiveOperation type representing an gRPC server handler operation. It must
 	// be created with StartReceiveOperation() and finished with its Finish().
@@ -88,12 +101,46 @@ func StartHandlerOperation(ctx context.Context, args HandlerOperationArgs, paren
 }
 
 // Finish the gRPC handler operation, along with the given results, and emit a
-// finish event up in the operation stack.
+// finish event up in the operation stack. The results can still be blocked by
+// the finish event listeners, in which case op.Error is set to the error the
+// handler must return instead of its own results.
 func (op *HandlerOperation) Finish(res HandlerOperationRes) []json.RawMessage {
 	dyngo.FinishOperation(op, res)
 	return op.Events()
 }
 
+// ActionMetadata returns a copy of the metadata of the security actions
+// applied to the operation, such as the ids and tags of the security rules
+// which triggered them. It returns nil when no action was applied.
+func (op *HandlerOperation) ActionMetadata() map[string]string {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.actionMetadata == nil {
+		return nil
+	}
+	md := make(map[string]string, len(op.actionMetadata))
+	for k, v := range op.actionMetadata {
+		md[k] = v
+	}
+	return md
+}
+
+// addActionMetadata adds md to the metadata of the security actions applied to
+// the operation. Thread safe.
+func (op *HandlerOperation) addActionMetadata(md map[string]string) {
+	if len(md) == 0 {
+		return
+	}
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.actionMetadata == nil {
+		op.actionMetadata = make(map[string]string, len(md))
+	}
+	for k, v := range md {
+		op.actionMetadata[k] = v
+	}
+}
+
 // gRPC handler operation's start and finish event callback function types.
 type (
 	// OnHandlerOperationStart function type, called when an gRPC handler
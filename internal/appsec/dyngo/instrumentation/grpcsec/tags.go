@@ -33,3 +33,12 @@ func setSecurityEventTags(span ddtrace.Span, events []json.RawMessage, md map[st
 
 	return nil
 }
+
+// SetActionMetadataTags sets the metadata of the security actions applied to
+// the request (see HandlerOperation.ActionMetadata) as span tags prefixed with
+// `appsec.action.`.
+func SetActionMetadataTags(span instrumentation.TagSetter, md map[string]string) {
+	for k, v := range md {
+		span.SetTag("appsec.action."+k, v)
+	}
+}
@@ -6,9 +6,11 @@
 package grpcsec
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
+	"sync"
 	"testing"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
@@ -202,3 +204,26 @@ func (m *MockSpan) Finish(_ ...ddtrace.FinishOption) {
 func (m *MockSpan) Context() ddtrace.SpanContext {
 	panic("unused")
 }
+
+func TestActionMetadataConcurrency(t *testing.T) {
+	_, op := StartHandlerOperation(context.Background(), HandlerOperationArgs{}, nil)
+	defer op.Finish(HandlerOperationRes{})
+	require.Nil(t, op.ActionMetadata())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			op.addActionMetadata(map[string]string{fmt.Sprintf("rule.%d", i): "block"})
+			_ = op.ActionMetadata()
+		}(i)
+	}
+	wg.Wait()
+
+	md := op.ActionMetadata()
+	require.Len(t, md, 10)
+	// the returned map is a copy
+	md["other"] = "value"
+	require.Len(t, op.ActionMetadata(), 10)
+}
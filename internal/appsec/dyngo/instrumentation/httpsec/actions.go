@@ -6,10 +6,15 @@
 package httpsec
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/sharedsec"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 )
 
@@ -41,11 +46,8 @@ func NewBlockRequestAction(status int, template string) BlockRequestAction {
 	default:
 		action.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			h := jsonHandler
-			hdr := r.Header.Get("Accept")
-			htmlIdx := strings.Index(hdr, "text/html")
-			jsonIdx := strings.Index(hdr, "application/json")
-			// Switch to html handler if text/html comes before application/json in the Accept header
-			if htmlIdx != -1 && (jsonIdx == -1 || htmlIdx < jsonIdx) {
+			// Switch to html handler if the client prefers text/html over application/json
+			if prefersHTML(r.Header.Get("Accept")) {
 				h = htmlHandler
 			}
 			h.ServeHTTP(w, r)
@@ -56,6 +58,138 @@ func NewBlockRequestAction(status int, template string) BlockRequestAction {
 
 }
 
+// RedirectRequestAction is the action that holds the HTTP handler to use to redirect the request
+type RedirectRequestAction struct {
+	// handler is the http handler to use to redirect the request
+	handler http.Handler
+}
+
+func (*RedirectRequestAction) isAction() {}
+
+// NewRedirectRequestAction creates, initializes and returns a new RedirectRequestAction redirecting the request to the
+// location loc with the given status code.
+func NewRedirectRequestAction(status int, loc string) RedirectRequestAction {
+	return RedirectRequestAction{handler: http.RedirectHandler(loc, status)}
+}
+
+// ReturnURLPlaceholder is the placeholder of the redirect location templates that is replaced by the URL of the
+// original request.
+const ReturnURLPlaceholder = "{return}"
+
+// NewRedirectRequestActionWithReturn creates, initializes and returns a new RedirectRequestAction redirecting the
+// request to the location template loc with the given status code. The ReturnURLPlaceholder of the template is
+// replaced by the query-escaped path and query of the original request, so that the client can return to it later,
+// e.g. with the template `/challenge?return={return}`. An error is returned when the status code is not a redirection
+// status code, or when the template isn't a URL having exactly one placeholder in its query.
+func NewRedirectRequestActionWithReturn(status int, loc string) (RedirectRequestAction, error) {
+	if status < 300 || status > 399 {
+		return RedirectRequestAction{}, fmt.Errorf("invalid redirection status code %d", status)
+	}
+	if n := strings.Count(loc, ReturnURLPlaceholder); n != 1 {
+		return RedirectRequestAction{}, fmt.Errorf("redirect location template %q must have exactly one %s placeholder, got %d", loc, ReturnURLPlaceholder, n)
+	}
+	u, err := url.Parse(loc)
+	if err != nil {
+		return RedirectRequestAction{}, fmt.Errorf("invalid redirect location template %q: %v", loc, err)
+	}
+	if !strings.Contains(u.RawQuery, ReturnURLPlaceholder) {
+		return RedirectRequestAction{}, fmt.Errorf("the %s placeholder of the redirect location template %q must be in its query", ReturnURLPlaceholder, loc)
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := strings.Replace(loc, ReturnURLPlaceholder, url.QueryEscape(r.URL.RequestURI()), 1)
+		http.Redirect(w, r, l, status)
+	})
+	return RedirectRequestAction{handler: handler}, nil
+}
+
+// defaultRedirectStatus is the status code of the redirect actions of the security rules not specifying one.
+const defaultRedirectStatus = 303
+
+// NewRedirectRequestActionFromRule creates, initializes and returns a new RedirectRequestAction from the parameters of
+// a `redirect_request` action of the security rules. A zero status code defaults to 303. Locations having a
+// ReturnURLPlaceholder are templates validated as with NewRedirectRequestActionWithReturn, while other locations must
+// be valid URLs. An error is returned when the parameters are invalid.
+func NewRedirectRequestActionFromRule(status int, loc string) (RedirectRequestAction, error) {
+	if status == 0 {
+		status = defaultRedirectStatus
+	}
+	if strings.Contains(loc, ReturnURLPlaceholder) {
+		return NewRedirectRequestActionWithReturn(status, loc)
+	}
+	if status < 300 || status > 399 {
+		return RedirectRequestAction{}, fmt.Errorf("invalid redirection status code %d", status)
+	}
+	if loc == "" {
+		return RedirectRequestAction{}, errors.New("empty redirect location")
+	}
+	if _, err := url.Parse(loc); err != nil {
+		return RedirectRequestAction{}, fmt.Errorf("invalid redirect location %q: %v", loc, err)
+	}
+	return NewRedirectRequestAction(status, loc), nil
+}
+
+// mediaRange is a media range of an Accept header along with its quality value.
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// prefersHTML reports whether the given Accept header value gives text/html a
+// strictly higher quality value than application/json. Media ranges with an
+// invalid quality value are ignored.
+func prefersHTML(accept string) bool {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(params[0])), "/")
+		if !ok {
+			continue
+		}
+		r := mediaRange{typ: typ, subtype: subtype, q: 1}
+		for _, p := range params[1:] {
+			k, v, _ := strings.Cut(p, "=")
+			if strings.TrimSpace(k) != "q" {
+				continue
+			}
+			q, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil || q < 0 || q > 1 {
+				ok = false
+			}
+			r.q = q
+		}
+		if ok {
+			ranges = append(ranges, r)
+		}
+	}
+	return acceptQuality(ranges, "text", "html") > acceptQuality(ranges, "application", "json")
+}
+
+// acceptQuality returns the quality value of the given media type, as defined
+// by the most specific media range matching it.
+func acceptQuality(ranges []mediaRange, typ, subtype string) float64 {
+	var (
+		q           float64
+		specificity = -1
+	)
+	for _, r := range ranges {
+		var s int
+		switch {
+		case r.typ == typ && r.subtype == subtype:
+			s = 2
+		case r.typ == typ && r.subtype == "*":
+			s = 1
+		case r.typ == "*" && r.subtype == "*":
+			s = 0
+		default:
+			continue
+		}
+		if s > specificity {
+			specificity, q = s, r.q
+		}
+	}
+	return q
+}
+
 func newBlockRequestHandler(status int, ct string, payload []byte) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", ct)
@@ -71,13 +205,19 @@ type ActionsHandler struct {
 }
 
 // NewActionsHandler returns an action handler holding the default ASM actions.
-// Currently, only the default "block" action is supported
+// Currently, only the default "block" action is supported. Other actions, such
+// as the redirect actions of the security rules, can be added with RegisterAction.
 func NewActionsHandler() *ActionsHandler {
 	handler := ActionsHandler{
 		actions: map[string]Action{},
 	}
-	// Register the default "block" action as specified in the RFC for HTTP blocking
-	block := NewBlockRequestAction(403, "auto")
+	// Register the default "block" action as specified in the RFC for HTTP blocking. Its status code is looked up
+	// when blocking requests, cf. sharedsec.DefaultHTTPBlockStatus().
+	block := BlockRequestAction{
+		handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			NewBlockRequestAction(sharedsec.DefaultHTTPBlockStatus(), "auto").handler.ServeHTTP(w, r)
+		}),
+	}
 	handler.RegisterAction("block", &block)
 
 	return &handler
@@ -104,7 +244,7 @@ func (h *ActionsHandler) Apply(id string, op *Operation) bool {
 	op.AddAction(a)
 
 	switch a.(type) {
-	case *BlockRequestAction:
+	case *BlockRequestAction, *RedirectRequestAction:
 		return true
 	default:
 		return false
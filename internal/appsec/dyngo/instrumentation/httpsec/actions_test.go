@@ -120,19 +120,49 @@ func TestNewBlockRequestAction(t *testing.T) {
 			},
 			{
 				name:     "html-accept-2",
-				accept:   "text/html,application/json",
+				accept:   "text/html;q=0.9,application/json;q=0.8",
 				expected: blockedTemplateHTML,
 			},
 			{
 				name:     "html-accept-3",
-				accept:   "irrelevant/content,text/html,application/json",
+				accept:   "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
 				expected: blockedTemplateHTML,
 			},
 			{
 				name:     "html-accept-4",
-				accept:   "irrelevant/content,text/html,application/json,text/html",
+				accept:   "text/*, application/json;q=0.5",
+				expected: blockedTemplateHTML,
+			},
+			{
+				name:     "html-accept-5",
+				accept:   "text/html, application/*;q=0.2, */*",
 				expected: blockedTemplateHTML,
 			},
+			{
+				name:     "json-accept-q",
+				accept:   "text/html;q=0.1, application/json;q=0.9",
+				expected: blockedTemplateJSON,
+			},
+			{
+				name:     "json-accept-tie",
+				accept:   "irrelevant/content,text/html,application/json",
+				expected: blockedTemplateJSON,
+			},
+			{
+				name:     "json-accept-wildcard",
+				accept:   "*/*",
+				expected: blockedTemplateJSON,
+			},
+			{
+				name:     "json-accept-refused-html",
+				accept:   "text/html;q=0, */*;q=0.1",
+				expected: blockedTemplateJSON,
+			},
+			{
+				name:     "json-accept-invalid-q",
+				accept:   "text/html;q=abc, application/json;q=0.5",
+				expected: blockedTemplateJSON,
+			},
 			{
 				name:     "irrelevant-accept",
 				accept:   "irrelevant/irrelevant,application/html",
@@ -153,3 +183,91 @@ func TestNewBlockRequestAction(t *testing.T) {
 		}
 	})
 }
+
+func TestNewRedirectRequestActionWithReturn(t *testing.T) {
+	t.Run("invalid", func(t *testing.T) {
+		for _, tc := range []struct {
+			name   string
+			status int
+			loc    string
+		}{
+			{
+				name:   "status",
+				status: 403,
+				loc:    "/challenge?return={return}",
+			},
+			{
+				name:   "no-placeholder",
+				status: 303,
+				loc:    "/challenge",
+			},
+			{
+				name:   "several-placeholders",
+				status: 303,
+				loc:    "/challenge?return={return}&again={return}",
+			},
+			{
+				name:   "path-placeholder",
+				status: 303,
+				loc:    "/challenge/{return}",
+			},
+			{
+				name:   "fragment-placeholder",
+				status: 303,
+				loc:    "/challenge?a=b#{return}",
+			},
+			{
+				name:   "invalid-url",
+				status: 303,
+				loc:    "http://[::1?return={return}",
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := NewRedirectRequestActionWithReturn(tc.status, tc.loc)
+				require.Error(t, err)
+			})
+		}
+	})
+
+	t.Run("redirect", func(t *testing.T) {
+		action, err := NewRedirectRequestActionWithReturn(303, "/challenge?id=1&return={return}")
+		require.NoError(t, err)
+		srv := httptest.NewServer(action.handler)
+		defer srv.Close()
+		client := srv.Client()
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+		res, err := client.Get(srv.URL + "/admin/users?id=42&sort=name")
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, 303, res.StatusCode)
+		require.Equal(t, "/challenge?id=1&return=%2Fadmin%2Fusers%3Fid%3D42%26sort%3Dname", res.Header.Get("Location"))
+	})
+}
+
+func TestNewRedirectRequestActionFromRule(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		status int
+		loc    string
+		valid  bool
+	}{
+		{name: "default-status", loc: "/challenge", valid: true},
+		{name: "status", status: 307, loc: "https://example.com/challenge", valid: true},
+		{name: "template", loc: "/challenge?return={return}", valid: true},
+		{name: "invalid-status", status: 403, loc: "/challenge"},
+		{name: "invalid-template", loc: "/challenge/{return}"},
+		{name: "invalid-url", loc: "http://[::1"},
+		{name: "empty-location"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewRedirectRequestActionFromRule(tc.status, tc.loc)
+			if tc.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
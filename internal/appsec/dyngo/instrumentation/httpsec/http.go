@@ -16,6 +16,7 @@ import (
 	_ "embed"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"reflect"
@@ -23,6 +24,7 @@ import (
 	"sync"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
@@ -99,6 +101,9 @@ func applyActions(op *Operation) http.Handler {
 		case *BlockRequestAction:
 			op.AddTag(instrumentation.BlockedRequestTag, true)
 			return a.handler
+		case *RedirectRequestAction:
+			op.AddTag(instrumentation.BlockedRequestTag, true)
+			return a.handler
 		default:
 			log.Error("appsec: ignoring security action: unexpected action type %T", a)
 		}
@@ -125,8 +130,13 @@ func ExecuteSDKBodyOperation(parent dyngo.Operation, args SDKBodyOperationArgs)
 func WrapHandler(handler http.Handler, span ddtrace.Span, pathParams map[string]string, onBlock ...func()) http.Handler {
 	instrumentation.SetAppSecEnabledTags(span)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// In minimal tagging mode, the request tags are only set when security
+		// events were found.
+		minimalTags := instrumentation.MinimalTags()
 		ipTags, clientIP := ClientIPTags(r.Header, true, r.RemoteAddr)
-		instrumentation.SetStringTags(span, ipTags)
+		if !minimalTags {
+			instrumentation.SetStringTags(span, ipTags)
+		}
 
 		args := MakeHandlerOperationArgs(r, clientIP, pathParams)
 		ctx, op := StartOperation(r.Context(), args)
@@ -152,10 +162,16 @@ func WrapHandler(handler http.Handler, span ddtrace.Span, pathParams map[string]
 					f()
 				}
 			}
-			instrumentation.SetTags(span, op.Tags())
 			if len(events) == 0 {
+				if !minimalTags {
+					instrumentation.SetTags(span, op.Tags())
+				}
 				return
 			}
+			if minimalTags {
+				instrumentation.SetStringTags(span, ipTags)
+			}
+			instrumentation.SetTags(span, op.Tags())
 			SetSecurityEventTags(span, events, args.Headers, w.Header())
 		}()
 
@@ -362,17 +378,47 @@ var blockedTemplateHTML []byte
 const (
 	envBlockedTemplateHTML = "DD_APPSEC_HTTP_BLOCKED_TEMPLATE_HTML"
 	envBlockedTemplateJSON = "DD_APPSEC_HTTP_BLOCKED_TEMPLATE_JSON"
+	// envBlockedTemplateRequired is the environment variable making the
+	// custom blocked templates mandatory: when they cannot be read, instead of
+	// falling back to the default ones, AppSec explicitly enabled with
+	// DD_APPSEC_ENABLED fails to start and logs an error.
+	envBlockedTemplateRequired = "DD_APPSEC_BLOCKED_TEMPLATE_REQUIRED"
 )
 
+// blockedTemplatesErr is the error of the blocked templates loading, only set
+// when they are required.
+var blockedTemplatesErr error
+
 func init() {
+	blockedTemplatesErr = loadBlockedTemplates()
+}
+
+// loadBlockedTemplates reads the custom blocked templates configured by the
+// environment. The default templates are kept when a custom template cannot be
+// read, unless custom templates are required, in which case an error is
+// returned.
+func loadBlockedTemplates() error {
+	required := internal.BoolEnv(envBlockedTemplateRequired, false)
 	for env, template := range map[string]*[]byte{envBlockedTemplateJSON: &blockedTemplateJSON, envBlockedTemplateHTML: &blockedTemplateHTML} {
 		if path, ok := os.LookupEnv(env); ok {
-			if t, err := os.ReadFile(path); err != nil {
-				log.Warn("Could not read template at %s: %v", path, err)
-			} else {
+			t, err := os.ReadFile(path)
+			if err == nil {
 				*template = t
+				continue
 			}
+			if required {
+				return fmt.Errorf("could not read the blocked template at %s required by %s: %v", path, envBlockedTemplateRequired, err)
+			}
+			log.Warn("Could not read template at %s: %v", path, err)
 		}
-
 	}
+	return nil
+}
+
+// BlockedTemplatesError returns the error of the blocked templates loading.
+// It is only non-nil when custom blocked templates are required by the
+// DD_APPSEC_BLOCKED_TEMPLATE_REQUIRED environment variable but couldn't be
+// read.
+func BlockedTemplatesError() error {
+	return blockedTemplatesErr
 }
@@ -0,0 +1,47 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023 Datadog, Inc.
+
+package httpsec
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadBlockedTemplates(t *testing.T) {
+	defaultJSON, defaultHTML := blockedTemplateJSON, blockedTemplateHTML
+	defer func() {
+		blockedTemplateJSON, blockedTemplateHTML = defaultJSON, defaultHTML
+	}()
+	custom := filepath.Join(t.TempDir(), "blocked.json")
+	require.NoError(t, os.WriteFile(custom, []byte(`{"blocked":true}`), 0600))
+	missing := filepath.Join(t.TempDir(), "missing.html")
+
+	t.Run("custom", func(t *testing.T) {
+		t.Setenv(envBlockedTemplateJSON, custom)
+		t.Setenv(envBlockedTemplateRequired, "true")
+		require.NoError(t, loadBlockedTemplates())
+		require.Equal(t, []byte(`{"blocked":true}`), blockedTemplateJSON)
+		require.Equal(t, defaultHTML, blockedTemplateHTML)
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		blockedTemplateHTML = defaultHTML
+		t.Setenv(envBlockedTemplateHTML, missing)
+		require.NoError(t, loadBlockedTemplates())
+		require.Equal(t, defaultHTML, blockedTemplateHTML)
+	})
+
+	t.Run("required", func(t *testing.T) {
+		t.Setenv(envBlockedTemplateHTML, missing)
+		t.Setenv(envBlockedTemplateRequired, "true")
+		err := loadBlockedTemplates()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), missing)
+	})
+}
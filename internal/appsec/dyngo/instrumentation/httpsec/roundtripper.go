@@ -0,0 +1,110 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023 Datadog, Inc.
+
+package httpsec
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo"
+)
+
+// Abstract outgoing HTTP request operation definition, allowing to monitor the
+// requests sent by the application while handling an HTTP request, e.g. to
+// protect it against server-side request forgery (SSRF).
+type (
+	// RoundTripOperationArgs is the round trip operation arguments.
+	RoundTripOperationArgs struct {
+		// URL corresponds to the address `server.io.net.url`.
+		URL string
+		// Method is the http method verb of the outgoing request.
+		Method string
+	}
+
+	// RoundTripOperationRes is the round trip operation results.
+	RoundTripOperationRes struct{}
+
+	// RoundTripOperation type representing an outgoing HTTP request. It must
+	// be created with StartRoundTripOperation() and finished with its Finish()
+	// method.
+	RoundTripOperation struct {
+		dyngo.Operation
+		// Error is set by the operation listeners when the request must be
+		// blocked.
+		Error error
+	}
+
+	// RoundTripMonitoringError wraps an error interface to decorate it with additional appsec data, if needed
+	RoundTripMonitoringError struct {
+		error
+	}
+
+	// OnRoundTripOperationStart function type, called when a round trip
+	// operation starts.
+	OnRoundTripOperationStart func(*RoundTripOperation, RoundTripOperationArgs)
+	// OnRoundTripOperationFinish function type, called when a round trip
+	// operation finishes.
+	OnRoundTripOperationFinish func(*RoundTripOperation, RoundTripOperationRes)
+)
+
+// NewRoundTripMonitoringError creates a new round trip monitoring error that returns `msg` upon calling `Error()`
+func NewRoundTripMonitoringError(msg string) *RoundTripMonitoringError {
+	return &RoundTripMonitoringError{
+		errors.New(msg),
+	}
+}
+
+// ProtectRoundTrip starts and finishes the round trip operation of the
+// outgoing HTTP request described by args. An error is returned if the request
+// must be blocked, in which case it must not be sent. It is a no-op when the
+// context isn't the one of an HTTP request monitored by AppSec.
+func ProtectRoundTrip(ctx context.Context, args RoundTripOperationArgs) error {
+	parent := fromContext(ctx)
+	if parent == nil {
+		return nil
+	}
+	op := StartRoundTripOperation(parent, args)
+	op.Finish()
+	return op.Error
+}
+
+// StartRoundTripOperation starts the round trip operation and emits a start event
+func StartRoundTripOperation(parent *Operation, args RoundTripOperationArgs) *RoundTripOperation {
+	op := &RoundTripOperation{Operation: dyngo.NewOperation(parent)}
+	dyngo.StartOperation(op, args)
+	return op
+}
+
+// Finish finishes the round trip operation and emits a finish event
+func (op *RoundTripOperation) Finish() {
+	dyngo.FinishOperation(op, RoundTripOperationRes{})
+}
+
+var (
+	roundTripOperationArgsType = reflect.TypeOf((*RoundTripOperationArgs)(nil)).Elem()
+	roundTripOperationResType  = reflect.TypeOf((*RoundTripOperationRes)(nil)).Elem()
+)
+
+// ListenedType returns the type a OnRoundTripOperationStart event listener
+// listens to, which is the RoundTripOperationArgs type.
+func (OnRoundTripOperationStart) ListenedType() reflect.Type { return roundTripOperationArgsType }
+
+// Call calls the underlying event listener function by performing the
+// type-assertion on v whose type is the one returned by ListenedType().
+func (f OnRoundTripOperationStart) Call(op dyngo.Operation, v interface{}) {
+	f(op.(*RoundTripOperation), v.(RoundTripOperationArgs))
+}
+
+// ListenedType returns the type a OnRoundTripOperationFinish event listener
+// listens to, which is the RoundTripOperationRes type.
+func (OnRoundTripOperationFinish) ListenedType() reflect.Type { return roundTripOperationResType }
+
+// Call calls the underlying event listener function by performing the
+// type-assertion on v whose type is the one returned by ListenedType().
+func (f OnRoundTripOperationFinish) Call(op dyngo.Operation, v interface{}) {
+	f(op.(*RoundTripOperation), v.(RoundTripOperationRes))
+}
@@ -0,0 +1,85 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023 Datadog, Inc.
+
+package sharedsec
+
+import (
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+)
+
+const (
+	// envHTTPBlockedStatus is the environment variable allowing to override
+	// the default HTTP status code of blocked requests.
+	envHTTPBlockedStatus = "DD_APPSEC_HTTP_BLOCKED_STATUS"
+
+	defaultHTTPBlockStatus = 403
+	// defaultGRPCBlockStatus is the gRPC Aborted status code.
+	defaultGRPCBlockStatus = 10
+)
+
+var (
+	httpBlockStatus = int32(defaultHTTPBlockStatus)
+	grpcBlockStatus = int32(defaultGRPCBlockStatus)
+)
+
+func init() {
+	if v, ok := os.LookupEnv(envHTTPBlockedStatus); ok {
+		status, err := strconv.Atoi(v)
+		if err != nil || !validHTTPStatus(status) {
+			log.Warn("appsec: ignoring %s: invalid http status code %q", envHTTPBlockedStatus, v)
+			return
+		}
+		SetDefaultBlockStatus(status, 0)
+	}
+}
+
+// SetDefaultBlockStatus sets the HTTP and gRPC status codes of the requests
+// blocked by the default "block" action. The HTTP status code is initialized
+// from the DD_APPSEC_HTTP_BLOCKED_STATUS environment variable and is not
+// otherwise configurable. A zero value leaves the corresponding status code
+// unchanged, and invalid values are ignored.
+func SetDefaultBlockStatus(http, grpc int) {
+	if http != 0 {
+		if validHTTPStatus(http) {
+			atomic.StoreInt32(&httpBlockStatus, int32(http))
+		} else {
+			log.Warn("appsec: ignoring invalid http blocking status code %d", http)
+		}
+	}
+	if grpc != 0 {
+		if validGRPCStatus(grpc) {
+			atomic.StoreInt32(&grpcBlockStatus, int32(grpc))
+		} else {
+			log.Warn("appsec: ignoring invalid grpc blocking status code %d", grpc)
+		}
+	}
+}
+
+// DefaultHTTPBlockStatus returns the HTTP status code of the requests blocked
+// by the default "block" action.
+func DefaultHTTPBlockStatus() int {
+	return int(atomic.LoadInt32(&httpBlockStatus))
+}
+
+// DefaultGRPCBlockStatus returns the gRPC status code of the requests blocked
+// by the default "block" action.
+func DefaultGRPCBlockStatus() int {
+	return int(atomic.LoadInt32(&grpcBlockStatus))
+}
+
+// validHTTPStatus reports whether status is an HTTP client or server error
+// status code.
+func validHTTPStatus(status int) bool {
+	return status >= 400 && status <= 599
+}
+
+// validGRPCStatus reports whether status is a gRPC status code other than OK.
+func validGRPCStatus(status int) bool {
+	return status >= 1 && status <= 16
+}
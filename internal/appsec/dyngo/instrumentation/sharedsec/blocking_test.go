@@ -0,0 +1,43 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2023 Datadog, Inc.
+
+package sharedsec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetDefaultBlockStatus(t *testing.T) {
+	defer SetDefaultBlockStatus(defaultHTTPBlockStatus, defaultGRPCBlockStatus)
+	require.Equal(t, 403, DefaultHTTPBlockStatus())
+	require.Equal(t, 10, DefaultGRPCBlockStatus())
+
+	SetDefaultBlockStatus(444, 7)
+	require.Equal(t, 444, DefaultHTTPBlockStatus())
+	require.Equal(t, 7, DefaultGRPCBlockStatus())
+
+	// Zero values leave the status codes unchanged
+	SetDefaultBlockStatus(0, 0)
+	require.Equal(t, 444, DefaultHTTPBlockStatus())
+	require.Equal(t, 7, DefaultGRPCBlockStatus())
+
+	// Invalid values are ignored
+	SetDefaultBlockStatus(1000, 17)
+	require.Equal(t, 444, DefaultHTTPBlockStatus())
+	require.Equal(t, 7, DefaultGRPCBlockStatus())
+	SetDefaultBlockStatus(-1, -1)
+	require.Equal(t, 444, DefaultHTTPBlockStatus())
+	require.Equal(t, 7, DefaultGRPCBlockStatus())
+
+	// Only error HTTP status codes are valid
+	for _, status := range []int{100, 200, 302, 399} {
+		SetDefaultBlockStatus(status, 0)
+		require.Equal(t, 444, DefaultHTTPBlockStatus())
+	}
+	SetDefaultBlockStatus(503, 0)
+	require.Equal(t, 503, DefaultHTTPBlockStatus())
+}
@@ -13,6 +13,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -53,7 +54,7 @@ func (a *appsec) swapWAF(rules rulesFragment) (err error) {
 		}
 	}()
 
-	listeners, err := newWAFEventListeners(newHandle, a.cfg, a.limiter)
+	listeners, err := newWAFEventListeners(newHandle, rules.Actions, a.cfg, a.limiter)
 	if err != nil {
 		return err
 	}
@@ -87,7 +88,7 @@ func newWAFHandle(rules rulesFragment, cfg *Config) (*waf.Handle, error) {
 	return waf.NewHandleFromRuleSet(rules, cfg.obfuscator.KeyRegex, cfg.obfuscator.ValueRegex)
 }
 
-func newWAFEventListeners(waf *waf.Handle, cfg *Config, l Limiter) (listeners []dyngo.EventListener, err error) {
+func newWAFEventListeners(waf *waf.Handle, actions []interface{}, cfg *Config, l Limiter) (listeners []dyngo.EventListener, err error) {
 	// Check if there are addresses in the rule
 	ruleAddresses := waf.Addresses()
 	if len(ruleAddresses) == 0 {
@@ -107,7 +108,7 @@ func newWAFEventListeners(waf *waf.Handle, cfg *Config, l Limiter) (listeners []
 	// Register the WAF event listeners
 	if len(httpAddresses) > 0 {
 		log.Debug("appsec: creating http waf event listener of the rules addresses %v", httpAddresses)
-		listeners = append(listeners, newHTTPWAFEventListener(waf, httpAddresses, cfg.wafTimeout, l))
+		listeners = append(listeners, newHTTPWAFEventListener(waf, httpAddresses, newHTTPActionsHandler(actions), cfg.wafTimeout, l))
 	}
 
 	if len(grpcAddresses) > 0 {
@@ -118,10 +119,49 @@ func newWAFEventListeners(waf *waf.Handle, cfg *Config, l Limiter) (listeners []
 	return listeners, nil
 }
 
+// ruleAction is an action of the security rules, referred to by the on_match
+// field of the rules by its id.
+type ruleAction struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	Parameters struct {
+		StatusCode int    `json:"status_code"`
+		Location   string `json:"location"`
+	} `json:"parameters"`
+}
+
+// newHTTPActionsHandler returns the HTTP actions handler holding the default
+// actions along with the redirect actions of the security rules. Invalid
+// actions are logged and ignored.
+func newHTTPActionsHandler(actions []interface{}) *httpsec.ActionsHandler {
+	handler := httpsec.NewActionsHandler()
+	for _, a := range actions {
+		var action ruleAction
+		buf, err := json.Marshal(a)
+		if err == nil {
+			err = json.Unmarshal(buf, &action)
+		}
+		if err != nil {
+			log.Error("appsec: ignoring invalid security rules action: %v", err)
+			continue
+		}
+		if action.Type != "redirect_request" {
+			log.Debug("appsec: ignoring security rules action %q: unsupported action type %q", action.ID, action.Type)
+			continue
+		}
+		redirect, err := httpsec.NewRedirectRequestActionFromRule(action.Parameters.StatusCode, action.Parameters.Location)
+		if err != nil {
+			log.Error("appsec: ignoring security rules action %q: %v", action.ID, err)
+			continue
+		}
+		handler.RegisterAction(action.ID, &redirect)
+	}
+	return handler
+}
+
 // newWAFEventListener returns the WAF event listener to register in order to enable it.
-func newHTTPWAFEventListener(handle *waf.Handle, addresses map[string]struct{}, timeout time.Duration, limiter Limiter) dyngo.EventListener {
+func newHTTPWAFEventListener(handle *waf.Handle, addresses map[string]struct{}, actionHandler *httpsec.ActionsHandler, timeout time.Duration, limiter Limiter) dyngo.EventListener {
 	var monitorRulesOnce sync.Once // per instantiation
-	actionHandler := httpsec.NewActionsHandler()
 
 	return httpsec.OnHandlerOperationStart(func(op *httpsec.Operation, args httpsec.HandlerOperationArgs) {
 		wafCtx := waf.NewContext(handle)
@@ -207,6 +247,23 @@ func newHTTPWAFEventListener(handle *waf.Handle, addresses map[string]struct{},
 			}))
 		}
 
+		if _, ok := addresses[serverIONetURLAddr]; ok {
+			// OnRoundTripOperationStart happens when the application sends an outgoing HTTP request while handling
+			// the current one. The request is blocked by returning an error from the HTTP client round trip.
+			op.On(httpsec.OnRoundTripOperationStart(func(rtOp *httpsec.RoundTripOperation, args httpsec.RoundTripOperationArgs) {
+				matches, actionIds := runWAF(wafCtx, map[string]interface{}{serverIONetURLAddr: args.URL}, timeout)
+				if len(matches) > 0 {
+					for _, id := range actionIds {
+						if actionHandler.Apply(id, op) {
+							rtOp.Error = httpsec.NewRoundTripMonitoringError("Request blocked")
+						}
+					}
+					addSecurityEvents(op, limiter, matches)
+					log.Debug("appsec: WAF detected a suspicious outgoing request: %s %s", args.Method, args.URL)
+				}
+			}))
+		}
+
 		op.On(httpsec.OnHandlerOperationFinish(func(op *httpsec.Operation, res httpsec.HandlerOperationRes) {
 			defer wafCtx.Close()
 
@@ -255,7 +312,6 @@ func newGRPCWAFEventListener(handle *waf.Handle, addresses map[string]struct{},
 			logOnce           sync.Once // per request
 			overallRuntimeNs  waf.AtomicU64
 			internalRuntimeNs waf.AtomicU64
-			nbTimeouts        waf.AtomicU64
 
 			events []json.RawMessage
 			mu     sync.Mutex // events mutex
@@ -280,7 +336,7 @@ func newGRPCWAFEventListener(handle *waf.Handle, addresses map[string]struct{},
 			matches, actionIds := runWAF(wafCtx, values, timeout)
 			if len(matches) > 0 {
 				for _, id := range actionIds {
-					actionHandler.Apply(id, op)
+					actionHandler.Apply(id, op, actionMetadata(matches, id))
 				}
 				operation.Error = op.Error
 				addSecurityEvents(op, limiter, matches)
@@ -300,7 +356,7 @@ func newGRPCWAFEventListener(handle *waf.Handle, addresses map[string]struct{},
 		if len(matches) > 0 {
 			interrupt := false
 			for _, id := range actionIds {
-				interrupt = actionHandler.Apply(id, op) || interrupt
+				interrupt = actionHandler.Apply(id, op, actionMetadata(matches, id)) || interrupt
 			}
 			addSecurityEvents(op, limiter, matches)
 			log.Debug("appsec: WAF detected an attack before executing the request")
@@ -310,6 +366,32 @@ func newGRPCWAFEventListener(handle *waf.Handle, addresses map[string]struct{},
 			}
 		}
 
+		_, monitorURL := addresses[serverIONetURLAddr]
+		_, monitorMessage := addresses[grpcClientRequestMessage]
+		if monitorURL || monitorMessage {
+			// OnClientCallOperationStart happens when the handler sends an outgoing RPC, or a message of an
+			// outgoing stream. The call is blocked by returning an error from the client interceptor.
+			op.On(grpcsec.OnClientCallOperationStart(func(callOp *grpcsec.ClientCallOperation, args grpcsec.ClientCallOperationArgs) {
+				values := make(map[string]interface{}, 2)
+				if monitorURL {
+					values[serverIONetURLAddr] = args.URL
+				}
+				if monitorMessage && args.Message != nil {
+					values[grpcClientRequestMessage] = args.Message
+				}
+				matches, actionIds := runWAF(wafCtx, values, timeout)
+				if len(matches) > 0 {
+					for _, id := range actionIds {
+						if err := actionHandler.ApplyToClientCall(id, op, actionMetadata(matches, id)); err != nil {
+							callOp.Error = err
+						}
+					}
+					addSecurityEvents(op, limiter, matches)
+					log.Debug("appsec: WAF detected a suspicious outgoing grpc call: %s", args.URL)
+				}
+			}))
+		}
+
 		op.On(grpcsec.OnReceiveOperationFinish(func(_ grpcsec.ReceiveOperation, res grpcsec.ReceiveOperationRes) {
 			if atomic.LoadUint32(&nbEvents) == maxWAFEventsPerRequest {
 				logOnce.Do(func() {
@@ -349,7 +431,6 @@ func newGRPCWAFEventListener(handle *waf.Handle, addresses map[string]struct{},
 			overall, internal := wafCtx.TotalRuntime()
 			overallRuntimeNs.Add(overall)
 			internalRuntimeNs.Add(internal)
-			nbTimeouts.Add(wafCtx.TotalTimeouts())
 
 			if len(event) == 0 {
 				return
@@ -361,10 +442,37 @@ func newGRPCWAFEventListener(handle *waf.Handle, addresses map[string]struct{},
 			mu.Unlock()
 		}))
 
-		op.On(grpcsec.OnHandlerOperationFinish(func(op *grpcsec.HandlerOperation, _ grpcsec.HandlerOperationRes) {
+		op.On(grpcsec.OnHandlerOperationFinish(func(op *grpcsec.HandlerOperation, res grpcsec.HandlerOperationRes) {
 			defer wafCtx.Close()
+
+			// The response metadata is checked once the handler returned, as
+			// it can be set until then. The RPC status isn't sent yet, so
+			// the response can still be blocked.
+			values := make(map[string]interface{}, 2)
+			if _, ok := addresses[grpcServerResponseMetadataHeaders]; ok && len(res.Header) > 0 {
+				values[grpcServerResponseMetadataHeaders] = res.Header
+			}
+			if _, ok := addresses[grpcServerResponseMetadataTrailers]; ok && len(res.Trailer) > 0 {
+				values[grpcServerResponseMetadataTrailers] = res.Trailer
+			}
+			if len(values) > 0 {
+				matches, actionIds := runWAF(wafCtx, values, timeout)
+				overall, internal := wafCtx.TotalRuntime()
+				overallRuntimeNs.Add(overall)
+				internalRuntimeNs.Add(internal)
+				if len(matches) > 0 {
+					for _, id := range actionIds {
+						actionHandler.Apply(id, op, actionMetadata(matches, id))
+					}
+					log.Debug("appsec: WAF detected a suspicious grpc response metadata")
+					mu.Lock()
+					events = append(events, matches)
+					mu.Unlock()
+				}
+			}
+
 			rInfo := handle.RulesetInfo()
-			addWAFMonitoringTags(op, rInfo.Version, overallRuntimeNs.Load(), internalRuntimeNs.Load(), nbTimeouts.Load())
+			addWAFMonitoringTags(op, rInfo.Version, overallRuntimeNs.Load(), internalRuntimeNs.Load(), wafCtx.TotalTimeouts())
 
 			// Log the following metrics once per instantiation of a WAF handle
 			monitorRulesOnce.Do(func() {
@@ -377,15 +485,66 @@ func newGRPCWAFEventListener(handle *waf.Handle, addresses map[string]struct{},
 	})
 }
 
+// actionMetadata returns the metadata of the action `id` triggered by the given
+// WAF matches: the comma-separated ids of the rules triggering it, along with
+// their tags prefixed with `rule.tags.`.
+func actionMetadata(matches []byte, id string) map[string]string {
+	var events []struct {
+		Rule struct {
+			ID      string                 `json:"id"`
+			Tags    map[string]interface{} `json:"tags"`
+			OnMatch []string               `json:"on_match"`
+		} `json:"rule"`
+	}
+	if err := json.Unmarshal(matches, &events); err != nil {
+		log.Debug("appsec: could not parse the waf matches: %v", err)
+		return nil
+	}
+	var (
+		md  map[string]string
+		ids []string
+	)
+	for _, e := range events {
+		if !containsString(e.Rule.OnMatch, id) {
+			continue
+		}
+		if md == nil {
+			md = make(map[string]string, len(e.Rule.Tags)+1)
+		}
+		ids = append(ids, e.Rule.ID)
+		for k, v := range e.Rule.Tags {
+			md["rule.tags."+k] = fmt.Sprint(v)
+		}
+	}
+	if md != nil {
+		md["rule.id"] = strings.Join(ids, ",")
+	}
+	return md
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// runWAF runs the WAF within the given timeout, returning its matches and the
+// actions to apply. A run which times out fails open: its actions are ignored
+// so that the request is let through, while the next runs of the request are
+// still evaluated. The WAF context counts the timeouts, which are reported in
+// the _dd.appsec.waf.timeouts tag.
 func runWAF(wafCtx *waf.Context, values map[string]interface{}, timeout time.Duration) ([]byte, []string) {
 	matches, actions, err := wafCtx.Run(values, timeout)
 	if err != nil {
 		if err == waf.ErrTimeout {
-			log.Debug("appsec: waf timeout value of %s reached", timeout)
-		} else {
-			log.Error("appsec: unexpected waf error: %v", err)
-			return nil, nil
+			log.Debug("appsec: waf timeout value of %s reached, failing open", timeout)
+			return matches, nil
 		}
+		log.Error("appsec: unexpected waf error: %v", err)
+		return nil, nil
 	}
 	return matches, actions
 }
@@ -400,6 +559,7 @@ const (
 	serverRequestPathParamsAddr       = "server.request.path_params"
 	serverRequestBodyAddr             = "server.request.body"
 	serverResponseStatusAddr          = "server.response.status"
+	serverIONetURLAddr                = "server.io.net.url"
 	httpClientIPAddr                  = "http.client_ip"
 	userIDAddr                        = "usr.id"
 )
@@ -414,20 +574,28 @@ var httpAddresses = []string{
 	serverRequestPathParamsAddr,
 	serverRequestBodyAddr,
 	serverResponseStatusAddr,
+	serverIONetURLAddr,
 	httpClientIPAddr,
 	userIDAddr,
 }
 
 // gRPC rule addresses currently supported by the WAF
 const (
-	grpcServerRequestMessage  = "grpc.server.request.message"
-	grpcServerRequestMetadata = "grpc.server.request.metadata"
+	grpcServerRequestMessage           = "grpc.server.request.message"
+	grpcServerRequestMetadata          = "grpc.server.request.metadata"
+	grpcServerResponseMetadataHeaders  = "grpc.server.response.metadata.headers"
+	grpcServerResponseMetadataTrailers = "grpc.server.response.metadata.trailers"
+	grpcClientRequestMessage           = "grpc.client.request.message"
 )
 
 // List of gRPC rule addresses currently supported by the WAF
 var grpcAddresses = []string{
 	grpcServerRequestMessage,
 	grpcServerRequestMetadata,
+	grpcServerResponseMetadataHeaders,
+	grpcServerResponseMetadataTrailers,
+	grpcClientRequestMessage,
+	serverIONetURLAddr,
 	httpClientIPAddr,
 	userIDAddr,
 }
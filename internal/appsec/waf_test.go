@@ -20,6 +20,8 @@ import (
 	httptrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/net/http"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/httpsec"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/sharedsec"
 
 	"github.com/stretchr/testify/require"
 )
@@ -403,3 +405,165 @@ func TestBlocking(t *testing.T) {
 		})
 	}
 }
+
+// Test that blocked requests use the configured default block status code
+func TestBlockingStatus(t *testing.T) {
+	t.Setenv("DD_APPSEC_RULES", "testdata/blocking.json")
+	appsec.Start()
+	defer appsec.Stop()
+	if !appsec.Enabled() {
+		t.Skip("AppSec needs to be enabled for this test")
+	}
+
+	mux := httptrace.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello World!\n"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	defer sharedsec.SetDefaultBlockStatus(403, 0)
+	for _, status := range []int{444, 403} {
+		sharedsec.SetDefaultBlockStatus(status, 0)
+		req, err := http.NewRequest("GET", srv.URL, nil)
+		require.NoError(t, err)
+		req.Header.Set("x-forwarded-for", "1.2.3.4")
+		res, err := srv.Client().Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, status, res.StatusCode)
+	}
+}
+
+// Test that the minimal tagging mode only tags the spans of the requests
+// having security events, while still blocking them
+func TestMinimalTags(t *testing.T) {
+	t.Setenv("DD_APPSEC_RULES", "testdata/blocking.json")
+	t.Setenv("DD_APPSEC_MINIMAL_TAGS", "true")
+	appsec.Start()
+	defer appsec.Stop()
+	if !appsec.Enabled() {
+		t.Skip("AppSec needs to be enabled for this test")
+	}
+
+	mux := httptrace.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello World!\n"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name   string
+		ip     string
+		status int
+		event  bool
+	}{
+		{
+			name:   "no-event",
+			ip:     "1.2.3.5",
+			status: 200,
+		},
+		{
+			name:   "event",
+			ip:     "1.2.3.4",
+			status: 403,
+			event:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mt := mocktracer.Start()
+			defer mt.Stop()
+			req, err := http.NewRequest("GET", srv.URL, nil)
+			require.NoError(t, err)
+			req.Header.Set("x-forwarded-for", tc.ip)
+			res, err := srv.Client().Do(req)
+			require.NoError(t, err)
+			res.Body.Close()
+			require.Equal(t, tc.status, res.StatusCode)
+
+			spans := mt.FinishedSpans()
+			require.Len(t, spans, 1)
+			tags := spans[0].Tags()
+			for _, tag := range []string{"_dd.appsec.enabled", "_dd.appsec.json", "http.client_ip"} {
+				_, ok := tags[tag]
+				require.Equal(t, tc.event, ok, tag)
+			}
+			if !tc.event {
+				require.NotContains(t, tags, "_dd.appsec.waf.duration")
+			}
+		})
+	}
+}
+
+// Test that outgoing requests are blocked by using custom rules on the `server.io.net.url` address
+func TestRoundTripBlocking(t *testing.T) {
+	t.Setenv("DD_APPSEC_RULES", "testdata/blocking.json")
+	appsec.Start()
+	defer appsec.Stop()
+	if !appsec.Enabled() {
+		t.Skip("AppSec needs to be enabled for this test")
+	}
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	// Start and trace an HTTP server sending an outgoing request to the URL
+	// given in the test-url header
+	client := httptrace.WrapClient(&http.Client{})
+	mux := httptrace.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		req, err := http.NewRequestWithContext(r.Context(), "GET", r.Header.Get("test-url"), nil)
+		require.NoError(t, err)
+		res, err := client.Do(req)
+		if err != nil {
+			var blocked *httpsec.RoundTripMonitoringError
+			require.ErrorAs(t, err, &blocked)
+			return
+		}
+		res.Body.Close()
+		w.Write([]byte("Hello World!\n"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name   string
+		url    string
+		status int
+	}{
+		{
+			name:   "no-block",
+			url:    backend.URL,
+			status: 200,
+		},
+		{
+			name:   "block",
+			url:    "http://169.254.169.254/latest/meta-data/",
+			status: 403,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mt := mocktracer.Start()
+			defer mt.Stop()
+			req, err := http.NewRequest("GET", srv.URL, nil)
+			require.NoError(t, err)
+			req.Header.Set("test-url", tc.url)
+			res, err := srv.Client().Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.status, res.StatusCode)
+			if tc.status == 200 {
+				return
+			}
+			var found bool
+			for _, span := range mt.FinishedSpans() {
+				if event := span.Tag("_dd.appsec.json"); event != nil {
+					require.Contains(t, event, "blk-001-003")
+					found = true
+				}
+			}
+			require.True(t, found)
+		})
+	}
+}
@@ -9,9 +9,13 @@
 package appsec
 
 import (
+	"encoding/json"
+	"os"
 	"testing"
+	"time"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/httpsec"
 
 	waf "github.com/DataDog/go-libddwaf"
 	"github.com/stretchr/testify/require"
@@ -38,3 +42,76 @@ func TestTagsTypes(t *testing.T) {
 		require.Contains(t, tags, tag)
 	}
 }
+
+func TestActionMetadata(t *testing.T) {
+	matches := []byte(`[
+		{"rule":{"id":"blk-001-001","tags":{"type":"block_ip","category":"security_response"},"on_match":["block"]}},
+		{"rule":{"id":"crs-942-100","tags":{"type":"sql_injection"}}},
+		{"rule":{"id":"blk-001-002","tags":{"type":"block_user"},"on_match":["block"]}}
+	]`)
+	require.Equal(t, map[string]string{
+		"rule.id":            "blk-001-001,blk-001-002",
+		"rule.tags.type":     "block_user",
+		"rule.tags.category": "security_response",
+	}, actionMetadata(matches, "block"))
+	require.Nil(t, actionMetadata(matches, "redirect"))
+	require.Nil(t, actionMetadata([]byte(`not json`), "block"))
+}
+
+func TestNewHTTPActionsHandler(t *testing.T) {
+	var actions []interface{}
+	err := json.Unmarshal([]byte(`[
+		{"id":"challenge","type":"redirect_request","parameters":{"location":"/challenge?return={return}"}},
+		{"id":"moved","type":"redirect_request","parameters":{"status_code":301,"location":"https://example.com"}},
+		{"id":"bad-status","type":"redirect_request","parameters":{"status_code":200,"location":"/challenge"}},
+		{"id":"bad-template","type":"redirect_request","parameters":{"location":"/challenge/{return}"}},
+		{"id":"no-location","type":"redirect_request","parameters":{}},
+		{"id":"custom-block","type":"block_request","parameters":{"status_code":401}}
+	]`), &actions)
+	require.NoError(t, err)
+	h := newHTTPActionsHandler(actions)
+	for id, registered := range map[string]bool{
+		"block":        true,
+		"challenge":    true,
+		"moved":        true,
+		"bad-status":   false,
+		"bad-template": false,
+		"no-location":  false,
+		"custom-block": false,
+	} {
+		require.Equal(t, registered, h.Apply(id, &httpsec.Operation{}), id)
+	}
+}
+
+func TestRunWAF(t *testing.T) {
+	rules, err := os.ReadFile("testdata/blocking.json")
+	require.NoError(t, err)
+	handle, err := waf.NewHandle(rules, "", "")
+	require.NoError(t, err)
+	defer handle.Close()
+	values := map[string]interface{}{httpClientIPAddr: "1.2.3.4"}
+
+	t.Run("within-timeout", func(t *testing.T) {
+		wafCtx := waf.NewContext(handle)
+		require.NotNil(t, wafCtx)
+		defer wafCtx.Close()
+
+		matches, actions := runWAF(wafCtx, values, time.Minute)
+		require.Contains(t, string(matches), "blk-001-001")
+		require.Equal(t, []string{"block"}, actions)
+		require.Zero(t, wafCtx.TotalTimeouts())
+	})
+
+	t.Run("exceeded", func(t *testing.T) {
+		wafCtx := waf.NewContext(handle)
+		require.NotNil(t, wafCtx)
+		defer wafCtx.Close()
+
+		// the runs time out and fail open
+		for i := 0; i < 2; i++ {
+			_, actions := runWAF(wafCtx, values, time.Nanosecond)
+			require.Nil(t, actions)
+		}
+		require.Equal(t, uint64(2), wafCtx.TotalTimeouts())
+	})
+}
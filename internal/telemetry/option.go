@@ -11,6 +11,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/globalconfig"
 )
@@ -90,7 +91,8 @@ func WithURL(agentless bool, agentURL string) Option {
 		} else {
 			u, err := url.Parse(agentURL)
 			if err == nil {
-				u.Path = "/telemetry/proxy/api/v2/apmtelemetry"
+				// keep any path prefix under which the agent is mounted
+				u.Path = strings.TrimSuffix(u.Path, "/") + "/telemetry/proxy/api/v2/apmtelemetry"
 				client.URL = u.String()
 			} else {
 				log("Agent URL %s is invalid, switching to agentless telemetry endpoint", agentURL)